@@ -0,0 +1,117 @@
+package tmx
+
+import (
+	"sort"
+	"time"
+)
+
+// Animator plays back the tile animations of a map against a shared clock, so
+// everything that uses the same animator agrees on which frame is showing.
+type Animator struct {
+	Loop    bool          // restart animations after their last frame
+	elapsed time.Duration // the shared clock
+	anims   map[uint32]*animation
+}
+
+// animation is a tile animation with the start time of each frame resolved.
+type animation struct {
+	firstgid int             // first gid of the tileset the frames are in
+	frames   []frame         // frames of the animation
+	starts   []time.Duration // start of each frame from the beginning
+	total    time.Duration   // length of a single play through
+}
+
+// Animator collects every animated tile in the tilesets of the map into a new
+// animator. The animator loops by default.
+func (m *tilemap) Animator() *Animator {
+	a := &Animator{Loop: true, anims: make(map[uint32]*animation)}
+	for i := 0; i < len(m.Tilesets); i++ {
+		ts := &m.Tilesets[i]
+		for j := 0; j < len(ts.Tiles); j++ {
+			t := &ts.Tiles[j]
+			if len(t.Animation) == 0 {
+				continue
+			}
+			an := &animation{firstgid: ts.Firstgid, frames: t.Animation}
+			for _, f := range t.Animation {
+				an.starts = append(an.starts, an.total)
+				an.total += time.Duration(f.Duration) * time.Millisecond
+			}
+			a.anims[uint32(ts.Firstgid+t.Id)] = an
+		}
+	}
+	return a
+}
+
+// Advance moves the shared clock forward, advancing every animation at once.
+func (a *Animator) Advance(dt time.Duration) {
+	a.elapsed += dt
+}
+
+// Reset moves the shared clock back to the start of every animation.
+func (a *Animator) Reset() {
+	a.elapsed = 0
+}
+
+// Elapsed returns the time on the shared clock.
+func (a *Animator) Elapsed() time.Duration {
+	return a.elapsed
+}
+
+// Animated returns whether the tile with the given global id is animated.
+func (a *Animator) Animated(gid uint32) bool {
+	_, ok := a.anims[clearHighBits(gid)]
+	return ok
+}
+
+// Frame returns the local and global id of the frame an animated tile is
+// showing on the shared clock. If the tile isn't animated ok is false.
+func (a *Animator) Frame(gid uint32) (lid, fgid uint32, ok bool) {
+	return a.FrameAt(gid, a.elapsed)
+}
+
+// FrameOffset is like Frame, but shifts the clock of a single instance of the
+// tile so that copies of the same tile don't have to play in lockstep.
+func (a *Animator) FrameOffset(gid uint32, offset time.Duration) (lid, fgid uint32, ok bool) {
+	return a.FrameAt(gid, a.elapsed+offset)
+}
+
+// FrameAt returns the local and global id of the frame an animated tile is
+// showing at the given time.
+func (a *Animator) FrameAt(gid uint32, t time.Duration) (lid, fgid uint32, ok bool) {
+	an, ok := a.anims[clearHighBits(gid)]
+	if !ok {
+		return 0, 0, false
+	}
+	f := an.frames[an.index(t, a.Loop)]
+	return uint32(f.TileId), uint32(an.firstgid + f.TileId), true
+}
+
+// Current returns the global id of the frame every animated tile is showing on
+// the shared clock, keyed by the global id of the animated tile.
+func (a *Animator) Current() map[uint32]uint32 {
+	c := make(map[uint32]uint32, len(a.anims))
+	for gid, an := range a.anims {
+		c[gid] = uint32(an.firstgid + an.frames[an.index(a.elapsed, a.Loop)].TileId)
+	}
+	return c
+}
+
+// index returns the index of the frame showing at the given time.
+func (an *animation) index(t time.Duration, loop bool) int {
+	if an.total <= 0 || t < 0 && !loop {
+		return 0
+	}
+	if loop {
+		t %= an.total
+		if t < 0 {
+			t += an.total
+		}
+	} else if t >= an.total {
+		return len(an.frames) - 1
+	}
+	// the last frame that starts at or before t
+	return sort.Search(len(an.starts), func(i int) bool {
+		return an.starts[i] > t
+	}) - 1
+}
@@ -0,0 +1,76 @@
+package tmx
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnimatorFrames(t *testing.T) {
+	m := tilemap{Tilesets: []tileset{{Firstgid: 10, Tiles: []tile{
+		// the frame without a duration is never shown
+		{Id: 0, Animation: []frame{{1, 100}, {2, 0}, {3, 200}}},
+		// an animation that takes no time at all stays on its first frame
+		{Id: 4, Animation: []frame{{5, 0}, {6, 0}}},
+		{Id: 7},
+	}}}}
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	cases := []struct {
+		gid  uint32
+		loop bool
+		at   time.Duration
+		lid  uint32
+		ok   bool
+	}{
+		{10, true, 0, 1, true},
+		{10, true, ms(99), 1, true},
+		{10, true, ms(100), 3, true},
+		{10, true, ms(299), 3, true},
+		// wrapped around at the total duration of 300ms
+		{10, true, ms(300), 1, true},
+		{10, true, ms(1250), 1, true},
+		{10, true, ms(1450), 3, true},
+		{10, true, -ms(1), 3, true},
+		// without looping the last frame stays and times before the start
+		// show the first
+		{10, false, ms(1000), 3, true},
+		{10, false, -ms(5), 1, true},
+		// flip flags don't matter
+		{10 | horizontalFlag | diagonalFlag, true, ms(150), 3, true},
+		{14, true, ms(50), 5, true},
+		{14, false, ms(50), 5, true},
+		// tiles without an animation, or in no tileset at all
+		{17, true, ms(50), 0, false},
+		{99, true, ms(50), 0, false},
+	}
+	a := m.Animator()
+	for _, c := range cases {
+		a.Loop = c.loop
+		lid, gid, ok := a.FrameAt(c.gid, c.at)
+		if lid != c.lid || ok != c.ok {
+			t.Errorf("gid %#x loop %v at %v: frame %d %v, want %d %v", c.gid, c.loop, c.at, lid, ok, c.lid, c.ok)
+		}
+		if ok && gid != 10+lid {
+			t.Errorf("gid %#x at %v: frame gid %d, want %d", c.gid, c.at, gid, 10+lid)
+		}
+		if a.Animated(c.gid) != c.ok {
+			t.Errorf("gid %#x: Animated = %v", c.gid, !c.ok)
+		}
+	}
+
+	// the shared clock drives Frame, FrameOffset and Current
+	a.Loop = true
+	a.Advance(ms(150))
+	if _, gid, _ := a.Frame(10); gid != 13 {
+		t.Errorf("frame after 150ms is gid %d, want 13", gid)
+	}
+	if _, gid, _ := a.FrameOffset(10, ms(200)); gid != 11 {
+		t.Errorf("frame after 150ms shifted by 200ms is gid %d, want 11", gid)
+	}
+	if c := a.Current(); len(c) != 2 || c[10] != 13 || c[14] != 15 {
+		t.Errorf("current frames %v", c)
+	}
+	a.Reset()
+	if a.Elapsed() != 0 {
+		t.Errorf("elapsed %v after a reset", a.Elapsed())
+	}
+}
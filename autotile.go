@@ -0,0 +1,247 @@
+package tmx
+
+import (
+	"errors"
+	"math/rand"
+)
+
+var (
+	// autotiling errors
+	noWangset   = errors.New("the tileset doesn't have that wang set")
+	noWangTiles = errors.New("the wang set doesn't have any tiles")
+)
+
+// WangColors holds the colors wanted at the edges and corners of the cells of
+// an area. Neighbouring cells share their edges and corners, so setting the
+// right edge of a cell sets the left edge of the cell to its right as well.
+// Zero leaves an edge or corner free to be any color.
+type WangColors struct {
+	Area    CellRect // cells the colors are for
+	corners []int    // (width+1) * (height+1) corners
+	hedges  []int    // width * (height+1) top and bottom edges
+	vedges  []int    // (width+1) * height left and right edges
+}
+
+// NewWangColors returns a grid of colors for an area, with no colors set.
+func NewWangColors(area CellRect) *WangColors {
+	w, h := maxInt(area.Width(), 0), maxInt(area.Height(), 0)
+	return &WangColors{
+		Area:    area,
+		corners: make([]int, (w+1)*(h+1)),
+		hedges:  make([]int, w*(h+1)),
+		vedges:  make([]int, (w+1)*h),
+	}
+}
+
+// slot returns where the color of an edge or corner of a cell is kept, or nil
+// if the cell is outside of the area.
+func (g *WangColors) slot(c Cell, pos int) *int {
+	if !g.Area.Contains(c) {
+		return nil
+	}
+	x, y, w := c.Col-g.Area.Min.Col, c.Row-g.Area.Min.Row, g.Area.Width()
+	switch pos {
+	case WangTop:
+		return &g.hedges[y*w+x]
+	case WangBottom:
+		return &g.hedges[(y+1)*w+x]
+	case WangLeft:
+		return &g.vedges[y*(w+1)+x]
+	case WangRight:
+		return &g.vedges[y*(w+1)+x+1]
+	case WangTopLeft:
+		return &g.corners[y*(w+1)+x]
+	case WangTopRight:
+		return &g.corners[y*(w+1)+x+1]
+	case WangBottomLeft:
+		return &g.corners[(y+1)*(w+1)+x]
+	case WangBottomRight:
+		return &g.corners[(y+1)*(w+1)+x+1]
+	}
+	return nil
+}
+
+// Set sets the color wanted at an edge or corner of a cell. Cells outside of
+// the area are ignored.
+func (g *WangColors) Set(c Cell, pos, color int) {
+	if s := g.slot(c, pos); s != nil {
+		*s = color
+	}
+}
+
+// Fill sets every edge and corner of a cell to a color, the way the terrain
+// brush paints a whole cell.
+func (g *WangColors) Fill(c Cell, color int) {
+	for pos := WangTop; pos <= WangTopLeft; pos++ {
+		g.Set(c, pos, color)
+	}
+}
+
+// At returns the colors wanted at the edges and corners of a cell.
+func (g *WangColors) At(c Cell) (id WangId) {
+	for pos := range id {
+		if s := g.slot(c, pos); s != nil {
+			id[pos] = *s
+		}
+	}
+	return
+}
+
+// wangCandidate is a tile of a wang set, as it is placed.
+type wangCandidate struct {
+	id          WangId
+	gid         uint32  // global id with the flip flags
+	weight      float64 // product of the probabilities of its colors
+	transformed bool    // whether it is flipped or rotated by the autotiler
+}
+
+// flipCombos are the ways a tile can be flipped, in the order the candidates
+// are listed.
+var flipCombos = [][3]bool{
+	{false, false, false}, {true, false, false}, {false, true, false}, {true, true, false},
+	{false, false, true}, {true, false, true}, {false, true, true}, {true, true, true},
+}
+
+// wangCandidates lists the tiles of a wang set, each one flipped the way the
+// wang set lists it, along with the flipped and rotated variants the
+// transformations of the tileset allow.
+func wangCandidates(t *tileset, w *wangset) (cs []wangCandidate) {
+	for _, wt := range w.WangTiles {
+		var listed WangId
+		copy(listed[:], wt.WangId)
+		base := listed.untransform(wt.HFlip, wt.VFlip, wt.DFlip)
+		seen := make(map[WangId]bool)
+		for _, f := range flipCombos {
+			h, v, d := f[0], f[1], f[2]
+			transformed := h != wt.HFlip || v != wt.VFlip || d != wt.DFlip
+			if transformed && !t.Transformations.allows(h, v, d) {
+				continue
+			}
+			c := wangCandidate{
+				id:          base.Transform(h, v, d),
+				gid:         uint32(t.Firstgid+wt.TileId) | flagBits(h, v, d),
+				weight:      1,
+				transformed: transformed,
+			}
+			if transformed && seen[c.id] {
+				// a symmetric tile looks the same some other way up
+				continue
+			}
+			seen[c.id] = true
+			for pos, color := range c.id {
+				if color != 0 && w.uses(pos) {
+					c.weight *= w.probability(color)
+				}
+			}
+			cs = append(cs, c)
+		}
+	}
+	return
+}
+
+// Autotile places the tiles of a wang set on the cells of a tile layer so that
+// their edges and corners have the colors wanted there, the way the terrain
+// brush of Tiled does. Only the edges and corners the wang set uses are
+// matched, and cells without any color wanted are left alone. Tiles are also
+// placed flipped or rotated when the transformations of the tileset allow it.
+//
+// When several tiles match, one is picked at random by the probabilities of
+// their colors, using r so that the result can be repeated by seeding it. A nil
+// r always picks the most likely tile. Cells that no tile matches get the tile
+// that matches the most edges and corners, and are returned.
+func (m *tilemap) Autotile(l *layer, tileset, wangset int, g *WangColors, r *rand.Rand) (misses []Cell, e error) {
+	if tileset < 0 || tileset >= len(m.Tilesets) || wangset < 0 || wangset >= len(m.Tilesets[tileset].Wangsets) {
+		return nil, noWangset
+	}
+	t := &m.Tilesets[tileset]
+	w := &t.Wangsets[wangset]
+	cs := wangCandidates(t, w)
+	if len(cs) == 0 {
+		return nil, noWangTiles
+	}
+	var best []wangCandidate
+	for row := g.Area.Min.Row; row < g.Area.Max.Row; row++ {
+		for col := g.Area.Min.Col; col < g.Area.Max.Col; col++ {
+			c := Cell{col, row}
+			want, free := g.At(c), true
+			for pos, color := range want {
+				if color != 0 && w.uses(pos) {
+					free = false
+				}
+			}
+			if free {
+				continue
+			}
+			// keep the candidates with the fewest mismatches
+			fewest := len(want) + 1
+			best = best[:0]
+			for _, cand := range cs {
+				n := 0
+				for pos, color := range want {
+					if color != 0 && w.uses(pos) && cand.id[pos] != color {
+						n++
+					}
+				}
+				if n < fewest {
+					fewest, best = n, best[:0]
+				}
+				if n == fewest {
+					best = append(best, cand)
+				}
+			}
+			if fewest > 0 {
+				misses = append(misses, c)
+			}
+			if t.Transformations.PreferUntransformed {
+				best = untransformed(best)
+			}
+			if e = m.SetTileAt(l, col, row, pickWangTile(best, r).gid); e != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// untransformed drops the transformed candidates, unless there are only
+// transformed ones.
+func untransformed(cs []wangCandidate) []wangCandidate {
+	n := 0
+	for _, c := range cs {
+		if !c.transformed {
+			cs[n] = c
+			n++
+		}
+	}
+	if n == 0 {
+		return cs
+	}
+	return cs[:n]
+}
+
+// pickWangTile picks one of a set of candidates by their weights, or the one
+// with the largest weight without a random source. Candidates are picked
+// evenly when none of them has any weight.
+func pickWangTile(cs []wangCandidate, r *rand.Rand) wangCandidate {
+	total := 0.0
+	top := 0
+	for i, c := range cs {
+		total += c.weight
+		if c.weight > cs[top].weight {
+			top = i
+		}
+	}
+	switch {
+	case r == nil:
+		return cs[top]
+	case total <= 0:
+		return cs[r.Intn(len(cs))]
+	}
+	x := r.Float64() * total
+	for _, c := range cs {
+		if x -= c.weight; x < 0 {
+			return c
+		}
+	}
+	return cs[len(cs)-1]
+}
@@ -0,0 +1,215 @@
+package tmx
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// autotileMap returns a map with an empty 4x4 tile layer and a corner wang set
+// of grass and sand.
+func autotileMap(t *testing.T, tf transformations) *tilemap {
+	t.Helper()
+	m := &tilemap{Orientation: orthogonal, Width: 4, Height: 4, Tilewidth: 16, Tileheight: 16}
+	m.Tilesets = []tileset{{Firstgid: 1, Name: "terrain", Tilewidth: 16, Tileheight: 16, Tilecount: 8, Columns: 4,
+		Transformations: tf,
+		Wangsets: []wangset{{Name: "ground", Type: wangCorner,
+			Colors: []wangcolor{{Name: "grass", Probability: 1}, {Name: "sand", Probability: 1}},
+			WangTiles: []wangtile{
+				{TileId: 0, WangId: []int{0, 1, 0, 1, 0, 1, 0, 1}},
+				{TileId: 1, WangId: []int{0, 1, 0, 1, 0, 1, 0, 1}},
+				// sand in the top right corner
+				{TileId: 2, WangId: []int{0, 2, 0, 1, 0, 1, 0, 1}},
+				{TileId: 3, WangId: []int{0, 2, 0, 2, 0, 2, 0, 2}},
+				// sand along the bottom
+				{TileId: 4, WangId: []int{0, 1, 0, 2, 0, 2, 0, 1}},
+			},
+		}},
+	}}
+	ts := make([]*Tile, 16)
+	for i := range ts {
+		ts[i] = nilTile
+	}
+	m.Layers = []layer{{Name: "ground", Type: tileLayer, Width: 4, Height: 4, Data: ts}}
+	return m
+}
+
+// placedWangId returns the wang id of the tile in a cell, as it is placed.
+func placedWangId(m *tilemap, c Cell) (WangId, bool) {
+	t := m.Layers[0].TileAt(c.Col, c.Row)
+	if t == nil || t.Nil() {
+		return WangId{}, false
+	}
+	id, ok := m.Tilesets[0].Wangsets[0].TileWangId(int(t.Lid()))
+	return id.Transform(t.horizontialFlip, t.verticalFlip, t.diagonalFlip), ok
+}
+
+// wangMismatches counts the corners of a wang id that differ from the wanted
+// colors.
+func wangMismatches(id, want WangId) (n int) {
+	for pos := WangTopRight; pos < len(want); pos += 2 {
+		if id[pos] != want[pos] {
+			n++
+		}
+	}
+	return
+}
+
+func TestAutotile(t *testing.T) {
+	area := CellRect{Max: Cell{3, 3}}
+	colors := func() *WangColors {
+		g := NewWangColors(area)
+		for row := 0; row < 3; row++ {
+			for col := 0; col < 3; col++ {
+				g.Fill(Cell{col, row}, 1)
+			}
+		}
+		// a patch of sand in the middle shares its corners with every
+		// neighbour
+		g.Fill(Cell{1, 1}, 2)
+		return g
+	}
+
+	// every sand corner and edge is reached by flipping and rotating the
+	// tiles
+	m := autotileMap(t, transformations{HFlip: true, VFlip: true, Rotate: true})
+	g := colors()
+	misses, e := m.Autotile(&m.Layers[0], 0, 0, g, rand.New(rand.NewSource(1)))
+	if e != nil || len(misses) != 0 {
+		t.Fatalf("misses %v, %v", misses, e)
+	}
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			c := Cell{col, row}
+			if id, ok := placedWangId(m, c); !ok || wangMismatches(id, g.At(c)) != 0 {
+				t.Errorf("cell %v has the wang id %v, want the corners of %v", c, id, g.At(c))
+			}
+		}
+	}
+	if id, _ := placedWangId(m, Cell{1, 1}); id != (WangId{0, 2, 0, 2, 0, 2, 0, 2}) {
+		t.Errorf("middle cell has the wang id %v", id)
+	}
+	// cells outside of the area are left alone
+	if tile := m.Layers[0].TileAt(3, 3); !tile.Nil() {
+		t.Errorf("cell outside of the area has tile %d", tile.Lid())
+	}
+
+	// without transformations only the listed corners match
+	m, g = autotileMap(t, transformations{}), colors()
+	misses, e = m.Autotile(&m.Layers[0], 0, 0, g, nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	want := map[Cell]bool{{0, 0}: true, {2, 0}: true, {0, 1}: true, {2, 1}: true, {1, 2}: true, {2, 2}: true}
+	if len(misses) != len(want) {
+		t.Errorf("misses %v, want %d cells", misses, len(want))
+	}
+	for _, c := range misses {
+		if !want[c] {
+			t.Errorf("%v is a miss", c)
+		}
+	}
+	// a miss gets the closest tile, one corner off
+	id, _ := placedWangId(m, Cell{2, 0})
+	if n := wangMismatches(id, g.At(Cell{2, 0})); n != 1 {
+		t.Errorf("top right cell has the wang id %v, %d corners off", id, n)
+	}
+	if id, _ := placedWangId(m, Cell{1, 0}); id != (WangId{0, 1, 0, 2, 0, 2, 0, 1}) {
+		t.Errorf("top cell has the wang id %v, want sand along the bottom", id)
+	}
+}
+
+func TestAutotileRandom(t *testing.T) {
+	grass := func(m *tilemap, r *rand.Rand) (lids []uint32) {
+		g := NewWangColors(CellRect{Max: Cell{4, 4}})
+		for row := 0; row < 4; row++ {
+			for col := 0; col < 4; col++ {
+				g.Fill(Cell{col, row}, 1)
+			}
+		}
+		if _, e := m.Autotile(&m.Layers[0], 0, 0, g, r); e != nil {
+			t.Fatal(e)
+		}
+		ts, _ := m.Layers[0].Tiles()
+		for _, tile := range ts {
+			lids = append(lids, tile.Lid())
+		}
+		return
+	}
+	m := autotileMap(t, transformations{})
+	first := grass(m, rand.New(rand.NewSource(7)))
+	seen := make(map[uint32]bool)
+	for _, lid := range first {
+		seen[lid] = true
+	}
+	if !seen[0] || !seen[1] || len(seen) != 2 {
+		t.Errorf("random grass uses the tiles %v, want both grass tiles", first)
+	}
+	// the same seed places the same tiles
+	again := grass(m, rand.New(rand.NewSource(7)))
+	for i := range first {
+		if first[i] != again[i] {
+			t.Errorf("cell %d is tile %d and then %d with the same seed", i, first[i], again[i])
+		}
+	}
+	// without a random source the first of the equally likely tiles wins
+	for i, lid := range grass(m, nil) {
+		if lid != 0 {
+			t.Errorf("cell %d is tile %d without a random source", i, lid)
+		}
+	}
+}
+
+func TestAutotilePreferUntransformed(t *testing.T) {
+	m := autotileMap(t, transformations{HFlip: true, VFlip: true, Rotate: true, PreferUntransformed: true})
+	ws := &m.Tilesets[0].Wangsets[0]
+	// sand in the bottom right corner, also reached by turning tile 2
+	ws.WangTiles = append(ws.WangTiles, wangtile{TileId: 5, WangId: []int{0, 1, 0, 2, 0, 1, 0, 1}})
+	g := NewWangColors(CellRect{Max: Cell{1, 1}})
+	g.Set(Cell{}, WangTopRight, 1)
+	g.Set(Cell{}, WangBottomRight, 2)
+	g.Set(Cell{}, WangBottomLeft, 1)
+	g.Set(Cell{}, WangTopLeft, 1)
+	for seed := int64(0); seed < 20; seed++ {
+		if _, e := m.Autotile(&m.Layers[0], 0, 0, g, rand.New(rand.NewSource(seed))); e != nil {
+			t.Fatal(e)
+		}
+		tile := m.Layers[0].TileAt(0, 0)
+		if tile.Lid() != 5 || tile.horizontialFlip || tile.verticalFlip || tile.diagonalFlip {
+			t.Fatalf("seed %d placed tile %d flipped %v %v %v, want tile 5 as it is", seed, tile.Lid(),
+				tile.horizontialFlip, tile.verticalFlip, tile.diagonalFlip)
+		}
+	}
+
+	// the turned tile is still used when it is the only match
+	ws.WangTiles = ws.WangTiles[:len(ws.WangTiles)-1]
+	if misses, e := m.Autotile(&m.Layers[0], 0, 0, g, nil); e != nil || len(misses) != 0 {
+		t.Fatalf("misses %v, %v", misses, e)
+	}
+	if tile := m.Layers[0].TileAt(0, 0); tile.Lid() != 2 {
+		t.Errorf("placed tile %d, want the turned tile 2", tile.Lid())
+	}
+}
+
+func TestAutotileErrors(t *testing.T) {
+	m := autotileMap(t, transformations{})
+	g := NewWangColors(CellRect{Max: Cell{1, 1}})
+	cases := []struct {
+		name    string
+		tileset int
+		wangset int
+		e       error
+	}{
+		{"no tileset", 1, 0, noWangset},
+		{"no wang set", 0, 1, noWangset},
+		{"negative", 0, -1, noWangset},
+	}
+	for _, c := range cases {
+		if _, e := m.Autotile(&m.Layers[0], c.tileset, c.wangset, g, nil); e != c.e {
+			t.Errorf("%s: %v, want %v", c.name, e, c.e)
+		}
+	}
+	m.Tilesets[0].Wangsets[0].WangTiles = nil
+	if _, e := m.Autotile(&m.Layers[0], 0, 0, g, nil); e != noWangTiles {
+		t.Errorf("empty wang set: %v", e)
+	}
+}
@@ -0,0 +1,131 @@
+// Command tmxconvert converts Tiled maps between the json and xml formats,
+// re-encoding the tile data and moving tilesets in or out of the map on the
+// way. Template objects are written as plain objects.
+//
+// Usage:
+//
+//	tmxconvert [-encoding csv|base64] [-compression none|gzip|zlib]
+//		[-tilesets keep|embed|external] [-format json|tmx] in out
+//
+// The format of the output is taken from its extension unless -format is
+// given. External tilesets are written next to the output map.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/drakbar/tmx"
+)
+
+func main() {
+	encoding := flag.String("encoding", "", "tile data encoding, csv or base64 (default: keep each layer's)")
+	compression := flag.String("compression", "none", "base64 compression, none, gzip or zlib")
+	tilesets := flag.String("tilesets", "keep", "tilesets keep, embed, or external")
+	format := flag.String("format", "", "output format, json or tmx (default: from the output extension)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: tmxconvert [flags] in out")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	in, out := flag.Arg(0), flag.Arg(1)
+
+	o, e := options(out, *encoding, *compression, *tilesets, *format)
+	if e != nil {
+		fmt.Fprintln(os.Stderr, "tmxconvert:", e)
+		os.Exit(2)
+	}
+	if e = convert(in, out, o); e != nil {
+		fmt.Fprintln(os.Stderr, "tmxconvert:", e)
+		os.Exit(1)
+	}
+}
+
+// options checks the flags and turns them into write options.
+func options(out, encoding, compression, tilesets, format string) (o tmx.WriteOptions, e error) {
+	switch format {
+	case "":
+		o.Format = tmx.FormatOf(out)
+	case "json":
+		o.Format = tmx.FormatJSON
+	case "tmx":
+		o.Format = tmx.FormatTMX
+	default:
+		return o, fmt.Errorf("unknown format %q", format)
+	}
+	switch encoding {
+	case "", "csv", "base64":
+		o.Encoding = encoding
+	default:
+		return o, fmt.Errorf("unknown encoding %q", encoding)
+	}
+	switch compression {
+	case "none", "":
+	case "zstd":
+		// turned down here rather than once the map is half written
+		return o, fmt.Errorf("zstd compression can't be written, use gzip or zlib")
+	case "gzip", "zlib":
+		if encoding != "base64" {
+			return o, fmt.Errorf("compression %s needs -encoding base64", compression)
+		}
+		o.Compression = compression
+	default:
+		return o, fmt.Errorf("unknown compression %q", compression)
+	}
+	switch tilesets {
+	case "keep":
+		o.Tilesets = tmx.KeepTilesets
+	case "embed":
+		o.Tilesets = tmx.EmbedTilesets
+	case "external":
+		o.Tilesets = tmx.ExternalTilesets
+	default:
+		return o, fmt.Errorf("unknown tileset mode %q", tilesets)
+	}
+	if o.Dir, e = filepath.Abs(filepath.Dir(out)); e != nil {
+		return o, e
+	}
+	return o, nil
+}
+
+// convert loads a map and writes it out with the options, along with its
+// tilesets when they are external.
+func convert(in, out string, o tmx.WriteOptions) error {
+	m, e := tmx.LoadTileMap(in)
+	if e != nil {
+		return fmt.Errorf("%s: %v", in, e)
+	}
+	if o.Tilesets == tmx.ExternalTilesets {
+		for i := range m.Tilesets {
+			fp := filepath.Join(o.Dir, m.TilesetFile(i, o.Format))
+			if e = create(fp, func(f *os.File) error { return m.WriteTileset(f, i, o) }); e != nil {
+				return e
+			}
+		}
+	}
+	return create(out, func(f *os.File) error { return m.Write(f, o) })
+}
+
+// create writes a file, removing it again if writing fails.
+func create(fp string, write func(f *os.File) error) error {
+	f, e := os.Create(fp)
+	if e != nil {
+		return e
+	}
+	if e = write(f); e == nil {
+		e = f.Close()
+	} else {
+		f.Close()
+	}
+	if e != nil {
+		os.Remove(fp)
+		return fmt.Errorf("%s: %v", fp, e)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Command tmxdiff compares two versions of a Tiled map and reports what
+// changed: the tiles of every layer, objects that were added, removed, moved,
+// or modified, and the attributes of layers, tilesets, and the map itself. It
+// exits with status 1 when the maps differ, like diff.
+//
+// Usage:
+//
+//	tmxdiff [-json] [-png overlay.png] [-scale n] old new
+//
+// With -png the new map is rendered with the changes highlighted on top:
+// changed tiles in red, added objects in green, removed ones in red, and
+// moved or modified ones in yellow.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+
+	"github.com/drakbar/tmx"
+)
+
+var (
+	// colors of the highlights in the overlay
+	changedColor  = color.RGBA{200, 0, 0, 120}
+	addedColor    = color.RGBA{0, 200, 0, 120}
+	modifiedColor = color.RGBA{200, 200, 0, 120}
+)
+
+func main() {
+	asJSON := flag.Bool("json", false, "print the differences as json")
+	overlay := flag.String("png", "", "write the new map with the changes highlighted to a png file")
+	scale := flag.Float64("scale", 1, "image pixels per map pixel for -png")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: tmxdiff [-json] [-png overlay.png] [-scale n] old new")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 || *scale <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	a, e := tmx.LoadTileMap(flag.Arg(0))
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "tmxdiff: %s: %v\n", flag.Arg(0), e)
+		os.Exit(2)
+	}
+	b, e := tmx.LoadTileMap(flag.Arg(1))
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "tmxdiff: %s: %v\n", flag.Arg(1), e)
+		os.Exit(2)
+	}
+	d, e := tmx.Diff(&a, &b)
+	if e != nil {
+		fmt.Fprintln(os.Stderr, "tmxdiff:", e)
+		os.Exit(2)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(d)
+	} else {
+		printDiff(os.Stdout, d)
+	}
+	if *overlay != "" {
+		size := tmx.Vec{X: float64(b.Tilewidth), Y: float64(b.Tileheight)}
+		if e = writeOverlay(&b, size, d, *scale, *overlay); e != nil {
+			fmt.Fprintln(os.Stderr, "tmxdiff:", e)
+			os.Exit(2)
+		}
+	}
+	if !d.Empty() {
+		os.Exit(1)
+	}
+}
+
+// printDiff writes the differences as text.
+func printDiff(w io.Writer, d tmx.MapDiff) {
+	if len(d.Map) > 0 {
+		fmt.Fprintln(w, "map")
+		for _, f := range d.Map {
+			fmt.Fprintf(w, "  %s\n", f)
+		}
+	}
+	for _, t := range d.Tilesets {
+		fmt.Fprintf(w, "tileset %q %s\n", t.Name, t.Kind)
+		for _, f := range t.Fields {
+			fmt.Fprintf(w, "  %s\n", f)
+		}
+	}
+	for _, l := range d.Layers {
+		fmt.Fprintf(w, "layer %d %q %s\n", l.Id, l.Name, l.Kind)
+		for _, f := range l.Fields {
+			fmt.Fprintf(w, "  %s\n", f)
+		}
+		for _, t := range l.Tiles {
+			fmt.Fprintf(w, "  tile %d,%d: %d -> %d\n", t.Col, t.Row, t.Old, t.New)
+		}
+		for _, o := range l.Objects {
+			fmt.Fprintf(w, "  object %d %q %s\n", o.Id, o.Name, o.Kind)
+			for _, f := range o.Fields {
+				fmt.Fprintf(w, "    %s\n", f)
+			}
+		}
+	}
+}
+
+// writeOverlay renders the new map and highlights the changes on top of it,
+// size is the size of a tile cell.
+func writeOverlay(m interface {
+	Render(tmx.RenderOptions) (*image.RGBA, error)
+	PixelBounds() (tmx.Rect, error)
+	TileToPixel(col, row int) tmx.Vec
+}, size tmx.Vec, d tmx.MapDiff, scale float64, fp string) error {
+	bounds, e := m.PixelBounds()
+	if e != nil {
+		return e
+	}
+	img, e := m.Render(tmx.RenderOptions{Crop: bounds, Scale: scale})
+	if e != nil {
+		return e
+	}
+	// rectangles in map pixel space are moved into image space
+	fill := func(r tmx.Rect, c color.RGBA) {
+		area := image.Rect(
+			int(math.Floor((r.Min.X-bounds.Min.X)*scale)), int(math.Floor((r.Min.Y-bounds.Min.Y)*scale)),
+			int(math.Ceil((r.Max.X-bounds.Min.X)*scale)), int(math.Ceil((r.Max.Y-bounds.Min.Y)*scale)),
+		).Intersect(img.Rect)
+		for y := area.Min.Y; y < area.Max.Y; y++ {
+			for x := area.Min.X; x < area.Max.X; x++ {
+				img.SetRGBA(x, y, over(img.RGBAAt(x, y), c))
+			}
+		}
+	}
+	for _, l := range d.Layers {
+		for _, t := range l.Tiles {
+			p := m.TileToPixel(t.Col, t.Row)
+			fill(tmx.Rect{Min: p, Max: p.Add(size)}, changedColor)
+		}
+		for _, o := range l.Objects {
+			c := modifiedColor
+			switch o.Kind {
+			case tmx.Added:
+				c = addedColor
+			case tmx.Removed:
+				c = changedColor
+			}
+			r := o.Bounds
+			if r.Empty() {
+				// points and lines still get a mark
+				r = tmx.Rect{Min: r.Min.Sub(tmx.Vec{X: 2, Y: 2}), Max: r.Max.Add(tmx.Vec{X: 2, Y: 2})}
+			}
+			fill(r, c)
+		}
+	}
+	f, e := os.Create(fp)
+	if e != nil {
+		return e
+	}
+	if e = png.Encode(f, img); e != nil {
+		f.Close()
+		return e
+	}
+	return f.Close()
+}
+
+// over blends a translucent color over a premultiplied pixel.
+func over(dst, src color.RGBA) color.RGBA {
+	a := float64(src.A) / 255
+	mix := func(s, d uint8) uint8 {
+		return uint8(float64(s)*a + float64(d)*(1-a) + 0.5)
+	}
+	return color.RGBA{mix(src.R, dst.R), mix(src.G, dst.G), mix(src.B, dst.B), mix(255, dst.A)}
+}
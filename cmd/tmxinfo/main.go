@@ -0,0 +1,320 @@
+// Command tmxinfo prints a summary of Tiled maps: the orientation and size,
+// the tilesets with their gid ranges and how often their tiles are used, the
+// layer tree, object counts by type, and the custom properties.
+//
+// Usage:
+//
+//	tmxinfo [-json] map...
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/drakbar/tmx"
+)
+
+// info is the summary of a map.
+type info struct {
+	File        string         `json:"file"`
+	Orientation string         `json:"orientation"`
+	RenderOrder string         `json:"renderorder,omitempty"`
+	Width       int            `json:"width"`
+	Height      int            `json:"height"`
+	TileWidth   int            `json:"tilewidth"`
+	TileHeight  int            `json:"tileheight"`
+	Infinite    bool           `json:"infinite"`
+	Used        *tmx.CellRect  `json:"used,omitempty"`
+	Tilesets    []tilesetInfo  `json:"tilesets"`
+	Layers      []layerInfo    `json:"layers"`
+	Objects     map[string]int `json:"objects"`
+	Properties  []propertyInfo `json:"properties,omitempty"`
+}
+
+// tilesetInfo is the summary of a tileset.
+type tilesetInfo struct {
+	Name       string         `json:"name"`
+	Source     string         `json:"source,omitempty"`
+	FirstGid   uint32         `json:"firstgid"`
+	LastGid    uint32         `json:"lastgid"`
+	Tiles      int            `json:"tiles"`
+	Placed     int            `json:"placed"`
+	Distinct   int            `json:"distinct"`
+	Properties []propertyInfo `json:"properties,omitempty"`
+}
+
+// layerInfo is the summary of a layer and the layers inside of it.
+type layerInfo struct {
+	Id         int            `json:"id"`
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Visible    bool           `json:"visible"`
+	Width      int            `json:"width,omitempty"`
+	Height     int            `json:"height,omitempty"`
+	Tiles      int            `json:"tiles,omitempty"`
+	Objects    int            `json:"objects,omitempty"`
+	Properties []propertyInfo `json:"properties,omitempty"`
+	Layers     []layerInfo    `json:"layers,omitempty"`
+}
+
+// propertyInfo is a custom property.
+type propertyInfo struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// usage counts how often the tiles of a tileset are placed.
+type usage struct {
+	placed   int
+	distinct map[uint32]bool
+}
+
+func main() {
+	asJSON := flag.Bool("json", false, "print the summary as json")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: tmxinfo [-json] map...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var infos []info
+	failed := false
+	for _, fp := range flag.Args() {
+		i, e := summarize(fp)
+		if e != nil {
+			fmt.Fprintf(os.Stderr, "tmxinfo: %s: %v\n", fp, e)
+			failed = true
+			continue
+		}
+		infos = append(infos, i)
+	}
+	if *asJSON {
+		if infos == nil {
+			infos = []info{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(infos)
+	} else {
+		for n, i := range infos {
+			if n > 0 {
+				fmt.Println()
+			}
+			printInfo(os.Stdout, i)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// summarize loads a map and builds its summary.
+func summarize(fp string) (i info, e error) {
+	m, e := tmx.LoadTileMap(fp)
+	if e != nil {
+		return
+	}
+	i = info{
+		File:        fp,
+		Orientation: m.Orientation,
+		RenderOrder: m.Renderorder,
+		Width:       m.Width,
+		Height:      m.Height,
+		TileWidth:   m.Tilewidth,
+		TileHeight:  m.Tileheight,
+		Infinite:    m.Infinite,
+		Objects:     make(map[string]int),
+		Properties:  properties(m.Properties),
+	}
+	if m.Infinite {
+		r, e := m.UsedBounds()
+		if e != nil {
+			return i, e
+		}
+		i.Used = &r
+	}
+
+	uses := make([]usage, len(m.Tilesets))
+	for j := range uses {
+		uses[j].distinct = make(map[uint32]bool)
+	}
+	// tilesets are told apart by their first gid
+	byFirstgid := make(map[int]int, len(m.Tilesets))
+	for j := range m.Tilesets {
+		byFirstgid[m.Tilesets[j].Firstgid] = j
+	}
+	count := func(firstgid int, lid uint32) {
+		if j, ok := byFirstgid[firstgid]; ok {
+			uses[j].placed++
+			uses[j].distinct[lid] = true
+		}
+	}
+	// rebuild the layer tree, keeping the children of every open group
+	open := []*[]layerInfo{&i.Layers}
+	for _, n := range m.AllLayers() {
+		l := n.Layer
+		li := layerInfo{
+			Id:         l.Id,
+			Name:       l.Name,
+			Type:       l.Type,
+			Visible:    l.Visible,
+			Properties: properties(l.Properties),
+		}
+		switch l.Type {
+		case "tilelayer":
+			li.Width, li.Height = l.Width, l.Height
+			ts, e := l.Tiles()
+			if e != nil {
+				return i, e
+			}
+			for j := range l.Chunks {
+				ts = append(ts, l.Chunks[j].Tiles()...)
+			}
+			for _, t := range ts {
+				if !t.Nil() {
+					li.Tiles++
+					count(t.TilesetInfo().Firstgid, t.Lid())
+				}
+			}
+		case "objectgroup":
+			li.Objects = len(l.Objects)
+			for j := range l.Objects {
+				o := &l.Objects[j]
+				if o.Gid != 0 {
+					if ts, lid, e := m.TilesetForGid(uint32(o.Gid)); e == nil {
+						count(ts.Firstgid, lid)
+					}
+				}
+				i.Objects[objectType(o.Type, o.Class)]++
+			}
+		}
+		open = open[:n.Depth+1]
+		children := open[n.Depth]
+		*children = append(*children, li)
+		if l.Type == "group" {
+			open = append(open, &(*children)[len(*children)-1].Layers)
+		}
+	}
+
+	for j := range m.Tilesets {
+		ts := &m.Tilesets[j]
+		first, last, _ := m.GidRange(j)
+		i.Tilesets = append(i.Tilesets, tilesetInfo{
+			Name:       ts.Name,
+			Source:     ts.Source,
+			FirstGid:   first,
+			LastGid:    last,
+			Tiles:      ts.Tilecount,
+			Placed:     uses[j].placed,
+			Distinct:   len(uses[j].distinct),
+			Properties: properties(ts.Properties),
+		})
+	}
+	return i, nil
+}
+
+// objectType returns the type objects are counted under, the class for maps
+// saved with Tiled 1.9 or later.
+func objectType(typ, class string) string {
+	if typ == "" {
+		typ = class
+	}
+	if typ == "" {
+		return "(none)"
+	}
+	return typ
+}
+
+// properties converts a list of custom properties. The properties of the
+// library only come out through their json form.
+func properties(ps interface{}) (out []propertyInfo) {
+	b, e := json.Marshal(ps)
+	if e == nil {
+		json.Unmarshal(b, &out)
+	}
+	return
+}
+
+// printInfo writes the summary of a map as text.
+func printInfo(w io.Writer, i info) {
+	fmt.Fprintln(w, i.File)
+	size := fmt.Sprintf("%dx%d tiles", i.Width, i.Height)
+	if i.Infinite {
+		size = "infinite"
+		if i.Used != nil && !i.Used.Empty() {
+			size += fmt.Sprintf(", %dx%d tiles used from %d,%d", i.Used.Width(), i.Used.Height(), i.Used.Min.Col, i.Used.Min.Row)
+		}
+	}
+	fmt.Fprintf(w, "  %s %s, %s of %dx%d px\n", i.Orientation, i.RenderOrder, size, i.TileWidth, i.TileHeight)
+	printProperties(w, "  ", i.Properties)
+
+	fmt.Fprintln(w, "tilesets")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, t := range i.Tilesets {
+		src := "embedded"
+		if t.Source != "" {
+			src = t.Source
+		}
+		fmt.Fprintf(tw, "  %s\tgids %d-%d\t%d tiles\tplaced %d, %d distinct\t%s\n", t.Name, t.FirstGid, t.LastGid, t.Tiles, t.Placed, t.Distinct, src)
+	}
+	tw.Flush()
+	for _, t := range i.Tilesets {
+		if len(t.Properties) > 0 {
+			fmt.Fprintf(w, "  %s properties\n", t.Name)
+			printProperties(w, "    ", t.Properties)
+		}
+	}
+
+	fmt.Fprintln(w, "layers")
+	printLayers(w, "  ", i.Layers)
+
+	fmt.Fprintln(w, "objects")
+	types := make([]string, 0, len(i.Objects))
+	for t := range i.Objects {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, t := range types {
+		fmt.Fprintf(tw, "  %s\t%d\n", t, i.Objects[t])
+	}
+	tw.Flush()
+}
+
+// printLayers writes a layer tree, indenting the layers inside of groups.
+func printLayers(w io.Writer, indent string, ls []layerInfo) {
+	for _, l := range ls {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s%s %q (id %d)", indent, l.Type, l.Name, l.Id)
+		if !l.Visible {
+			b.WriteString(" hidden")
+		}
+		switch l.Type {
+		case "tilelayer":
+			fmt.Fprintf(&b, ", %dx%d, %d tiles", l.Width, l.Height, l.Tiles)
+		case "objectgroup":
+			fmt.Fprintf(&b, ", %d objects", l.Objects)
+		}
+		fmt.Fprintln(w, b.String())
+		printProperties(w, indent+"  ", l.Properties)
+		printLayers(w, indent+"  ", l.Layers)
+	}
+}
+
+// printProperties writes a list of custom properties.
+func printProperties(w io.Writer, indent string, ps []propertyInfo) {
+	for _, p := range ps {
+		fmt.Fprintf(w, "%s%s (%s) = %v\n", indent, p.Name, p.Type, p.Value)
+	}
+}
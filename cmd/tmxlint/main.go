@@ -0,0 +1,225 @@
+// Command tmxlint loads Tiled maps and reports every problem it finds in
+// them. It exits with a non-zero status when any errors are found.
+//
+// Usage:
+//
+//	tmxlint [-json] [-werror] path...
+//
+// Each path is a map file, a glob, a directory that is searched for maps and
+// world files, or a Tiled world file whose maps are checked.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/drakbar/tmx"
+)
+
+// result is a finding in a particular file.
+type result struct {
+	File string `json:"file"`
+	tmx.Finding
+}
+
+// world is the part of a Tiled world file needed to find its maps.
+type world struct {
+	Type string `json:"type"`
+	Maps []struct {
+		FileName string `json:"fileName"`
+	} `json:"maps"`
+	Patterns []struct {
+		Regexp string `json:"regexp"`
+	} `json:"patterns"`
+}
+
+func main() {
+	asJSON := flag.Bool("json", false, "print the findings as json")
+	werror := flag.Bool("werror", false, "treat warnings as errors")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: tmxlint [-json] [-werror] path...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	files, e := expand(flag.Args())
+	if e != nil {
+		fmt.Fprintln(os.Stderr, "tmxlint:", e)
+		os.Exit(2)
+	}
+
+	var results []result
+	for _, f := range files {
+		results = append(results, lint(f)...)
+	}
+
+	failed := false
+	for _, r := range results {
+		if r.Severity == tmx.SeverityError || *werror {
+			failed = true
+		}
+	}
+	if *asJSON {
+		if results == nil {
+			results = []result{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(results)
+	} else {
+		for _, r := range results {
+			fmt.Printf("%s:%s\n", r.File, r.Finding)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// lint loads a map and validates it. The load keeps going past broken
+// tilesets, templates and tile data so they are reported where they are, only
+// a map that can't be read at all is reported as a whole.
+func lint(fp string) []result {
+	m, e := tmx.LoadTileMap(fp, tmx.Tolerant())
+	if e != nil {
+		return []result{{File: fp, Finding: tmx.Finding{
+			Severity: tmx.SeverityError,
+			Check:    "load",
+			Message:  e.Error(),
+		}}}
+	}
+	var rs []result
+	for _, f := range tmx.Validate(&m) {
+		rs = append(rs, result{File: fp, Finding: f})
+	}
+	return rs
+}
+
+// expand turns the arguments into a sorted list of map files without
+// duplicates.
+func expand(args []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	add := func(fp string) {
+		fp = filepath.Clean(fp)
+		if !seen[fp] {
+			seen[fp] = true
+			files = append(files, fp)
+		}
+	}
+	for _, a := range args {
+		matches, e := filepath.Glob(a)
+		if e != nil {
+			return nil, e
+		}
+		if matches == nil {
+			// let the load report the missing file
+			matches = []string{a}
+		}
+		for _, fp := range matches {
+			fs, e := expandPath(fp)
+			if e != nil {
+				return nil, e
+			}
+			for _, f := range fs {
+				add(f)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// expandPath returns the maps behind a single path.
+func expandPath(fp string) ([]string, error) {
+	info, e := os.Stat(fp)
+	if e != nil || !info.IsDir() {
+		if strings.HasSuffix(fp, ".world") {
+			return worldMaps(fp)
+		}
+		return []string{fp}, nil
+	}
+	var files []string
+	e = filepath.Walk(fp, func(p string, info os.FileInfo, e error) error {
+		if e != nil || info.IsDir() {
+			return e
+		}
+		switch filepath.Ext(p) {
+		case ".world":
+			ms, e := worldMaps(p)
+			if e != nil {
+				return e
+			}
+			files = append(files, ms...)
+		case ".json":
+			if isMap(p) {
+				files = append(files, p)
+			}
+		case ".tmx":
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, e
+}
+
+// isMap returns whether a json file is a Tiled map rather than a tileset,
+// template, or something else.
+func isMap(fp string) bool {
+	b, e := ioutil.ReadFile(fp)
+	if e != nil {
+		return false
+	}
+	var head struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(b, &head) == nil && head.Type == "map"
+}
+
+// worldMaps returns the maps of a world file, both the listed ones and the
+// ones matched by its patterns.
+func worldMaps(fp string) ([]string, error) {
+	b, e := ioutil.ReadFile(fp)
+	if e != nil {
+		return nil, e
+	}
+	var w world
+	if e = json.Unmarshal(b, &w); e != nil {
+		return nil, fmt.Errorf("%s: %v", fp, e)
+	}
+	dir := filepath.Dir(fp)
+	var files []string
+	for _, m := range w.Maps {
+		files = append(files, filepath.Join(dir, filepath.FromSlash(m.FileName)))
+	}
+	if len(w.Patterns) == 0 {
+		return files, nil
+	}
+	entries, e := ioutil.ReadDir(dir)
+	if e != nil {
+		return nil, e
+	}
+	for _, p := range w.Patterns {
+		re, e := regexp.Compile(p.Regexp)
+		if e != nil {
+			return nil, fmt.Errorf("%s: %v", fp, e)
+		}
+		for _, en := range entries {
+			if !en.IsDir() && re.MatchString(en.Name()) {
+				files = append(files, filepath.Join(dir, en.Name()))
+			}
+		}
+	}
+	return files, nil
+}
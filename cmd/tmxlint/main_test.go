@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/drakbar/tmx"
+)
+
+func TestExpand(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.json":     `{"type": "map"}`,
+		"b.tmx":      `<map/>`,
+		"tiles.json": `{"type": "tileset"}`,
+		"notes.txt":  `not a map`,
+		// the world lists a map in a subdirectory and matches one next to it
+		"levels.world": `{"type": "world", "maps": [{"fileName": "sub/c.json"}], "patterns": [{"regexp": "^a\\.json$"}]}`,
+		"sub/c.json":   `{"type": "map"}`,
+	}
+	for name, body := range files {
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		if e := os.MkdirAll(filepath.Dir(fp), 0755); e != nil {
+			t.Fatal(e)
+		}
+		if e := ioutil.WriteFile(fp, []byte(body), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	in := func(names ...string) []string {
+		for i, n := range names {
+			names[i] = filepath.Join(dir, filepath.FromSlash(n))
+		}
+		return names
+	}
+	cases := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		// maps reached both through the world and the directory show up once
+		{"directory", in("."), in("a.json", "b.tmx", "sub/c.json")},
+		{"world", in("levels.world"), in("a.json", "sub/c.json")},
+		{"glob", in("*.json"), in("a.json", "tiles.json")},
+		{"overlapping", in("sub", "sub/c.json", "a.json"), in("a.json", "sub/c.json")},
+		// a missing file is left for the load to report
+		{"missing", in("gone.json"), in("gone.json")},
+	}
+	for _, c := range cases {
+		got, e := expand(c.args)
+		if e != nil {
+			t.Errorf("%s: %v", c.name, e)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.world")
+	if e := ioutil.WriteFile(bad, []byte(`{"type": "world", "patterns": [{"regexp": "("}]}`), 0644); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := expand([]string{filepath.Dir(bad)}); e == nil {
+		t.Errorf("bad world pattern: no error")
+	}
+}
+
+func TestLint(t *testing.T) {
+	rs := lint(filepath.Join("..", "..", "testdata", "base.json"))
+	for _, r := range rs {
+		if r.Severity == tmx.SeverityError {
+			t.Errorf("base.json: %s", r.Finding)
+		}
+	}
+	fp := filepath.Join(t.TempDir(), "gone.json")
+	rs = lint(fp)
+	if len(rs) != 1 || rs[0].File != fp || rs[0].Check != "load" || rs[0].Severity != tmx.SeverityError {
+		t.Errorf("missing map: %v", rs)
+	}
+}
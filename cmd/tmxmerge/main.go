@@ -0,0 +1,141 @@
+// Command tmxmerge merges the changes two branches made to a Tiled map. Tiles
+// are merged cell by cell and objects by id, so it only reports conflicts
+// where both sides changed the same cell or the same field of an object,
+// layer, or the map. Conflicts keep our side and make it exit with status 1.
+//
+// Usage:
+//
+//	tmxmerge [-o out] [-path name] base ours theirs
+//
+// Without -o the merged map replaces ours, which is what git expects of a
+// merge driver. To use it as one, add to .gitattributes:
+//
+//	*.tmx merge=tmx
+//
+// and to the git config:
+//
+//	[merge "tmx"]
+//		name = Tiled map merge
+//		driver = tmxmerge -path %P %O %A %B
+//
+// Git hands the driver temporary files, -path gives the name of the map in
+// the work tree so its format is known and the tilesets and templates it
+// refers to can be found.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/drakbar/tmx"
+)
+
+func main() {
+	out := flag.String("o", "", "write the merged map to a file (default: replace ours)")
+	name := flag.String("path", "", "path of the map in the work tree, for maps given as temporary files")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: tmxmerge [-o out] [-path name] base ours theirs")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *out == "" {
+		*out = flag.Arg(1)
+	}
+	if *name == "" {
+		*name = *out
+	}
+
+	conflicts, e := merge(flag.Arg(0), flag.Arg(1), flag.Arg(2), *out, *name)
+	if e != nil {
+		fmt.Fprintln(os.Stderr, "tmxmerge:", e)
+		os.Exit(2)
+	}
+	for _, c := range conflicts {
+		fmt.Fprintf(os.Stderr, "%s: conflict: %s\n", *name, c)
+	}
+	if len(conflicts) > 0 {
+		os.Exit(1)
+	}
+}
+
+// merge merges three versions of a map and writes the result to out in the
+// format of name.
+func merge(base, ours, theirs, out, name string) ([]tmx.Conflict, error) {
+	var paths [3]string
+	for i, fp := range []string{base, ours, theirs} {
+		p, e := stage(fp, name)
+		if e != nil {
+			return nil, e
+		}
+		if p != fp {
+			defer os.Remove(p)
+		}
+		paths[i] = p
+	}
+	b, e := tmx.LoadTileMap(paths[0])
+	if e != nil {
+		return nil, fmt.Errorf("%s: %v", base, e)
+	}
+	o, e := tmx.LoadTileMap(paths[1])
+	if e != nil {
+		return nil, fmt.Errorf("%s: %v", ours, e)
+	}
+	t, e := tmx.LoadTileMap(paths[2])
+	if e != nil {
+		return nil, fmt.Errorf("%s: %v", theirs, e)
+	}
+	m, cs, e := tmx.Merge(&b, &o, &t)
+	if e != nil {
+		return nil, e
+	}
+
+	opts := tmx.WriteOptions{Format: tmx.FormatOf(name)}
+	if opts.Dir, e = filepath.Abs(filepath.Dir(name)); e != nil {
+		return nil, e
+	}
+	// the map is written in full before out is touched, since out is usually
+	// one of the inputs
+	var buf bytes.Buffer
+	if e = m.Write(&buf, opts); e != nil {
+		return nil, e
+	}
+	if e = ioutil.WriteFile(out, buf.Bytes(), 0644); e != nil {
+		return nil, e
+	}
+	return cs, nil
+}
+
+// stage returns the path to load a version of the map from. Files that aren't
+// named like the map, such as the temporary files git hands to merge drivers,
+// are copied next to it first so they load in the right format and their
+// relative paths resolve. The copies are for the caller to remove.
+func stage(fp, name string) (string, error) {
+	if filepath.Dir(fp) == filepath.Dir(name) && filepath.Ext(fp) == filepath.Ext(name) {
+		return fp, nil
+	}
+	b, e := ioutil.ReadFile(fp)
+	if e != nil {
+		return "", e
+	}
+	f, e := ioutil.TempFile(filepath.Dir(name), ".tmxmerge-*"+filepath.Ext(name))
+	if e != nil {
+		return "", e
+	}
+	_, e = f.Write(b)
+	if ce := f.Close(); e == nil {
+		e = ce
+	}
+	if e != nil {
+		os.Remove(f.Name())
+		return "", e
+	}
+	return f.Name(), nil
+}
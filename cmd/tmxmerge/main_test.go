@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drakbar/tmx"
+)
+
+func TestMergeDriver(t *testing.T) {
+	// the map lives in the work tree, git hands over the versions as
+	// temporary files without an extension somewhere else
+	tree, tmp := t.TempDir(), t.TempDir()
+	name := filepath.Join(tree, "level.json")
+	for _, f := range []string{"base.json", "ground.png"} {
+		b, e := ioutil.ReadFile(filepath.Join("..", "..", "testdata", f))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if f == "base.json" {
+			f = "level.json"
+		}
+		if e = ioutil.WriteFile(filepath.Join(tree, f), b, 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	version := func(file string, col, row int, gid uint32) string {
+		m, e := tmx.LoadTileMap(name)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if gid != 0 {
+			if e = m.SetTileAt(&m.Layers[0], col, row, gid); e != nil {
+				t.Fatal(e)
+			}
+		}
+		fp := filepath.Join(tmp, file)
+		f, e := os.Create(fp)
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer f.Close()
+		if e = m.Write(f, tmx.WriteOptions{Format: tmx.FormatJSON, Dir: tree}); e != nil {
+			t.Fatal(e)
+		}
+		return fp
+	}
+	base := version(".merge_file_O", 0, 0, 0)
+	cases := []struct {
+		name      string
+		ours      [3]int // column, row and gid set by each side
+		theirs    [3]int
+		conflicts int
+		want      [2]uint32 // merged gids at the cells of ours and theirs
+	}{
+		{"different cells", [3]int{0, 0, 4}, [3]int{3, 2, 1}, 0, [2]uint32{4, 1}},
+		{"same cell", [3]int{3, 2, 2}, [3]int{3, 2, 1}, 1, [2]uint32{2, 2}},
+	}
+	for _, c := range cases {
+		ours := version(".merge_file_A", c.ours[0], c.ours[1], uint32(c.ours[2]))
+		theirs := version(".merge_file_B", c.theirs[0], c.theirs[1], uint32(c.theirs[2]))
+		cs, e := merge(base, ours, theirs, ours, name)
+		if e != nil {
+			t.Fatalf("%s: %v", c.name, e)
+		}
+		if len(cs) != c.conflicts {
+			t.Errorf("%s: got conflicts %v, want %d", c.name, cs, c.conflicts)
+		}
+
+		// the merged map replaced ours, load it from the work tree
+		b, e := ioutil.ReadFile(ours)
+		if e != nil {
+			t.Fatal(e)
+		}
+		merged := filepath.Join(tree, "merged.json")
+		if e = ioutil.WriteFile(merged, b, 0644); e != nil {
+			t.Fatal(e)
+		}
+		m, e := tmx.LoadTileMap(merged)
+		if e != nil {
+			t.Fatalf("%s: %v", c.name, e)
+		}
+		l := &m.Layers[0]
+		got := [2]uint32{l.TileAt(c.ours[0], c.ours[1]).Gid(), l.TileAt(c.theirs[0], c.theirs[1]).Gid()}
+		if got != c.want {
+			t.Errorf("%s: merged gids %v, want %v", c.name, got, c.want)
+		}
+		os.Remove(merged)
+
+		// the staged copies are cleaned up
+		left, _ := filepath.Glob(filepath.Join(tree, ".tmxmerge-*"))
+		if len(left) > 0 {
+			t.Errorf("%s: staged copies left behind: %v", c.name, left)
+		}
+	}
+}
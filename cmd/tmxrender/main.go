@@ -0,0 +1,140 @@
+// Command tmxrender renders Tiled maps to PNG images, either the whole map or
+// a set of layers, optionally cropped and scaled, with object outlines and
+// names drawn on top. It only uses the standard library so it runs anywhere.
+//
+// Usage:
+//
+//	tmxrender [-layers a,b] [-each] [-crop x,y,w,h] [-scale n]
+//		[-outlines] [-names] map out.png
+//
+// With -each every layer is written to an image of its own, named after the
+// output file with the id and name of the layer added.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/drakbar/tmx"
+)
+
+func main() {
+	layers := flag.String("layers", "", "comma separated names of the layers to draw (default: every visible layer)")
+	each := flag.Bool("each", false, "write every layer to an image of its own")
+	crop := flag.String("crop", "", "area of the map to draw in pixels, as x,y,w,h")
+	scale := flag.Float64("scale", 1, "image pixels per map pixel")
+	outlines := flag.Bool("outlines", false, "draw the outlines of objects")
+	names := flag.Bool("names", false, "draw the names of objects")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: tmxrender [flags] map out.png")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 || *scale <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	in, out := flag.Arg(0), flag.Arg(1)
+
+	o := tmx.RenderOptions{Scale: *scale, Outlines: *outlines, Names: *names}
+	if *crop != "" {
+		r, e := parseCrop(*crop)
+		if e != nil {
+			fmt.Fprintln(os.Stderr, "tmxrender:", e)
+			os.Exit(2)
+		}
+		o.Crop = r
+	}
+	if *layers != "" {
+		o.Layers = tmx.LayersNamed(strings.Split(*layers, ",")...)
+	}
+
+	m, e := tmx.LoadTileMap(in)
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "tmxrender: %s: %v\n", in, e)
+		os.Exit(1)
+	}
+	if !*each {
+		if e = render(&m, o, out); e != nil {
+			fmt.Fprintln(os.Stderr, "tmxrender:", e)
+			os.Exit(1)
+		}
+		return
+	}
+	// every layer that isn't a group gets an image, cropped to the whole map
+	// so that the images line up
+	if o.Crop.Empty() {
+		if o.Crop, e = m.PixelBounds(); e != nil {
+			fmt.Fprintln(os.Stderr, "tmxrender:", e)
+			os.Exit(1)
+		}
+	}
+	ext := filepath.Ext(out)
+	for _, n := range m.AllLayers() {
+		l := n.Layer
+		if l.Type == "group" || o.Layers != nil && !o.Layers(l) {
+			continue
+		}
+		lo := o
+		lo.Layers = tmx.LayersNamed(l.Name)
+		fp := fmt.Sprintf("%s-%d-%s%s", strings.TrimSuffix(out, ext), l.Id, fileName(l.Name), ext)
+		if e = render(&m, lo, fp); e != nil {
+			fmt.Fprintln(os.Stderr, "tmxrender:", e)
+			os.Exit(1)
+		}
+	}
+}
+
+// render draws a map and writes it to a png file.
+func render(m interface {
+	Render(tmx.RenderOptions) (*image.RGBA, error)
+}, o tmx.RenderOptions, fp string) error {
+	img, e := m.Render(o)
+	if e != nil {
+		return e
+	}
+	f, e := os.Create(fp)
+	if e != nil {
+		return e
+	}
+	if e = png.Encode(f, img); e != nil {
+		f.Close()
+		return fmt.Errorf("%s: %v", fp, e)
+	}
+	return f.Close()
+}
+
+// parseCrop parses a rectangle written as x,y,w,h.
+func parseCrop(s string) (r tmx.Rect, e error) {
+	fs := strings.Split(s, ",")
+	if len(fs) != 4 {
+		return r, fmt.Errorf("crop %q is not x,y,w,h", s)
+	}
+	var n [4]float64
+	for i, f := range fs {
+		if n[i], e = strconv.ParseFloat(strings.TrimSpace(f), 64); e != nil {
+			return r, fmt.Errorf("crop %q is not x,y,w,h", s)
+		}
+	}
+	if n[2] <= 0 || n[3] <= 0 {
+		return r, fmt.Errorf("crop %q has no area", s)
+	}
+	return tmx.Rect{Min: tmx.Vec{X: n[0], Y: n[1]}, Max: tmx.Vec{X: n[0] + n[2], Y: n[1] + n[3]}}, nil
+}
+
+// fileName replaces the characters of a layer name that don't belong in a file
+// name.
+func fileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>| `, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
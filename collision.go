@@ -0,0 +1,220 @@
+package tmx
+
+import "math"
+
+// ShapeKind is the kind of geometry a collision shape has.
+type ShapeKind int
+
+const (
+	// ShapeAABB is an axis aligned box, see Shape.Bounds.
+	ShapeAABB ShapeKind = iota
+	// ShapeEllipse is an ellipse, see Shape.Center, Shape.Radii and
+	// Shape.Rotation. Shape.Circle reports whether it is a circle.
+	ShapeEllipse
+	// ShapePolygon is a closed polygon, see Shape.Points and Shape.Convex.
+	ShapePolygon
+	// ShapeChain is an open chain of line segments, see Shape.Points.
+	ShapeChain
+)
+
+// Shape is a collision shape in world space, which is map pixel space with the
+// layer offsets applied.
+type Shape struct {
+	Kind     ShapeKind
+	Bounds   Rect    // axis aligned bounding box
+	Points   []Vec   // vertices of a polygon or chain
+	Convex   bool    // whether a polygon is convex
+	Center   Vec     // center of an ellipse
+	Radii    Vec     // radii of an ellipse along its own axes
+	Rotation float64 // rotation of an ellipse in degrees clockwise
+	Layer    *layer  // layer the shape came from
+	Object   *object // object the shape was built from
+	Tile     *Tile   // tile the shape belongs to, nil for plain objects
+	Col, Row int     // cell of the tile in a tile layer
+}
+
+// Circle returns whether an ellipse has the same radius along both axes.
+func (s Shape) Circle() bool {
+	return s.Kind == ShapeEllipse && math.Abs(s.Radii.X-s.Radii.Y) < 1e-9
+}
+
+// CollisionShapes collects the collision shapes of a map. Tiles in tile layers
+// contribute the shapes from the tile collision editor, placed at the tile and
+// with its flips applied. Objects in object layers contribute themselves, or
+// the shapes of their tile for tile objects. Points and text have no area and
+// are skipped. Only layers the filter accepts are used, a nil filter accepts
+// every layer. Group layers are searched when the filter accepts them.
+func CollisionShapes(m *tilemap, filter LayerFilter) (s []Shape, e error) {
+	return m.collisionShapes(m.Layers, Vec{}, filter, s)
+}
+
+// collisionShapes walks a set of layers collecting collision shapes.
+func (m *tilemap) collisionShapes(ls []layer, off Vec, filter LayerFilter, s []Shape) ([]Shape, error) {
+	for i := 0; i < len(ls); i++ {
+		l := &ls[i]
+		if filter != nil && !filter(l) {
+			continue
+		}
+		o := off.Add(Vec{l.Offsetx, l.Offsety})
+		var e error
+		switch l.Type {
+		case groupLayer:
+			s, e = m.collisionShapes(l.Layers, o, filter, s)
+		case tileLayer:
+			s, e = m.tileLayerShapes(l, o, s)
+		case objectLayer:
+			for j := 0; j < len(l.Objects); j++ {
+				obj := &l.Objects[j]
+				s = m.objectShapes(l, obj, translation(o.X, o.Y), s)
+			}
+		}
+		if e != nil {
+			return s, e
+		}
+	}
+	return s, nil
+}
+
+// tileLayerShapes collects the collision shapes of every tile in a layer.
+func (m *tilemap) tileLayerShapes(l *layer, off Vec, s []Shape) ([]Shape, error) {
+	return s, m.eachTile(l, func(col, row int, t *Tile) {
+		if t.Nil() || len(t.CollisionShapes()) == 0 {
+			return
+		}
+		// tile images are aligned to the bottom left corner of the cell
+		w, h := t.size()
+		p := m.TileToPixel(col, row).Add(off)
+		p.Y += float64(m.Tileheight) - h
+		if t.set != nil {
+			p = p.Add(Vec{float64(t.set.TileOffsets.X), float64(t.set.TileOffsets.Y)})
+		}
+		place := translation(p.X, p.Y).then(flipping(w, h, t.horizontialFlip, t.verticalFlip, t.diagonalFlip))
+		for _, sh := range tileShapes(t, place) {
+			sh.Layer, sh.Col, sh.Row = l, col, row
+			s = append(s, sh)
+		}
+	})
+}
+
+// eachTile calls f with every tile in a tile layer along with its cell, going
+// through the chunks of infinite maps.
+func (m *tilemap) eachTile(l *layer, f func(col, row int, t *Tile)) error {
+	if e := l.Decode(); e != nil {
+		return e
+	}
+	if m.Infinite {
+		for i := 0; i < len(l.Chunks); i++ {
+			c := &l.Chunks[i]
+			for j, t := range c.Tiles() {
+				f(c.X+j%c.Width, c.Y+j/c.Width, t)
+			}
+		}
+		return nil
+	}
+	ts, _ := l.Tiles()
+	for j, t := range ts {
+		f(j%l.Width, j/l.Width, t)
+	}
+	return nil
+}
+
+// objectShapes appends the collision shapes of an object in an object layer.
+func (m *tilemap) objectShapes(l *layer, o *object, place affine, s []Shape) []Shape {
+	if o.Gid != 0 {
+		// a tile object uses the shapes of its tile, scaled to the object size
+		t := m.objectTile(o)
+		if t == nil || len(t.CollisionShapes()) == 0 {
+			return s
+		}
+		w, h := t.size()
+		if w == 0 || h == 0 {
+			return s
+		}
+		// the image is placed by the object alignment and then rotated
+		box := o.tileBox()
+		place = place.then(o.transform()).then(translation(box.Min.X, box.Min.Y)).
+			then(scaling(box.Width()/w, box.Height()/h)).
+			then(flipping(w, h, o.HorizontialFlip, o.VerticalFlip, o.DiagonalFlip))
+		for _, sh := range tileShapes(t, place) {
+			sh.Layer = l
+			s = append(s, sh)
+		}
+		return s
+	}
+	if sh, ok := objectShape(o, place); ok {
+		sh.Layer = l
+		s = append(s, sh)
+	}
+	return s
+}
+
+// objectTile returns the tile a tile object shows.
+func (m *tilemap) objectTile(o *object) *Tile {
+	gid := uint32(o.Gid)
+	i, ok := m.gids().find(gid)
+	if !ok {
+		return nil
+	}
+	ts := &m.Tilesets[i]
+	lid := localId(gid, ts.Firstgid)
+	return &Tile{gid: gid, lid: lid, tileset: ts.Source, set: ts, info: m.tile(i, lid)}
+}
+
+// tileShapes builds the shapes of the tile collision editor, placing them with
+// the given transform.
+func tileShapes(t *Tile, place affine) (s []Shape) {
+	objs := t.CollisionShapes()
+	for i := range objs {
+		o := &objs[i]
+		if sh, ok := objectShape(o, place); ok {
+			sh.Tile = t
+			s = append(s, sh)
+		}
+	}
+	return
+}
+
+// objectShape builds the shape of an object, rotating it about its position
+// and then placing it.
+func objectShape(o *object, place affine) (sh Shape, ok bool) {
+	if o.Point || o.Text.Text != empty {
+		return sh, false
+	}
+	t := place.then(o.transform())
+	sh.Object = o
+	switch {
+	case o.Ellipse:
+		sh.Kind = ShapeEllipse
+		sh.Center = t.apply(Vec{o.Width / 2, o.Height / 2})
+		a, b := t.vector(Vec{o.Width / 2, 0}), t.vector(Vec{0, o.Height / 2})
+		sh.Radii = Vec{math.Hypot(a.X, a.Y), math.Hypot(b.X, b.Y)}
+		sh.Rotation = math.Atan2(a.Y, a.X) * 180 / math.Pi
+		// bounding box of the rotated ellipse
+		ex, ey := math.Hypot(a.X, b.X), math.Hypot(a.Y, b.Y)
+		sh.Bounds = Rect{
+			Min: Vec{sh.Center.X - ex, sh.Center.Y - ey},
+			Max: Vec{sh.Center.X + ex, sh.Center.Y + ey},
+		}
+	case len(o.Polygon) > 0:
+		sh.Kind = ShapePolygon
+		sh.Points = t.applyAll(o.points())
+		sh.Convex = convex(sh.Points)
+		sh.Bounds = boundsOf(sh.Points)
+	case len(o.Polyline) > 0:
+		sh.Kind = ShapeChain
+		sh.Points = t.applyAll(o.points())
+		sh.Bounds = boundsOf(sh.Points)
+	default:
+		if o.Width == 0 || o.Height == 0 {
+			return sh, false
+		}
+		sh.Points = t.applyAll([]Vec{{0, 0}, {o.Width, 0}, {o.Width, o.Height}, {0, o.Height}})
+		sh.Bounds = boundsOf(sh.Points)
+		if t.axisAligned() {
+			sh.Kind, sh.Points = ShapeAABB, nil
+		} else {
+			sh.Kind, sh.Convex = ShapePolygon, true
+		}
+	}
+	return sh, true
+}
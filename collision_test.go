@@ -0,0 +1,121 @@
+package tmx
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCollisionShapes(t *testing.T) {
+	// tile 0 has a triangle in its top left half
+	m := &tilemap{Orientation: orthogonal, Width: 3, Height: 1, Tilewidth: 16, Tileheight: 16}
+	m.Tilesets = []tileset{{Firstgid: 1, Name: "ground", Tilewidth: 16, Tileheight: 16, Tilecount: 4, Columns: 2,
+		Tiles: []tile{{Id: 0, ObjectGroup: layer{Type: objectLayer, Objects: []object{
+			{Id: 1, Polygon: []point{{0, 0}, {16, 0}, {0, 16}}},
+		}}}}}}
+	var ts []*Tile
+	for _, gid := range []uint32{1, 1 | horizontalFlag, 1 | diagonalFlag} {
+		tile, e := m.makeTile(gid)
+		if e != nil {
+			t.Fatal(e)
+		}
+		ts = append(ts, tile)
+	}
+	lshape := []point{{0, 0}, {20, 0}, {20, 10}, {10, 10}, {10, 20}, {0, 20}}
+	m.Layers = []layer{
+		{Name: "walls", Type: tileLayer, Width: 3, Height: 1, Data: ts},
+		{Name: "things", Type: objectLayer, Offsetx: 100, Objects: []object{
+			{Id: 1, X: 10, Y: 20, Width: 30, Height: 10},
+			// a quarter turn keeps a rectangle axis aligned
+			{Id: 2, Width: 10, Height: 20, Rotation: 90},
+			{Id: 3, Width: 10, Height: 10, Rotation: 45},
+			{Id: 4, Y: 50, Width: 10, Height: 10, Ellipse: true},
+			{Id: 5, Y: 100, Width: 20, Height: 10, Ellipse: true, Rotation: 90},
+			{Id: 6, Y: 200, Polygon: lshape},
+			{Id: 7, Y: 300, Polyline: []point{{0, 0}, {10, 5}}},
+			// no area
+			{Id: 8, Point: true},
+			{Id: 9, Width: 10, Height: 10, Text: text{Text: "hi"}},
+			{Id: 10, Width: 10},
+		}},
+	}
+
+	s, e := CollisionShapes(m, nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(s) != 10 {
+		t.Fatalf("%d shapes, want 10", len(s))
+	}
+	near := func(a, b Vec) bool { return math.Hypot(a.X-b.X, a.Y-b.Y) < 1e-9 }
+	samePoints := func(a, b []Vec) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !near(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	sameRect := func(a, b Rect) bool { return near(a.Min, b.Min) && near(a.Max, b.Max) }
+
+	// the flips of the tiles mirror their shapes inside the cell
+	tiles := []struct {
+		name   string
+		points []Vec
+	}{
+		{"plain", []Vec{{0, 0}, {16, 0}, {0, 16}}},
+		{"horizontal flip", []Vec{{32, 0}, {16, 0}, {32, 16}}},
+		{"diagonal flip", []Vec{{32, 0}, {32, 16}, {48, 0}}},
+	}
+	for i, c := range tiles {
+		sh := s[i]
+		if sh.Kind != ShapePolygon || !sh.Convex || !samePoints(sh.Points, c.points) {
+			t.Errorf("%s: kind %v convex %v points %v, want a convex polygon %v", c.name, sh.Kind, sh.Convex, sh.Points, c.points)
+		}
+		if sh.Tile == nil || sh.Layer != &m.Layers[0] || sh.Col != i || sh.Row != 0 {
+			t.Errorf("%s: tile %v layer %v cell %d,%d", c.name, sh.Tile, sh.Layer, sh.Col, sh.Row)
+		}
+	}
+
+	objects := []struct {
+		name   string
+		kind   ShapeKind
+		bounds Rect
+		convex bool
+	}{
+		{"rect", ShapeAABB, Rect{Vec{110, 20}, Vec{140, 30}}, false},
+		{"quarter turn", ShapeAABB, Rect{Vec{80, 0}, Vec{100, 10}}, false},
+		{"eighth turn", ShapePolygon, Rect{Vec{100 - 5*math.Sqrt2, 0}, Vec{100 + 5*math.Sqrt2, 10 * math.Sqrt2}}, true},
+		{"circle", ShapeEllipse, Rect{Vec{100, 50}, Vec{110, 60}}, false},
+		{"turned ellipse", ShapeEllipse, Rect{Vec{90, 100}, Vec{100, 120}}, false},
+		{"l shape", ShapePolygon, Rect{Vec{100, 200}, Vec{120, 220}}, false},
+		{"chain", ShapeChain, Rect{Vec{100, 300}, Vec{110, 305}}, false},
+	}
+	for i, c := range objects {
+		sh := s[len(tiles)+i]
+		if sh.Kind != c.kind || !sameRect(sh.Bounds, c.bounds) || sh.Convex != c.convex {
+			t.Errorf("%s: kind %v bounds %v convex %v, want %v %v %v", c.name, sh.Kind, sh.Bounds, sh.Convex, c.kind, c.bounds, c.convex)
+		}
+		if sh.Tile != nil || sh.Object != &m.Layers[1].Objects[i] {
+			t.Errorf("%s: built from %v", c.name, sh.Object)
+		}
+	}
+	if c := s[6]; !c.Circle() || !near(c.Center, Vec{105, 55}) || !near(c.Radii, Vec{5, 5}) {
+		t.Errorf("circle: center %v radii %v", c.Center, c.Radii)
+	}
+	if e := s[7]; e.Circle() || !near(e.Center, Vec{95, 110}) || !near(e.Radii, Vec{10, 5}) || math.Abs(e.Rotation-90) > 1e-9 {
+		t.Errorf("turned ellipse: center %v radii %v rotation %g", e.Center, e.Radii, e.Rotation)
+	}
+	// the notch of the l shape is outside of it
+	l := s[8].Points
+	if !pointInPolygon(l, Vec{105, 215}) || pointInPolygon(l, Vec{115, 215}) {
+		t.Errorf("l shape %v contains the wrong points", l)
+	}
+
+	s, e = CollisionShapes(m, LayersNamed("things"))
+	if e != nil || len(s) != len(objects) {
+		t.Errorf("filtered: %d shapes, %v, want %d", len(s), e, len(objects))
+	}
+}
@@ -0,0 +1,144 @@
+package tmx
+
+import "math"
+
+const (
+	// map orientations
+	orthogonal = "orthogonal"
+	isometric  = "isometric"
+	staggered  = "staggered"
+	hexagonal  = "hexagonal"
+)
+
+const (
+	// stagger settings
+	staggerX    = "x"
+	staggerEven = "even"
+)
+
+// TileToPixel returns the top left corner of the bounding box of a tile cell
+// in map pixel space, taking the orientation of the map into account.
+func (m *tilemap) TileToPixel(col, row int) Vec {
+	tw, th := float64(m.Tilewidth), float64(m.Tileheight)
+	switch m.Orientation {
+	case isometric:
+		// the origin is shifted so that the left corner of the map is at zero
+		originX := float64(m.Height) * tw / 2
+		return Vec{
+			X: float64(col-row)*tw/2 + originX - tw/2,
+			Y: float64(col+row) * th / 2,
+		}
+	case staggered, hexagonal:
+		return m.staggeredToPixel(col, row)
+	}
+	return Vec{X: float64(col) * tw, Y: float64(row) * th}
+}
+
+// TileCenter returns the center of a tile cell in map pixel space.
+func (m *tilemap) TileCenter(col, row int) Vec {
+	p := m.TileToPixel(col, row)
+	return Vec{X: p.X + float64(m.Tilewidth)/2, Y: p.Y + float64(m.Tileheight)/2}
+}
+
+// PixelToTile returns the tile cell that contains a point in map pixel space.
+func (m *tilemap) PixelToTile(p Vec) (col, row int) {
+	tw, th := float64(m.Tilewidth), float64(m.Tileheight)
+	switch m.Orientation {
+	case isometric:
+		x := p.X - float64(m.Height)*tw/2
+		return int(math.Floor(p.Y/th + x/tw)), int(math.Floor(p.Y/th - x/tw))
+	case staggered, hexagonal:
+		return m.pixelToStaggered(p)
+	}
+	return int(math.Floor(p.X / tw)), int(math.Floor(p.Y / th))
+}
+
+// staggerAxisX returns whether every other column is shifted instead of every
+// other row.
+func (m *tilemap) staggerAxisX() bool {
+	return m.StaggerAxis == staggerX
+}
+
+// staggered returns whether a row or column index is one of the shifted ones.
+func (m *tilemap) staggered(i int) bool {
+	odd := i&1 == 1
+	if m.StaggerIndex == staggerEven {
+		return !odd
+	}
+	return odd
+}
+
+// staggerMetrics returns the side lengths of a hexagon along each axis and the
+// distance between columns and rows. Staggered maps are hexagonal maps with a
+// side length of zero.
+func (m *tilemap) staggerMetrics() (sideX, sideY, colWidth, rowHeight float64) {
+	tw, th := float64(m.Tilewidth&^1), float64(m.Tileheight&^1)
+	side := 0.0
+	if m.Orientation == hexagonal {
+		side = float64(m.HexSideLength)
+	}
+	if m.staggerAxisX() {
+		sideX = side
+	} else {
+		sideY = side
+	}
+	return sideX, sideY, (tw-sideX)/2 + sideX, (th-sideY)/2 + sideY
+}
+
+// staggeredToPixel is TileToPixel for staggered and hexagonal maps.
+func (m *tilemap) staggeredToPixel(col, row int) (p Vec) {
+	tw, th := float64(m.Tilewidth&^1), float64(m.Tileheight&^1)
+	sideX, sideY, colWidth, rowHeight := m.staggerMetrics()
+	if m.staggerAxisX() {
+		p.X = float64(col) * colWidth
+		p.Y = float64(row) * (th + sideY)
+		if m.staggered(col) {
+			p.Y += rowHeight
+		}
+		return
+	}
+	p.X = float64(col) * (tw + sideX)
+	p.Y = float64(row) * rowHeight
+	if m.staggered(row) {
+		p.X += colWidth
+	}
+	return
+}
+
+// pixelToStaggered is PixelToTile for staggered and hexagonal maps. It makes
+// a rough guess and then picks the closest cell center out of the neighbours,
+// using the diamond distance for staggered maps.
+func (m *tilemap) pixelToStaggered(p Vec) (col, row int) {
+	_, _, colWidth, rowHeight := m.staggerMetrics()
+	var c, r int
+	if m.staggerAxisX() {
+		c = int(math.Floor(p.X / colWidth))
+		r = int(math.Floor(p.Y / (2 * rowHeight)))
+	} else {
+		c = int(math.Floor(p.X / (2 * colWidth)))
+		r = int(math.Floor(p.Y / rowHeight))
+	}
+	tw, th := float64(m.Tilewidth), float64(m.Tileheight)
+	best := math.Inf(1)
+	for dr := -2; dr <= 2; dr++ {
+		for dc := -2; dc <= 2; dc++ {
+			q := m.TileCenter(c+dc, r+dr)
+			dx, dy := (p.X-q.X)/(tw/2), (p.Y-q.Y)/(th/2)
+			var d float64
+			if m.Orientation == hexagonal {
+				d = dx*dx + dy*dy
+			} else {
+				d = math.Abs(dx) + math.Abs(dy)
+			}
+			if d < best {
+				best, col, row = d, c+dc, r+dr
+			}
+		}
+	}
+	return
+}
+
+// Cell is the column and row of a tile in a tile layer.
+type Cell struct {
+	Col, Row int
+}
@@ -0,0 +1,146 @@
+package tmx
+
+import "sync"
+
+// Option changes how a tile map is processed while it is being loaded.
+type Option func(*options)
+
+type options struct {
+	lazy     bool // defer decoding tile data until a layer is accessed
+	workers  int  // number of goroutines used to decode tile data
+	budget   int  // bytes of decoded chunks kept when streaming
+	tolerant bool // keep going past problems and record them
+}
+
+// LazyDecoding defers decoding the tile data of each tile layer until the
+// layer is first accessed through Decode or Tiles.
+func LazyDecoding() Option {
+	return func(o *options) {
+		o.lazy = true
+	}
+}
+
+// ParallelDecoding decodes independent layers and chunks across at most n
+// goroutines. Anything less than two decodes the tile data serially.
+func ParallelDecoding(n int) Option {
+	return func(o *options) {
+		o.workers = n
+	}
+}
+
+// Tolerant keeps loading a map past the problems that would otherwise stop it,
+// so that they can all be reported by Validate. Tilesets and templates that
+// can't be loaded and tile data that can't be decoded are recorded along with
+// where they are in the map. Gids that aren't in any tileset are kept as they
+// are, and tiles with them have no tileset.
+func Tolerant() Option {
+	return func(o *options) {
+		o.tolerant = true
+	}
+}
+
+// lazyLayer holds everything needed to decode a layer the first time it is
+// accessed.
+type lazyLayer struct {
+	once sync.Once
+	m    *tilemap // the map the layer belongs to
+	l    *layer   // the layer as it is stored in the map
+	e    error    // the result of decoding the layer
+}
+
+// job is a piece of tile data that can be decoded independently of the rest.
+type job func() error
+
+// applyOptions stores the load options on the map.
+func (m *tilemap) applyOptions(opts []Option) {
+	for _, o := range opts {
+		o(&m.opts)
+	}
+}
+
+// scheduleLayer decodes the tile data of a layer now, queues it up to be
+// decoded in parallel, or defers it until first access.
+func (m *tilemap) scheduleLayer(l *layer) error {
+	if m.Infinite {
+		// the chunk headers are known before any data is decoded
+		l.indexChunks()
+	}
+	switch {
+	case m.streaming():
+		m.streamLayer(l)
+		return nil
+	case m.opts.lazy:
+		l.lazy = &lazyLayer{m: m, l: l}
+		return nil
+	case m.opts.workers > 1:
+		m.queue = append(m.queue, m.layerJobs(l)...)
+		return nil
+	}
+	return m.processLayer(l)
+}
+
+// runQueue decodes all of the tile data queued up by scheduleLayer.
+func (m *tilemap) runQueue() error {
+	q := m.queue
+	m.queue = nil
+	return runJobs(q, m.opts.workers)
+}
+
+// layerJobs splits a layer into jobs, one per chunk for infinite maps and a
+// single one for the whole layer otherwise.
+func (m *tilemap) layerJobs(l *layer) (jobs []job) {
+	if !m.Infinite {
+		return []job{func() error {
+			e := m.processTileData(&l.Data, *l, m.Width*m.Height)
+			return m.tolerate(problem{check: checkTileData, layer: l, e: e})
+		}}
+	}
+	for j := 0; j < len(l.Chunks); j++ {
+		c := &l.Chunks[j]
+		jobs = append(jobs, func() error {
+			e := m.processTileData(&c.Data, *l, c.Width*c.Height)
+			return m.tolerate(problem{check: checkTileData, layer: l, e: e})
+		})
+	}
+	return
+}
+
+// runJobs runs the jobs across at most n goroutines. The error returned is the
+// one from the earliest job that failed, the same one a serial run would
+// return.
+func runJobs(jobs []job, n int) error {
+	if n < 2 || len(jobs) < 2 {
+		for _, j := range jobs {
+			if e := j(); e != nil {
+				return e
+			}
+		}
+		return nil
+	}
+	if n > len(jobs) {
+		n = len(jobs)
+	}
+	errs := make([]error, len(jobs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = jobs[i]()
+			}
+		}()
+	}
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	for _, e := range errs {
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package tmx
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// layerGids returns the global ids with flip flags of every tile layer of a
+// map, chunk by chunk on infinite maps.
+func layerGids(t *testing.T, m *tilemap) (out [][]uint32) {
+	t.Helper()
+	for _, n := range m.AllLayers() {
+		l := n.Layer
+		if l.Type != tileLayer {
+			continue
+		}
+		if e := l.Decode(); e != nil {
+			t.Fatalf("layer %q: %v", l.Name, e)
+		}
+		if len(l.Chunks) == 0 {
+			ts, e := l.Tiles()
+			if e != nil {
+				t.Fatalf("layer %q: %v", l.Name, e)
+			}
+			out = append(out, rawGids(ts))
+		}
+		for i := range l.Chunks {
+			out = append(out, rawGids(l.Chunks[i].Tiles()))
+		}
+	}
+	return
+}
+
+func TestDecodingOptions(t *testing.T) {
+	dir := t.TempDir()
+	writes := []struct {
+		name                  string
+		format                Format
+		encoding, compression string
+	}{
+		{"csv.json", FormatJSON, csvEncoding, ""},
+		{"base64.json", FormatJSON, base_64, ""},
+		{"gzip.json", FormatJSON, base_64, gZip},
+		{"csv.tmx", FormatTMX, csvEncoding, ""},
+		{"zlib.tmx", FormatTMX, base_64, zLib},
+	}
+	for _, src := range []string{"testdata/base.json", "testdata/infinite.json"} {
+		m, e := LoadTileMap(src)
+		if e != nil {
+			t.Fatal(e)
+		}
+		// a flipped tile to check the flags survive every decoder
+		if e = m.SetTileAt(&m.Layers[0], 1, 0, 2|horizontalFlag|diagonalFlag); e != nil {
+			t.Fatal(e)
+		}
+		want := layerGids(t, &m)
+		for _, w := range writes {
+			fp := filepath.Join(dir, filepath.Base(src)+"."+w.name)
+			f, e := os.Create(fp)
+			if e != nil {
+				t.Fatal(e)
+			}
+			e = m.Write(f, WriteOptions{Format: w.format, Encoding: w.encoding, Compression: w.compression, Dir: dir})
+			f.Close()
+			if e != nil {
+				t.Fatalf("%s: %v", fp, e)
+			}
+			opts := []struct {
+				name string
+				opts []Option
+			}{
+				{"eager", nil},
+				{"lazy", []Option{LazyDecoding()}},
+				{"parallel", []Option{ParallelDecoding(4)}},
+				{"lazy parallel", []Option{LazyDecoding(), ParallelDecoding(4)}},
+			}
+			for _, o := range opts {
+				got, e := LoadTileMap(fp, o.opts...)
+				if e != nil {
+					t.Fatalf("%s %s: %v", fp, o.name, e)
+				}
+				if g := layerGids(t, &got); !reflect.DeepEqual(g, want) {
+					t.Errorf("%s %s: decoded %v, want %v", fp, o.name, g, want)
+				}
+			}
+		}
+	}
+}
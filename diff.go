@@ -0,0 +1,511 @@
+package tmx
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// ChangeKind is what happened to a layer, tileset, or object between two
+// versions of a map.
+type ChangeKind int
+
+const (
+	// Modified means fields of the thing changed.
+	Modified ChangeKind = iota
+	// Added means the thing is only in the new map.
+	Added
+	// Removed means the thing is only in the old map.
+	Removed
+	// Moved means only the position of an object changed.
+	Moved
+)
+
+// String returns the name of the change.
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Moved:
+		return "moved"
+	}
+	return "modified"
+}
+
+// MarshalText writes the change as its name.
+func (k ChangeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// MapDiff is the difference between two versions of a map.
+type MapDiff struct {
+	Map      []FieldChange   `json:"map,omitempty"`      // map attributes
+	Tilesets []TilesetChange `json:"tilesets,omitempty"` // tilesets by name
+	Layers   []LayerChange   `json:"layers,omitempty"`   // layers by id
+}
+
+// FieldChange is a field that has a different value in the new map. Custom
+// properties are named "property:" followed by the name of the property, and
+// the value is nil on the side that doesn't have the property.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// TilesetChange is a tileset that was added, removed, or modified.
+type TilesetChange struct {
+	Name   string        `json:"name"`
+	Kind   ChangeKind    `json:"kind"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// LayerChange is a layer that was added, removed, or modified, or that holds
+// changed tiles or objects.
+type LayerChange struct {
+	Id      int            `json:"id"`
+	Name    string         `json:"name"`
+	Kind    ChangeKind     `json:"kind"`
+	Fields  []FieldChange  `json:"fields,omitempty"`
+	Tiles   []TileChange   `json:"tiles,omitempty"`
+	Objects []ObjectChange `json:"objects,omitempty"`
+}
+
+// TileChange is a cell of a tile layer that holds a different tile. The gids
+// have the flip flags in their high bits and are zero for empty cells.
+type TileChange struct {
+	Cell
+	Old uint32 `json:"old"`
+	New uint32 `json:"new"`
+}
+
+// ObjectChange is an object that was added, removed, moved, or modified. The
+// bounds are those of the object in the new map, or the old one for removed
+// objects.
+type ObjectChange struct {
+	Id     int           `json:"id"`
+	Name   string        `json:"name"`
+	Kind   ChangeKind    `json:"kind"`
+	Fields []FieldChange `json:"fields,omitempty"`
+	Bounds Rect          `json:"bounds"`
+}
+
+// Empty returns whether the two maps are the same.
+func (d MapDiff) Empty() bool {
+	return len(d.Map) == 0 && len(d.Tilesets) == 0 && len(d.Layers) == 0
+}
+
+// String formats a field change as field: old -> new.
+func (c FieldChange) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Field, c.Old, c.New)
+}
+
+// Diff compares two versions of a map. Layers are matched by id, tilesets by
+// name, and objects by id anywhere in the map so an object that changes
+// layers is a modification rather than a removal and an addition. Tiles are
+// compared cell by cell by their tileset, local id and flips, so moving the
+// first gids of the tilesets doesn't change every cell.
+func Diff(a, b *tilemap) (d MapDiff, e error) {
+	d.Map = mapChanges(a, b)
+	d.Tilesets = tilesetChanges(a, b)
+	d.Layers, e = layerChanges(a, b)
+	return
+}
+
+// fieldChanges collects the fields that differ, given as name, old, new
+// triples.
+func fieldChanges(fs ...interface{}) (cs []FieldChange) {
+	for i := 0; i+2 < len(fs); i += 3 {
+		if !reflect.DeepEqual(fs[i+1], fs[i+2]) {
+			cs = append(cs, FieldChange{Field: fs[i].(string), Old: fs[i+1], New: fs[i+2]})
+		}
+	}
+	return
+}
+
+// propertyChanges collects the custom properties that differ.
+func propertyChanges(a, b []property) (cs []FieldChange) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, ps := range [][]property{a, b} {
+		for _, p := range ps {
+			if !seen[p.Name] {
+				seen[p.Name] = true
+				names = append(names, p.Name)
+			}
+		}
+	}
+	for _, n := range names {
+		var old, cur interface{}
+		if p, ok := findProperty(a, n); ok {
+			old = p.Value
+		}
+		if p, ok := findProperty(b, n); ok {
+			cur = p.Value
+		}
+		if !reflect.DeepEqual(old, cur) {
+			cs = append(cs, FieldChange{Field: "property:" + n, Old: old, New: cur})
+		}
+	}
+	return
+}
+
+// mapChanges compares the attributes of two maps.
+func mapChanges(a, b *tilemap) []FieldChange {
+	cs := fieldChanges(
+		"orientation", a.Orientation, b.Orientation,
+		"renderorder", a.Renderorder, b.Renderorder,
+		"width", a.Width, b.Width,
+		"height", a.Height, b.Height,
+		"tilewidth", a.Tilewidth, b.Tilewidth,
+		"tileheight", a.Tileheight, b.Tileheight,
+		"infinite", a.Infinite, b.Infinite,
+		"backgroundcolor", a.Backgroundcolor, b.Backgroundcolor,
+		"staggeraxis", a.StaggerAxis, b.StaggerAxis,
+		"staggerindex", a.StaggerIndex, b.StaggerIndex,
+		"hexsidelength", a.HexSideLength, b.HexSideLength,
+		"nextlayerid", a.NextLayerId, b.NextLayerId,
+		"nextobjectid", a.Nextobjectid, b.Nextobjectid,
+	)
+	return append(cs, propertyChanges(a.Properties, b.Properties)...)
+}
+
+// tilesetChanges compares the tilesets of two maps by name. Image paths are
+// compared once resolved against each map's directory, so moving a map
+// alone does not report its images as changed.
+func tilesetChanges(am, bm *tilemap) (cs []TilesetChange) {
+	a, b := am.Tilesets, bm.Tilesets
+	find := func(ts []tileset, name string) *tileset {
+		for i := range ts {
+			if ts[i].Name == name {
+				return &ts[i]
+			}
+		}
+		return nil
+	}
+	for i := range a {
+		t, n := &a[i], find(b, a[i].Name)
+		if n == nil {
+			cs = append(cs, TilesetChange{Name: t.Name, Kind: Removed})
+			continue
+		}
+		fs := fieldChanges(
+			"firstgid", t.Firstgid, n.Firstgid,
+			"source", t.Source, n.Source,
+			"image", imageFile(am.dir, t, t.Image), imageFile(bm.dir, n, n.Image),
+			"tilewidth", t.Tilewidth, n.Tilewidth,
+			"tileheight", t.Tileheight, n.Tileheight,
+			"tilecount", t.Tilecount, n.Tilecount,
+			"columns", t.Columns, n.Columns,
+			"spacing", t.Spacing, n.Spacing,
+			"margin", t.Margin, n.Margin,
+			"tileoffset", t.TileOffsets, n.TileOffsets,
+		)
+		fs = append(fs, propertyChanges(t.Properties, n.Properties)...)
+		fs = append(fs, tileInfoChanges(am.dir, bm.dir, t, n)...)
+		if len(fs) > 0 {
+			cs = append(cs, TilesetChange{Name: t.Name, Kind: Modified, Fields: fs})
+		}
+	}
+	for i := range b {
+		if find(a, b[i].Name) == nil {
+			cs = append(cs, TilesetChange{Name: b[i].Name, Kind: Added})
+		}
+	}
+	return
+}
+
+// tileInfoChanges compares the metadata of the tiles of two versions of a
+// tileset. Fields are named "tile:" followed by the local id and the field,
+// collision shapes are summed up by their count.
+func tileInfoChanges(adir, bdir string, a, b *tileset) (cs []FieldChange) {
+	byId := func(t *tileset) map[int]*tile {
+		m := make(map[int]*tile, len(t.Tiles))
+		for i := range t.Tiles {
+			m[t.Tiles[i].Id] = &t.Tiles[i]
+		}
+		return m
+	}
+	at, bt := byId(a), byId(b)
+	ids := make([]int, 0, len(at)+len(bt))
+	for id := range at {
+		ids = append(ids, id)
+	}
+	for id := range bt {
+		if _, dup := at[id]; !dup {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		o, n := at[id], bt[id]
+		if o == nil {
+			o = &tile{}
+		}
+		if n == nil {
+			n = &tile{}
+		}
+		prefix := "tile:" + strconv.Itoa(id) + ":"
+		for _, f := range fieldChanges(
+			"type", o.Type, n.Type,
+			"class", o.Class, n.Class,
+			"image", imageFile(adir, a, o.Image), imageFile(bdir, b, n.Image),
+			"terrain", o.Terrian, n.Terrian,
+			"animation", o.Animation, n.Animation,
+		) {
+			f.Field = prefix + f.Field
+			cs = append(cs, f)
+		}
+		if !reflect.DeepEqual(o.ObjectGroup.Objects, n.ObjectGroup.Objects) {
+			cs = append(cs, FieldChange{
+				Field: prefix + "collision",
+				Old:   fmt.Sprintf("%d shapes", len(o.ObjectGroup.Objects)),
+				New:   fmt.Sprintf("%d shapes", len(n.ObjectGroup.Objects)),
+			})
+		}
+		for _, f := range propertyChanges(o.Properties, n.Properties) {
+			f.Field = prefix + f.Field
+			cs = append(cs, f)
+		}
+	}
+	return
+}
+
+// imageFile resolves an image of a tileset against the directory of its map.
+func imageFile(dir string, t *tileset, img string) string {
+	fp := filepath.FromSlash(t.imagePath(img))
+	if fp == empty || filepath.IsAbs(fp) {
+		return fp
+	}
+	return filepath.Join(dir, fp)
+}
+
+// placedObject is an object along with the layer it is in.
+type placedObject struct {
+	o *object
+	l *layer
+}
+
+// objectsById indexes every object of a map by its id.
+func objectsById(m *tilemap) map[int]placedObject {
+	objs := make(map[int]placedObject)
+	for _, n := range m.AllLayers() {
+		for i := range n.Layer.Objects {
+			o := &n.Layer.Objects[i]
+			objs[o.Id] = placedObject{o, n.Layer}
+		}
+	}
+	return objs
+}
+
+// layerChanges compares the layers of two maps by id, along with their tiles
+// and objects.
+func layerChanges(a, b *tilemap) (cs []LayerChange, e error) {
+	al, bl := a.AllLayers(), b.AllLayers()
+	byId := func(ls []NestedLayer) map[int]*layer {
+		m := make(map[int]*layer, len(ls))
+		for _, n := range ls {
+			m[n.Layer.Id] = n.Layer
+		}
+		return m
+	}
+	aIds, bIds := byId(al), byId(bl)
+	changes := make(map[int]*LayerChange)
+	var order []int
+	change := func(l *layer, kind ChangeKind) *LayerChange {
+		c, ok := changes[l.Id]
+		if !ok {
+			c = &LayerChange{Id: l.Id, Name: l.Name, Kind: kind}
+			changes[l.Id] = c
+			order = append(order, l.Id)
+		}
+		return c
+	}
+
+	for _, n := range al {
+		if _, ok := bIds[n.Layer.Id]; !ok {
+			change(n.Layer, Removed)
+		}
+	}
+	for _, n := range bl {
+		l, old := n.Layer, aIds[n.Layer.Id]
+		if old == nil {
+			change(l, Added)
+			continue
+		}
+		fs := fieldChanges(
+			"name", old.Name, l.Name,
+			"type", old.Type, l.Type,
+			"visible", old.Visible, l.Visible,
+			"opacity", old.Opacity, l.Opacity,
+			"offsetx", old.Offsetx, l.Offsetx,
+			"offsety", old.Offsety, l.Offsety,
+			"width", old.Width, l.Width,
+			"height", old.Height, l.Height,
+			"draworder", old.DrawOrder, l.DrawOrder,
+			"image", old.Image, l.Image,
+		)
+		fs = append(fs, propertyChanges(old.Properties, l.Properties)...)
+		if len(fs) > 0 {
+			change(l, Modified).Fields = fs
+		}
+		if l.Type == tileLayer && old.Type == tileLayer {
+			ts, e := tileChanges(a, old, b, l)
+			if e != nil {
+				return nil, e
+			}
+			if len(ts) > 0 {
+				change(l, Modified).Tiles = ts
+			}
+		}
+	}
+
+	// objects are matched across the whole map
+	ao, bo := objectsById(a), objectsById(b)
+	for _, id := range sortedIds(ao) {
+		p := ao[id]
+		if _, ok := bo[id]; !ok {
+			c := change(p.l, Modified)
+			c.Objects = append(c.Objects, ObjectChange{Id: id, Name: p.o.Name, Kind: Removed, Bounds: p.o.Bounds()})
+		}
+	}
+	for _, id := range sortedIds(bo) {
+		p := bo[id]
+		old, ok := ao[id]
+		if !ok {
+			c := change(p.l, Modified)
+			c.Objects = append(c.Objects, ObjectChange{Id: id, Name: p.o.Name, Kind: Added, Bounds: p.o.Bounds()})
+			continue
+		}
+		if oc, changed := objectChange(a, old, b, p); changed {
+			c := change(p.l, Modified)
+			c.Objects = append(c.Objects, oc)
+		}
+	}
+
+	for _, id := range order {
+		cs = append(cs, *changes[id])
+	}
+	return cs, nil
+}
+
+// sortedIds returns the ids of a set of objects in order.
+func sortedIds(objs map[int]placedObject) []int {
+	ids := make([]int, 0, len(objs))
+	for id := range objs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// objectChange compares two versions of an object from two maps.
+func objectChange(am *tilemap, a placedObject, bm *tilemap, b placedObject) (c ObjectChange, changed bool) {
+	o, n := a.o, b.o
+	fs := fieldChanges(
+		"x", o.X, n.X,
+		"y", o.Y, n.Y,
+		"name", o.Name, n.Name,
+		"type", o.Type, n.Type,
+		"class", o.Class, n.Class,
+		"width", o.Width, n.Width,
+		"height", o.Height, n.Height,
+		"rotation", o.Rotation, n.Rotation,
+		"visible", o.Visible, n.Visible,
+	)
+	if og, ng := objectGid(o), objectGid(n); am.tileRef(og) != bm.tileRef(ng) {
+		fs = append(fs, FieldChange{Field: "gid", Old: og, New: ng})
+	}
+	fs = append(fs, fieldChanges(
+		"ellipse", o.Ellipse, n.Ellipse,
+		"point", o.Point, n.Point,
+		"polygon", o.Polygon, n.Polygon,
+		"polyline", o.Polyline, n.Polyline,
+		"text", o.Text, n.Text,
+	)...)
+	if a.l.Id != b.l.Id {
+		fs = append(fs, FieldChange{Field: "layer", Old: a.l.Name, New: b.l.Name})
+	}
+	fs = append(fs, propertyChanges(o.Properties, n.Properties)...)
+	if len(fs) == 0 {
+		return c, false
+	}
+	c = ObjectChange{Id: n.Id, Name: n.Name, Kind: Modified, Fields: fs, Bounds: n.Bounds()}
+	moved := true
+	for _, f := range fs {
+		if f.Field != "x" && f.Field != "y" {
+			moved = false
+		}
+	}
+	if moved {
+		c.Kind = Moved
+	}
+	return c, true
+}
+
+// objectGid returns the global id of a tile object with its flip flags.
+func objectGid(o *object) uint32 {
+	if o.Gid == 0 {
+		return 0
+	}
+	return uint32(o.Gid) | flagBits(o.HorizontialFlip, o.VerticalFlip, o.DiagonalFlip)
+}
+
+// tileRef is a tile picked out by its tileset and local id, which unlike its
+// gid stays the same when tilesets before it are added or removed.
+type tileRef struct {
+	name, source string // tileset of the tile
+	lid          uint32 // local id, or the gid of a tile in no tileset
+	flags        uint32 // flip flags
+	resolved     bool   // whether the gid is in a tileset
+}
+
+// tileRef returns the tile a global id with flip flags refers to.
+func (m *tilemap) tileRef(raw uint32) tileRef {
+	if raw == 0 {
+		return tileRef{}
+	}
+	r := tileRef{lid: clearHighBits(raw), flags: raw &^ clearHighBits(raw)}
+	if t, lid, e := m.TilesetForGid(raw); e == nil {
+		r.name, r.source, r.lid, r.resolved = t.Name, t.Source, lid, true
+	}
+	return r
+}
+
+// tileChanges compares the cells of two versions of a tile layer, over the
+// cells either version covers. Cells are compared by the tileset and local id
+// of their tiles, so tilesets moving to other gids don't change every cell.
+func tileChanges(am *tilemap, a *layer, bm *tilemap, b *layer) (cs []TileChange, e error) {
+	ra, e := layerCells(am, a)
+	if e != nil {
+		return
+	}
+	rb, e := layerCells(bm, b)
+	if e != nil {
+		return
+	}
+	r := ra.Union(rb)
+	for row := r.Min.Row; row < r.Max.Row; row++ {
+		for col := r.Min.Col; col < r.Max.Col; col++ {
+			old := rawGids([]*Tile{a.TileAt(col, row)})[0]
+			cur := rawGids([]*Tile{b.TileAt(col, row)})[0]
+			if old != cur && am.tileRef(old) != bm.tileRef(cur) {
+				cs = append(cs, TileChange{Cell: Cell{col, row}, Old: old, New: cur})
+			}
+		}
+	}
+	return
+}
+
+// layerCells returns the cells a tile layer covers, the used cells for the
+// layers of infinite maps.
+func layerCells(m *tilemap, l *layer) (CellRect, error) {
+	if m.Infinite || len(l.Chunks) > 0 {
+		return l.UsedBounds()
+	}
+	return CellRect{Max: Cell{l.Width, l.Height}}, nil
+}
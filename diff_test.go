@@ -0,0 +1,112 @@
+package tmx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	cases := []struct {
+		name    string
+		b       string           // new version of testdata/base.json
+		edit    func(m *tilemap) // changes made to the new version
+		tiles   []TileChange     // changes to the ground layer
+		objects map[int]ChangeKind
+		sets    map[string]ChangeKind
+	}{
+		{name: "same", b: "testdata/base.json"},
+		{
+			name: "tiles",
+			b:    "testdata/base.json",
+			edit: func(m *tilemap) {
+				m.SetTileAt(&m.Layers[0], 0, 0, 4)
+				m.SetTileAt(&m.Layers[0], 3, 2, 1|horizontalFlag)
+				m.SetTileAt(&m.Layers[0], 1, 0, 1)
+			},
+			tiles: []TileChange{
+				{Cell{0, 0}, 1, 4},
+				{Cell{3, 2}, 0, 1 | horizontalFlag},
+			},
+		},
+		{
+			name: "objects",
+			b:    "testdata/base.json",
+			edit: func(m *tilemap) {
+				objs := m.Layers[1].Objects
+				objs[0].X += 16
+				objs[1].Properties[0].Value = "blue"
+				objs[0].HorizontialFlip = true
+			},
+			objects: map[int]ChangeKind{1: Modified, 2: Modified},
+		},
+		{
+			name: "moved",
+			b:    "testdata/base.json",
+			edit: func(m *tilemap) {
+				m.Layers[1].Objects[1].Y = 0
+			},
+			objects: map[int]ChangeKind{2: Moved},
+		},
+		{
+			// a tileset before the ground tileset moves every gid, only the
+			// one cell that holds another tile changed
+			name:  "tileset inserted",
+			b:     "testdata/shifted.json",
+			tiles: []TileChange{{Cell{3, 2}, 0, 6}},
+			sets:  map[string]ChangeKind{"extra": Added, "ground": Modified},
+		},
+	}
+	for _, c := range cases {
+		a, e := LoadTileMap("testdata/base.json")
+		if e != nil {
+			t.Fatal(e)
+		}
+		b, e := LoadTileMap(c.b)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if c.edit != nil {
+			c.edit(&b)
+		}
+		d, e := Diff(&a, &b)
+		if e != nil {
+			t.Fatalf("%s: %v", c.name, e)
+		}
+		if len(d.Map) > 0 {
+			t.Errorf("%s: map changes %v", c.name, d.Map)
+		}
+		sets := make(map[string]ChangeKind)
+		for _, s := range d.Tilesets {
+			sets[s.Name] = s.Kind
+		}
+		if len(sets) > 0 || len(c.sets) > 0 {
+			if !reflect.DeepEqual(sets, c.sets) {
+				t.Errorf("%s: tilesets %v, want %v", c.name, sets, c.sets)
+			}
+		}
+		var tiles []TileChange
+		objects := make(map[int]ChangeKind)
+		for _, l := range d.Layers {
+			if l.Kind != Modified || len(l.Fields) > 0 {
+				t.Errorf("%s: layer %d is %s with fields %v", c.name, l.Id, l.Kind, l.Fields)
+			}
+			if l.Id == 1 {
+				tiles = l.Tiles
+			}
+			for _, o := range l.Objects {
+				objects[o.Id] = o.Kind
+			}
+		}
+		if !reflect.DeepEqual(tiles, c.tiles) {
+			t.Errorf("%s: tiles %v, want %v", c.name, tiles, c.tiles)
+		}
+		if len(objects) > 0 || len(c.objects) > 0 {
+			if !reflect.DeepEqual(objects, c.objects) {
+				t.Errorf("%s: objects %v, want %v", c.name, objects, c.objects)
+			}
+		}
+		if c.name == "same" && !d.Empty() {
+			t.Errorf("same: %+v is not empty", d)
+		}
+	}
+}
@@ -0,0 +1,524 @@
+package tmx
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	// file format errors
+	unsupportedFormat = errors.New("the file is not a tiled map, tileset or template")
+)
+
+// Format is a file format Tiled saves maps, tilesets, and templates in.
+type Format int
+
+const (
+	// FormatJSON is the json format (.json, .tmj, .tsj, .tj).
+	FormatJSON Format = iota
+	// FormatTMX is the xml format (.tmx, .tsx, .tx).
+	FormatTMX
+)
+
+// FormatOf returns the format of a file from its extension. Anything that
+// isn't one of the xml extensions is taken to be json.
+func FormatOf(fp string) Format {
+	switch strings.ToLower(filepath.Ext(fp)) {
+	case ".tmx", ".tsx", ".tx", ".xml":
+		return FormatTMX
+	}
+	return FormatJSON
+}
+
+// variant is a json object, the shape every format is converted to before the
+// data is decoded.
+type variant = map[string]interface{}
+
+// xmlNode is an element of an xml document with its attributes, text, and
+// child elements in document order.
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []xmlNode  `xml:",any"`
+}
+
+// attr returns the value of an attribute.
+func (n *xmlNode) attr(name string) (string, bool) {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+	return empty, false
+}
+
+// child returns the first child element with a name, or nil.
+func (n *xmlNode) child(name string) *xmlNode {
+	for i := range n.Children {
+		if n.Children[i].XMLName.Local == name {
+			return &n.Children[i]
+		}
+	}
+	return nil
+}
+
+// numericAttrs and boolAttrs are the attributes that aren't strings. Every
+// number becomes a float64, the same as decoding json into an interface.
+var (
+	numericAttrs = map[string]bool{
+		"version": true, "width": true, "height": true, "tilewidth": true,
+		"tileheight": true, "hexsidelength": true, "nextlayerid": true,
+		"nextobjectid": true, "id": true, "x": true, "y": true, "opacity": true,
+		"offsetx": true, "offsety": true, "parallaxx": true, "parallaxy": true,
+		"rotation": true, "gid": true, "firstgid": true, "spacing": true,
+		"margin": true, "tilecount": true, "columns": true, "tileid": true,
+		"duration": true, "probability": true, "tile": true, "pixelsize": true,
+		"startx": true, "starty": true, "compressionlevel": true,
+	}
+	boolAttrs = map[string]bool{
+		"infinite": true, "visible": true, "wrap": true, "hflip": true,
+		"vflip": true, "dflip": true, "bold": true, "italic": true,
+		"underline": true, "strikeout": true, "kerning": true, "rotate": true,
+		"preferuntransformed": true,
+	}
+)
+
+// attrs copies the attributes of an element into a variant, converting the
+// ones that aren't strings. Elements that default to visible get the json
+// defaults for visibility and opacity.
+func attrs(n *xmlNode, visible bool) variant {
+	v := variant{}
+	if visible {
+		v["visible"], v["opacity"] = true, 1.0
+	}
+	for _, a := range n.Attrs {
+		k := a.Name.Local
+		switch {
+		case numericAttrs[k]:
+			f, e := strconv.ParseFloat(a.Value, 64)
+			if e != nil {
+				continue
+			}
+			v[k] = f
+		case boolAttrs[k]:
+			v[k] = a.Value == "1" || a.Value == "true"
+		default:
+			v[k] = a.Value
+		}
+	}
+	return v
+}
+
+// tmxToJSON converts a map, tileset, or template in the xml format into the
+// json format.
+func tmxToJSON(b []byte) ([]byte, error) {
+	var root xmlNode
+	if e := xml.Unmarshal(b, &root); e != nil {
+		return nil, e
+	}
+	var v variant
+	switch root.XMLName.Local {
+	case "map":
+		v = mapVariant(&root)
+	case "tileset":
+		v = tilesetVariant(&root)
+	case "template":
+		v = templateVariant(&root)
+	default:
+		return nil, unsupportedFormat
+	}
+	return json.Marshal(v)
+}
+
+// mapVariant converts a <map> element.
+func mapVariant(n *xmlNode) variant {
+	v := attrs(n, false)
+	v["type"] = "map"
+	var tilesets []interface{}
+	for i := range n.Children {
+		c := &n.Children[i]
+		switch c.XMLName.Local {
+		case "properties":
+			v["properties"] = propertiesVariant(c)
+		case "tileset":
+			tilesets = append(tilesets, tilesetVariant(c))
+		}
+	}
+	v["tilesets"] = tilesets
+	v["layers"] = layersVariant(n)
+	return v
+}
+
+// layersVariant converts the layer elements inside of a map or group.
+func layersVariant(n *xmlNode) []interface{} {
+	ls := []interface{}{}
+	for i := range n.Children {
+		c := &n.Children[i]
+		var l variant
+		switch c.XMLName.Local {
+		case "layer":
+			l = attrs(c, true)
+			l["type"] = tileLayer
+			if d := c.child("data"); d != nil {
+				dataVariant(d, l)
+			}
+		case objectLayer:
+			l = attrs(c, true)
+			l["type"] = objectLayer
+			objs := []interface{}{}
+			for j := range c.Children {
+				if c.Children[j].XMLName.Local == "object" {
+					objs = append(objs, objectVariant(&c.Children[j]))
+				}
+			}
+			l["objects"] = objs
+		case "imagelayer":
+			l = attrs(c, true)
+			l["type"] = "imagelayer"
+			if img := c.child("image"); img != nil {
+				l["image"], _ = img.attr("source")
+				if t, ok := img.attr("trans"); ok {
+					l["transparentcolor"] = "#" + t
+				}
+			}
+		case groupLayer:
+			l = attrs(c, true)
+			l["type"] = groupLayer
+			l["layers"] = layersVariant(c)
+		default:
+			continue
+		}
+		if p := c.child("properties"); p != nil {
+			l["properties"] = propertiesVariant(p)
+		}
+		ls = append(ls, l)
+	}
+	return ls
+}
+
+// dataVariant converts the <data> of a tile layer, filling in the data or the
+// chunks of the layer.
+func dataVariant(d *xmlNode, l variant) {
+	enc, _ := d.attr("encoding")
+	comp, _ := d.attr("compression")
+	if enc == base_64 {
+		l["encoding"] = base_64
+		if comp != empty {
+			l["compression"] = comp
+		}
+	}
+	var chunks []interface{}
+	for i := range d.Children {
+		c := &d.Children[i]
+		if c.XMLName.Local == "chunk" {
+			ch := attrs(c, false)
+			ch["data"] = gidData(c, enc)
+			chunks = append(chunks, ch)
+		}
+	}
+	if chunks != nil {
+		l["chunks"] = chunks
+		return
+	}
+	l["data"] = gidData(d, enc)
+}
+
+// gidData converts tile data held as base64 text, csv text, or <tile>
+// elements.
+func gidData(n *xmlNode, enc string) interface{} {
+	switch enc {
+	case base_64:
+		return strings.TrimSpace(n.Text)
+	case "csv":
+		gids := []interface{}{}
+		for _, f := range strings.Split(n.Text, ",") {
+			if f = strings.TrimSpace(f); f != empty {
+				g, _ := strconv.ParseFloat(f, 64)
+				gids = append(gids, g)
+			}
+		}
+		return gids
+	}
+	gids := []interface{}{}
+	for i := range n.Children {
+		if n.Children[i].XMLName.Local == "tile" {
+			g, _ := n.Children[i].attr("gid")
+			f, _ := strconv.ParseFloat(g, 64)
+			gids = append(gids, f)
+		}
+	}
+	return gids
+}
+
+// objectVariant converts an <object> element.
+func objectVariant(n *xmlNode) variant {
+	v := attrs(n, true)
+	delete(v, "opacity")
+	if _, set := n.attr("visible"); !set && v["template"] != nil {
+		// an object made from a template keeps the visibility of the template
+		delete(v, "visible")
+	}
+	for i := range n.Children {
+		c := &n.Children[i]
+		switch c.XMLName.Local {
+		case "properties":
+			v["properties"] = propertiesVariant(c)
+		case "ellipse":
+			v["ellipse"] = true
+		case "point":
+			v["point"] = true
+		case "polygon", "polyline":
+			s, _ := c.attr("points")
+			v[c.XMLName.Local] = pointsVariant(s)
+		case "text":
+			t := attrs(c, false)
+			t["text"] = c.Text
+			v["text"] = t
+		}
+	}
+	return v
+}
+
+// pointsVariant converts a list of points written as "x,y x,y".
+func pointsVariant(s string) []interface{} {
+	ps := []interface{}{}
+	for _, f := range strings.Fields(s) {
+		xy := strings.SplitN(f, ",", 2)
+		if len(xy) != 2 {
+			continue
+		}
+		x, _ := strconv.ParseFloat(xy[0], 64)
+		y, _ := strconv.ParseFloat(xy[1], 64)
+		ps = append(ps, variant{"x": x, "y": y})
+	}
+	return ps
+}
+
+// propertiesVariant converts a <properties> element.
+func propertiesVariant(n *xmlNode) []interface{} {
+	ps := []interface{}{}
+	for i := range n.Children {
+		c := &n.Children[i]
+		if c.XMLName.Local != "property" {
+			continue
+		}
+		name, _ := c.attr("name")
+		typ, ok := c.attr("type")
+		if !ok {
+			typ = "string"
+		}
+		p := variant{"name": name, "type": typ}
+		if pt, ok := c.attr("propertytype"); ok {
+			p["propertytype"] = pt
+		}
+		p["value"] = propertyValue(c, typ)
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// propertyValue converts the value of a <property> to its json type.
+func propertyValue(c *xmlNode, typ string) interface{} {
+	if typ == "class" {
+		m := variant{}
+		if ps := c.child("properties"); ps != nil {
+			for _, p := range propertiesVariant(ps) {
+				m[p.(variant)["name"].(string)] = p.(variant)["value"]
+			}
+		}
+		return m
+	}
+	s, ok := c.attr("value")
+	if !ok {
+		// multi-line strings are kept in the text of the element
+		s = c.Text
+	}
+	switch typ {
+	case "int", "float", "object":
+		f, _ := strconv.ParseFloat(s, 64)
+		return f
+	case "bool":
+		return s == "true" || s == "1"
+	}
+	return s
+}
+
+// tilesetVariant converts a <tileset> element, either a reference to an
+// external tileset or a complete one.
+func tilesetVariant(n *xmlNode) variant {
+	v := attrs(n, false)
+	if _, external := v["source"]; external {
+		return v
+	}
+	v["type"] = "tileset"
+	tiles := []interface{}{}
+	for i := range n.Children {
+		c := &n.Children[i]
+		switch c.XMLName.Local {
+		case "image":
+			imageVariant(c, v)
+		case "tileoffset":
+			v["tileoffset"] = attrs(c, false)
+		case "grid":
+			v["grid"] = attrs(c, false)
+		case "properties":
+			v["properties"] = propertiesVariant(c)
+		case "terraintypes":
+			var ts []interface{}
+			for j := range c.Children {
+				t := attrs(&c.Children[j], false)
+				if p := c.Children[j].child("properties"); p != nil {
+					t["properties"] = propertiesVariant(p)
+				}
+				ts = append(ts, t)
+			}
+			v["terrains"] = ts
+		case "tile":
+			tiles = append(tiles, tileVariant(c))
+		case "wangsets":
+			var ws []interface{}
+			for j := range c.Children {
+				ws = append(ws, wangsetVariant(&c.Children[j]))
+			}
+			v["wangsets"] = ws
+		case "transformations":
+			v["transformations"] = attrs(c, false)
+		}
+	}
+	if len(tiles) > 0 {
+		v["tiles"] = tiles
+	}
+	return v
+}
+
+// imageVariant copies an <image> element into the fields of a tileset or
+// tile.
+func imageVariant(img *xmlNode, v variant) {
+	a := attrs(img, false)
+	v["image"] = a["source"]
+	if w, ok := a["width"]; ok {
+		v["imagewidth"] = w
+	}
+	if h, ok := a["height"]; ok {
+		v["imageheight"] = h
+	}
+	if t, ok := a["trans"]; ok {
+		v["transparentcolor"] = "#" + t.(string)
+	}
+}
+
+// tileVariant converts the <tile> element of a tileset.
+func tileVariant(n *xmlNode) variant {
+	v := attrs(n, false)
+	if t, ok := v["terrain"].(string); ok {
+		// corners are comma separated and empty when there is no terrain
+		var corners []interface{}
+		for _, f := range strings.Split(t, ",") {
+			c, e := strconv.ParseFloat(f, 64)
+			if e != nil {
+				c = -1
+			}
+			corners = append(corners, c)
+		}
+		v["terrain"] = corners
+	}
+	for i := range n.Children {
+		c := &n.Children[i]
+		switch c.XMLName.Local {
+		case "image":
+			imageVariant(c, v)
+		case "properties":
+			v["properties"] = propertiesVariant(c)
+		case objectLayer:
+			og := attrs(c, true)
+			og["type"] = objectLayer
+			objs := []interface{}{}
+			for j := range c.Children {
+				if c.Children[j].XMLName.Local == "object" {
+					objs = append(objs, objectVariant(&c.Children[j]))
+				}
+			}
+			og["objects"] = objs
+			v["objectgroup"] = og
+		case "animation":
+			var frames []interface{}
+			for j := range c.Children {
+				frames = append(frames, attrs(&c.Children[j], false))
+			}
+			v["animation"] = frames
+		}
+	}
+	return v
+}
+
+// wangsetVariant converts a <wangset> element, in either the format before
+// Tiled 1.5 with separate corner and edge colors or the unified one.
+func wangsetVariant(n *xmlNode) variant {
+	v := attrs(n, false)
+	var corners, edges, colors, tiles []interface{}
+	for i := range n.Children {
+		c := &n.Children[i]
+		switch c.XMLName.Local {
+		case "wangcornercolor":
+			corners = append(corners, attrs(c, false))
+		case "wangedgecolor":
+			edges = append(edges, attrs(c, false))
+		case "wangcolor":
+			wc := attrs(c, false)
+			if p := c.child("properties"); p != nil {
+				wc["properties"] = propertiesVariant(p)
+			}
+			colors = append(colors, wc)
+		case "wangtile":
+			wt := attrs(c, false)
+			id, _ := c.attr("wangid")
+			wt["wangid"] = wangIdVariant(id)
+			tiles = append(tiles, wt)
+		case "properties":
+			v["properties"] = propertiesVariant(c)
+		}
+	}
+	if corners != nil || edges != nil {
+		v["cornercolors"], v["edgecolors"] = corners, edges
+	}
+	if colors != nil {
+		v["colors"] = colors
+	}
+	v["wangtiles"] = tiles
+	return v
+}
+
+// wangIdVariant converts a wang id, which is either a hex number holding a
+// color in every four bits or a comma separated list.
+func wangIdVariant(s string) []interface{} {
+	ids := []interface{}{}
+	if strings.HasPrefix(s, "0x") {
+		n, _ := strconv.ParseUint(s[2:], 16, 32)
+		for i := uint(0); i < 8; i++ {
+			ids = append(ids, float64((n>>(i*4))&0xF))
+		}
+		return ids
+	}
+	for _, f := range strings.Split(s, ",") {
+		c, _ := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		ids = append(ids, c)
+	}
+	return ids
+}
+
+// templateVariant converts a <template> element.
+func templateVariant(n *xmlNode) variant {
+	v := variant{"type": "template"}
+	if ts := n.child("tileset"); ts != nil {
+		v["tileset"] = attrs(ts, false)
+	}
+	if o := n.child("object"); o != nil {
+		v["object"] = objectVariant(o)
+	}
+	return v
+}
@@ -0,0 +1,191 @@
+package tmx
+
+import "math"
+
+// Vec is a point or a vector in pixels.
+type Vec struct {
+	X, Y float64
+}
+
+// Add returns the sum of two vectors.
+func (v Vec) Add(u Vec) Vec {
+	return Vec{v.X + u.X, v.Y + u.Y}
+}
+
+// Sub returns the difference of two vectors.
+func (v Vec) Sub(u Vec) Vec {
+	return Vec{v.X - u.X, v.Y - u.Y}
+}
+
+// Rect is an axis aligned rectangle in pixels. Min is the top left corner and
+// Max the bottom right one.
+type Rect struct {
+	Min, Max Vec
+}
+
+// Width returns the width of the rectangle.
+func (r Rect) Width() float64 {
+	return r.Max.X - r.Min.X
+}
+
+// Height returns the height of the rectangle.
+func (r Rect) Height() float64 {
+	return r.Max.Y - r.Min.Y
+}
+
+// Empty returns whether the rectangle has no area.
+func (r Rect) Empty() bool {
+	return r.Max.X <= r.Min.X || r.Max.Y <= r.Min.Y
+}
+
+// Contains returns whether a point is inside the rectangle, edges included.
+func (r Rect) Contains(p Vec) bool {
+	return p.X >= r.Min.X && p.X <= r.Max.X && p.Y >= r.Min.Y && p.Y <= r.Max.Y
+}
+
+// Overlaps returns whether two rectangles share any points.
+func (r Rect) Overlaps(s Rect) bool {
+	return r.Min.X <= s.Max.X && s.Min.X <= r.Max.X &&
+		r.Min.Y <= s.Max.Y && s.Min.Y <= r.Max.Y
+}
+
+// Union returns the smallest rectangle that contains both rectangles.
+func (r Rect) Union(s Rect) Rect {
+	return Rect{
+		Min: Vec{math.Min(r.Min.X, s.Min.X), math.Min(r.Min.Y, s.Min.Y)},
+		Max: Vec{math.Max(r.Max.X, s.Max.X), math.Max(r.Max.Y, s.Max.Y)},
+	}
+}
+
+// boundsOf returns the bounding box of a set of points.
+func boundsOf(ps []Vec) (r Rect) {
+	if len(ps) == 0 {
+		return
+	}
+	r = Rect{Min: ps[0], Max: ps[0]}
+	for _, p := range ps[1:] {
+		r = r.Union(Rect{Min: p, Max: p})
+	}
+	return
+}
+
+// affine is a 2d affine transform mapping (x, y) to
+// (a*x + c*y + tx, b*x + d*y + ty).
+type affine struct {
+	a, b, c, d, tx, ty float64
+}
+
+// identity leaves every point where it is.
+var identity = affine{a: 1, d: 1}
+
+// translation moves points by an offset.
+func translation(x, y float64) affine {
+	return affine{a: 1, d: 1, tx: x, ty: y}
+}
+
+// scaling scales points away from the origin.
+func scaling(x, y float64) affine {
+	return affine{a: x, d: y}
+}
+
+// rotation rotates points about the origin by an angle in degrees, clockwise
+// since the y-axis points down.
+func rotation(deg float64) affine {
+	if deg == 0 {
+		return identity
+	}
+	s, c := math.Sincos(deg * math.Pi / 180)
+	return affine{a: c, b: s, c: -s, d: c}
+}
+
+// flipping applies the flip flags of a tile inside a box of the given size.
+// The diagonal flip swaps the axes first, then the horizontal and vertical
+// flips mirror the result, the same order Tiled uses.
+func flipping(w, h float64, hf, vf, df bool) affine {
+	t := identity
+	if df {
+		t = affine{b: 1, c: 1}
+		w, h = h, w
+	}
+	if hf {
+		t = affine{a: -1, d: 1, tx: w}.then(t)
+	}
+	if vf {
+		t = affine{a: 1, d: -1, ty: h}.then(t)
+	}
+	return t
+}
+
+// then returns the transform that applies u first and then t.
+func (t affine) then(u affine) affine {
+	return affine{
+		a:  t.a*u.a + t.c*u.b,
+		b:  t.b*u.a + t.d*u.b,
+		c:  t.a*u.c + t.c*u.d,
+		d:  t.b*u.c + t.d*u.d,
+		tx: t.a*u.tx + t.c*u.ty + t.tx,
+		ty: t.b*u.tx + t.d*u.ty + t.ty,
+	}
+}
+
+// apply transforms a point.
+func (t affine) apply(p Vec) Vec {
+	return Vec{t.a*p.X + t.c*p.Y + t.tx, t.b*p.X + t.d*p.Y + t.ty}
+}
+
+// vector transforms a direction, ignoring the translation.
+func (t affine) vector(p Vec) Vec {
+	return Vec{t.a*p.X + t.c*p.Y, t.b*p.X + t.d*p.Y}
+}
+
+// applyAll transforms a list of points into a new list.
+func (t affine) applyAll(ps []Vec) []Vec {
+	out := make([]Vec, len(ps))
+	for i, p := range ps {
+		out[i] = t.apply(p)
+	}
+	return out
+}
+
+// axisAligned returns whether the transform keeps axis aligned rectangles axis
+// aligned, which is the case for flips and multiples of 90 degrees.
+func (t affine) axisAligned() bool {
+	const eps = 1e-9
+	return (math.Abs(t.b) < eps && math.Abs(t.c) < eps) ||
+		(math.Abs(t.a) < eps && math.Abs(t.d) < eps)
+}
+
+// convex returns whether a polygon is convex.
+func convex(ps []Vec) bool {
+	if len(ps) < 3 {
+		return false
+	}
+	sign := 0.0
+	for i := range ps {
+		a, b, c := ps[i], ps[(i+1)%len(ps)], ps[(i+2)%len(ps)]
+		cross := (b.X-a.X)*(c.Y-b.Y) - (b.Y-a.Y)*(c.X-b.X)
+		if cross == 0 {
+			continue
+		}
+		if sign == 0 {
+			sign = cross
+		} else if (cross > 0) != (sign > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// pointInPolygon returns whether a point is inside a polygon using the even
+// odd rule.
+func pointInPolygon(ps []Vec, p Vec) bool {
+	in := false
+	for i, j := 0, len(ps)-1; i < len(ps); j, i = i, i+1 {
+		a, b := ps[i], ps[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) &&
+			p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+			in = !in
+		}
+	}
+	return in
+}
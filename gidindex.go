@@ -0,0 +1,153 @@
+package tmx
+
+import "sort"
+
+// gidIndex resolves global ids and tileset file names to tilesets without
+// scanning every tileset in the map.
+type gidIndex struct {
+	ranges []gidRange     // sorted by first gid
+	names  map[string]int // tileset file name to tileset index
+	tiles  []map[int]int  // per tileset, local id to index in Tiles
+}
+
+// gidRange is the span of global ids that belong to a tileset.
+type gidRange struct {
+	first, last uint32 // inclusive range of global ids
+	tileset     int    // index of the tileset in the map
+	collection  bool   // only the ids of the tiles in the tileset are valid
+}
+
+// indexTilesets builds the gid index for the map. It must be called again if
+// the tilesets are changed.
+func (m *tilemap) indexTilesets() {
+	idx := &gidIndex{
+		names: make(map[string]int),
+		tiles: make([]map[int]int, len(m.Tilesets)),
+	}
+	for i := 0; i < len(m.Tilesets); i++ {
+		t := &m.Tilesets[i]
+		// map the local ids to the tiles that carry metadata
+		ids := make(map[int]int, len(t.Tiles))
+		maxId := -1
+		for j := 0; j < len(t.Tiles); j++ {
+			ids[t.Tiles[j].Id] = j
+			if t.Tiles[j].Id > maxId {
+				maxId = t.Tiles[j].Id
+			}
+		}
+		idx.tiles[i] = ids
+		if t.IsCollection() {
+			// ids can have gaps so the range runs to the largest id
+			if maxId >= 0 {
+				idx.ranges = append(idx.ranges, gidRange{
+					first:      uint32(t.Firstgid),
+					last:       uint32(t.Firstgid + maxId),
+					tileset:    i,
+					collection: true,
+				})
+			}
+		} else if t.Tilecount > 0 {
+			idx.ranges = append(idx.ranges, gidRange{
+				first:   uint32(t.Firstgid),
+				last:    uint32(t.Firstgid + t.Tilecount - 1),
+				tileset: i,
+			})
+		}
+		// the first tileset with a given file name wins
+		n := filename(t.Source)
+		if _, ok := idx.names[n]; !ok {
+			idx.names[n] = i
+		}
+	}
+	sort.SliceStable(idx.ranges, func(i, j int) bool {
+		return idx.ranges[i].first < idx.ranges[j].first
+	})
+	m.index = idx
+}
+
+// gids returns the gid index, building it if the map wasn't loaded through
+// LoadTileMap.
+func (m *tilemap) gids() *gidIndex {
+	if m.index == nil {
+		m.indexTilesets()
+	}
+	return m.index
+}
+
+// find returns the index of the tileset a gid belongs to using a binary search
+// over the first gid of every tileset.
+func (idx *gidIndex) find(gid uint32) (int, bool) {
+	// the first range that starts after the gid
+	i := sort.Search(len(idx.ranges), func(i int) bool {
+		return idx.ranges[i].first > gid
+	})
+	if i == 0 {
+		return 0, false
+	}
+	r := idx.ranges[i-1]
+	if gid > r.last {
+		return 0, false
+	}
+	if r.collection {
+		// the tile has to exist in the collection
+		if _, ok := idx.tiles[r.tileset][int(gid-r.first)]; !ok {
+			return 0, false
+		}
+	}
+	return r.tileset, true
+}
+
+// TilesetForGid returns the tileset a global id belongs to along with the id of
+// the tile inside of that tileset. Any flip flags on the gid are ignored.
+func (m *tilemap) TilesetForGid(gid uint32) (*tileset, uint32, error) {
+	t, e := m.verifyGid(clearHighBits(gid))
+	if e != nil {
+		return nil, 0, e
+	}
+	return t, localId(clearHighBits(gid), t.Firstgid), nil
+}
+
+// GidRange returns the first and last global id of a tileset of the map. For
+// image collections the range runs to the largest tile id and may have gaps.
+// Tilesets without any tiles have no range.
+func (m *tilemap) GidRange(i int) (first, last uint32, ok bool) {
+	for _, r := range m.gids().ranges {
+		if r.tileset == i {
+			return r.first, r.last, true
+		}
+	}
+	return 0, 0, false
+}
+
+// tile returns the metadata of a tile in one of the tilesets, or nil if the
+// tile doesn't have any.
+func (m *tilemap) tile(ts int, lid uint32) *tile {
+	j, ok := m.gids().tiles[ts][int(lid)]
+	if !ok {
+		return nil
+	}
+	return &m.Tilesets[ts].Tiles[j]
+}
+
+// TileImage returns the region of an image that the tile with the given global
+// id is drawn from. Tiles in an image collection have an image of their own,
+// every other tile is a cell of the tileset image. Image paths are relative to
+// the map file.
+func (m *tilemap) TileImage(gid uint32) (r ImageRect, e error) {
+	gid = clearHighBits(gid)
+	i, ok := m.gids().find(gid)
+	if !ok {
+		return r, badGlobalId
+	}
+	t := &m.Tilesets[i]
+	lid := localId(gid, t.Firstgid)
+	if t.IsCollection() {
+		tl := m.tile(i, lid)
+		return ImageRect{
+			Source: t.imagePath(tl.Image),
+			Width:  tl.ImageWidth,
+			Height: tl.ImageHeight,
+		}, nil
+	}
+	return t.cell(lid), nil
+}
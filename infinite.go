@@ -0,0 +1,231 @@
+package tmx
+
+import "math"
+
+// CellRect is a rectangle of cells, Min is included and Max is not.
+type CellRect struct {
+	Min, Max Cell
+}
+
+// Width returns the number of columns in the rectangle.
+func (r CellRect) Width() int {
+	return r.Max.Col - r.Min.Col
+}
+
+// Height returns the number of rows in the rectangle.
+func (r CellRect) Height() int {
+	return r.Max.Row - r.Min.Row
+}
+
+// Empty returns whether the rectangle holds no cells.
+func (r CellRect) Empty() bool {
+	return r.Max.Col <= r.Min.Col || r.Max.Row <= r.Min.Row
+}
+
+// Contains returns whether a cell is inside the rectangle.
+func (r CellRect) Contains(c Cell) bool {
+	return c.Col >= r.Min.Col && c.Row >= r.Min.Row && c.Col < r.Max.Col && c.Row < r.Max.Row
+}
+
+// Union returns the smallest rectangle holding both rectangles.
+func (r CellRect) Union(s CellRect) CellRect {
+	if r.Empty() {
+		return s
+	}
+	if s.Empty() {
+		return r
+	}
+	return CellRect{
+		Min: Cell{minInt(r.Min.Col, s.Min.Col), minInt(r.Min.Row, s.Min.Row)},
+		Max: Cell{maxInt(r.Max.Col, s.Max.Col), maxInt(r.Max.Row, s.Max.Row)},
+	}
+}
+
+// chunkSize is the size of the chunks added to infinite layers, the size
+// Tiled uses by default.
+const chunkSize = 16
+
+// chunkIndex finds the chunks of an infinite layer by chunk coordinate, the
+// position of a chunk divided by the chunk size.
+type chunkIndex struct {
+	w, h    int          // size shared by every chunk
+	uniform bool         // whether every chunk has the same size
+	coords  map[Cell]int // chunk coordinate to index in Chunks
+}
+
+// indexChunks builds the chunk index of a layer from the chunk headers.
+func (l *layer) indexChunks() {
+	idx := &chunkIndex{uniform: true, coords: make(map[Cell]int, len(l.Chunks))}
+	for i := 0; i < len(l.Chunks); i++ {
+		c := &l.Chunks[i]
+		if i == 0 {
+			idx.w, idx.h = c.Width, c.Height
+		}
+		if c.Width != idx.w || c.Height != idx.h || c.Width <= 0 || c.Height <= 0 ||
+			floorDiv(c.X, idx.w)*idx.w != c.X || floorDiv(c.Y, idx.h)*idx.h != c.Y {
+			// chunks that don't line up with a single grid are searched
+			idx.uniform = false
+			continue
+		}
+		idx.coords[Cell{floorDiv(c.X, idx.w), floorDiv(c.Y, idx.h)}] = i
+	}
+	l.chunkIndex = idx
+}
+
+// Chunk returns the chunk at a chunk coordinate, the position of the chunk
+// in cells divided by the chunk size, or nil if there isn't one.
+func (l *layer) Chunk(cx, cy int) *chunk {
+	if l.chunkIndex == nil {
+		l.indexChunks()
+	}
+	if i, ok := l.chunkIndex.coords[Cell{cx, cy}]; ok {
+		return &l.Chunks[i]
+	}
+	return nil
+}
+
+// ChunkAt returns the chunk holding a cell, or nil if there isn't one.
+func (l *layer) ChunkAt(col, row int) *chunk {
+	if l.chunkIndex == nil {
+		l.indexChunks()
+	}
+	idx := l.chunkIndex
+	if idx.w > 0 && idx.h > 0 {
+		if c := l.Chunk(floorDiv(col, idx.w), floorDiv(row, idx.h)); c != nil {
+			return c
+		}
+	}
+	if idx.uniform {
+		return nil
+	}
+	for i := 0; i < len(l.Chunks); i++ {
+		c := &l.Chunks[i]
+		if col >= c.X && row >= c.Y && col < c.X+c.Width && row < c.Y+c.Height {
+			return c
+		}
+	}
+	return nil
+}
+
+// floorDiv divides rounding towards negative infinity.
+func floorDiv(a, b int) int {
+	return int(math.Floor(float64(a) / float64(b)))
+}
+
+// UsedBounds returns the smallest rectangle of cells holding every tile of a
+// tile layer, which is empty when the layer has no tiles.
+func (l *layer) UsedBounds() (r CellRect, e error) {
+	if e = l.Decode(); e != nil {
+		return
+	}
+	add := func(col, row int) {
+		r = r.Union(CellRect{Min: Cell{col, row}, Max: Cell{col + 1, row + 1}})
+	}
+	for i := 0; i < len(l.Chunks); i++ {
+		c := &l.Chunks[i]
+		for j, t := range c.Tiles() {
+			if !t.Nil() {
+				add(c.X+j%c.Width, c.Y+j/c.Width)
+			}
+		}
+	}
+	if len(l.Chunks) == 0 {
+		ts, _ := l.Tiles()
+		for j, t := range ts {
+			if !t.Nil() {
+				add(j%l.Width, j/l.Width)
+			}
+		}
+	}
+	return
+}
+
+// usedBounds returns the union of the used bounds of every tile layer in a
+// set of layers.
+func usedBounds(ls []layer) (r CellRect, e error) {
+	for i := 0; i < len(ls); i++ {
+		l := &ls[i]
+		var b CellRect
+		switch l.Type {
+		case groupLayer:
+			b, e = usedBounds(l.Layers)
+		case tileLayer:
+			b, e = l.UsedBounds()
+		}
+		if e != nil {
+			return
+		}
+		r = r.Union(b)
+	}
+	return
+}
+
+// UsedBounds returns the smallest rectangle of cells holding every tile of
+// every tile layer in the map.
+func (m *tilemap) UsedBounds() (CellRect, error) {
+	return usedBounds(m.Layers)
+}
+
+// ToFinite converts an infinite map into a finite one cropped to the used
+// bounds of its tile layers. Objects are moved along with the tiles so they
+// keep their place, following the orientation of the map. On staggered and
+// hexagonal maps the crop starts at an even row or column along the stagger
+// axis so that the same cells stay shifted. The map itself is left untouched,
+// and a finite map is returned as is.
+func (m *tilemap) ToFinite() (f tilemap, e error) {
+	if !m.Infinite {
+		return *m, nil
+	}
+	var r CellRect
+	if r, e = m.UsedBounds(); e != nil {
+		return
+	}
+	if !r.Empty() && (m.Orientation == staggered || m.Orientation == hexagonal) {
+		if m.staggerAxisX() {
+			r.Min.Col &^= 1
+		} else {
+			r.Min.Row &^= 1
+		}
+	}
+	f = *m
+	f.Infinite = false
+	f.Width, f.Height = r.Width(), r.Height()
+	f.queue = nil
+	// the top left cell of the crop becomes the top left cell of the finite map
+	shift := f.TileToPixel(0, 0).Sub(m.TileToPixel(r.Min.Col, r.Min.Row))
+	f.Layers = finiteLayers(m.Layers, r, shift)
+	return
+}
+
+// finiteLayers copies a set of layers, cropping the tile layers and moving
+// the objects.
+func finiteLayers(ls []layer, r CellRect, shift Vec) []layer {
+	out := make([]layer, len(ls))
+	for i := 0; i < len(ls); i++ {
+		l := &ls[i]
+		n := *l
+		n.lazy, n.chunkIndex, n.stream, n.Chunks = nil, nil, nil, nil
+		switch l.Type {
+		case groupLayer:
+			n.Layers = finiteLayers(l.Layers, r, shift)
+		case tileLayer:
+			n.X, n.Y = 0, 0
+			n.Width, n.Height = r.Width(), r.Height()
+			n.Encoding, n.Compression = csv, uncompressed
+			data := make([]*Tile, n.Width*n.Height)
+			for j := range data {
+				data[j] = l.TileAt(r.Min.Col+j%n.Width, r.Min.Row+j/n.Width)
+			}
+			n.Data = data
+		case objectLayer:
+			n.Objects = make([]object, len(l.Objects))
+			copy(n.Objects, l.Objects)
+			for j := range n.Objects {
+				n.Objects[j].X += shift.X
+				n.Objects[j].Y += shift.Y
+			}
+		}
+		out[i] = n
+	}
+	return out
+}
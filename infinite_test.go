@@ -0,0 +1,62 @@
+package tmx
+
+import (
+	"math"
+	"testing"
+)
+
+func TestToFinite(t *testing.T) {
+	cases := []struct {
+		orientation, axis, index string
+		side                     int
+	}{
+		{orientation: orthogonal},
+		{orientation: isometric},
+		{orientation: staggered, axis: "y", index: "odd"},
+		{orientation: staggered, axis: staggerX, index: staggerEven},
+		{orientation: hexagonal, axis: "y", index: "odd", side: 8},
+		{orientation: hexagonal, axis: staggerX, index: staggerEven, side: 8},
+	}
+	for _, c := range cases {
+		m, e := LoadTileMap("testdata/infinite.json")
+		if e != nil {
+			t.Fatal(e)
+		}
+		m.Orientation, m.StaggerAxis, m.StaggerIndex, m.HexSideLength = c.orientation, c.axis, c.index, c.side
+		ground := &m.Layers[0]
+		used, e := ground.UsedBounds()
+		if e != nil {
+			t.Fatal(e)
+		}
+		// an object on the center of every used cell
+		var cells []Cell
+		things := layer{Name: "things", Type: objectLayer}
+		for row := used.Min.Row; row < used.Max.Row; row++ {
+			for col := used.Min.Col; col < used.Max.Col; col++ {
+				if !ground.TileAt(col, row).Nil() {
+					p := m.TileCenter(col, row)
+					cells = append(cells, Cell{col, row})
+					things.Objects = append(things.Objects, object{Id: len(cells), X: p.X, Y: p.Y, Point: true})
+				}
+			}
+		}
+		m.Layers = append(m.Layers, things)
+		ground = &m.Layers[0]
+
+		f, e := m.ToFinite()
+		if e != nil {
+			t.Fatalf("%s: %v", c.orientation, e)
+		}
+		for i, o := range f.Layers[1].Objects {
+			// the object is still on the center of the same tile
+			col, row := f.PixelToTile(Vec{o.X, o.Y})
+			if f.Layers[0].TileAt(col, row) != ground.TileAt(cells[i].Col, cells[i].Row) {
+				t.Errorf("%s %s: object on cell %v is on cell %d,%d of the finite map", c.orientation, c.axis, cells[i], col, row)
+				continue
+			}
+			if p := f.TileCenter(col, row); math.Hypot(p.X-o.X, p.Y-o.Y) > 1e-9 {
+				t.Errorf("%s %s: object on cell %v is at %v, not the center %v", c.orientation, c.axis, cells[i], Vec{o.X, o.Y}, p)
+			}
+		}
+	}
+}
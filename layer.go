@@ -1,5 +1,17 @@
 package tmx
 
+import (
+  "encoding/json"
+  "errors"
+)
+
+var (
+  // tile setting errors
+  outsideLayer    = errors.New("the cell is outside of the layer")
+  chunkNotDecoded = errors.New("the chunk holding the cell isn't decoded")
+  streamedEdit    = errors.New("maps loaded with StreamChunks can't be edited")
+)
+
 type layer struct {
   Name             string      `json:"name"`             // name of the layer
   Type             string      `json:"type"`             // type of layer
@@ -22,6 +34,9 @@ type layer struct {
   Chunks           []chunk     `json:"chunks"`           // infinte map gids
   Objects          []object    `json:"objects"`          // array of objects
   Properties       []property  `json:"properties"`       // list of properties
+  lazy             *lazyLayer                                // deferred decoding
+  chunkIndex       *chunkIndex                               // chunk lookup
+  stream           *chunkCache                               // streamed chunks
 }
 
 type chunk struct {
@@ -30,4 +45,212 @@ type chunk struct {
   Width  int         `json:"width"`  // width in tiles
   Height int         `json:"height"` // height in tiles
   Data   interface{} `json:"data"`   // unsigned int (gids) or base64-encoded
-}
\ No newline at end of file
+  raw    interface{}                 // encoded data kept when streaming
+}
+
+// UnmarshalJSON decodes a layer, defaulting to fully opaque and visible the
+// same as Tiled does when those fields are left out.
+func (l *layer) UnmarshalJSON(b []byte) error {
+  // the alias doesn't have this method, which keeps it from recursing
+  type plain layer
+  p := plain{Opacity: 1, Visible: true}
+  if e := json.Unmarshal(b, &p); e != nil {
+    return e
+  }
+  *l = layer(p)
+  return nil
+}
+
+// Decode decodes the tile data of a layer loaded with LazyDecoding. The data is
+// only decoded once, and it is safe to call from multiple goroutines.
+func (l *layer) Decode() error {
+  if l.lazy == nil {
+    // the data was decoded when the map was loaded
+    return nil
+  }
+  d := l.lazy
+  d.once.Do(func() {
+    d.e = d.m.processLayer(d.l)
+  })
+  if l != d.l {
+    // this is a copy of the layer, pick up the decoded data
+    l.Data, l.Chunks = d.l.Data, d.l.Chunks
+  }
+  return d.e
+}
+
+// Tiles returns the tiles of a finite tile layer, decoding them first if
+// necessary.
+func (l *layer) Tiles() ([]*Tile, error) {
+  if e := l.Decode(); e != nil {
+    return nil, e
+  }
+  t, _ := l.Data.([]*Tile)
+  return t, nil
+}
+
+// Tiles returns the tiles of a chunk, or nil if the chunk hasn't been decoded.
+func (c chunk) Tiles() []*Tile {
+  t, _ := c.Data.([]*Tile)
+  return t
+}
+
+// LayerFilter picks out layers. A nil filter accepts every layer.
+type LayerFilter func(l *layer) bool
+
+// LayersNamed accepts the layers with one of the given names. Group layers
+// are always accepted so that the layers inside of them can be reached.
+func LayersNamed(names ...string) LayerFilter {
+  return func(l *layer) bool {
+    if l.Type == groupLayer {
+      return true
+    }
+    for _, n := range names {
+      if l.Name == n {
+        return true
+      }
+    }
+    return false
+  }
+}
+
+// VisibleLayers accepts the layers that are visible.
+func VisibleLayers() LayerFilter {
+  return func(l *layer) bool {
+    return l.Visible
+  }
+}
+
+// LayersWithProperty accepts the layers with a bool property of the given
+// name set to true. Group layers are always accepted.
+func LayersWithProperty(name string) LayerFilter {
+  return func(l *layer) bool {
+    if l.Type == groupLayer {
+      return true
+    }
+    p, ok := findProperty(l.Properties, name)
+    if !ok {
+      return false
+    }
+    b, _ := p.Value.(bool)
+    return b
+  }
+}
+
+// TileAt returns the tile at a cell of a tile layer, looking through the
+// chunks of infinite maps. Cells that are empty or outside of the layer give
+// a nil tile, one where Nil returns true, and so do the cells of streamed
+// chunks that aren't decoded. On streamed maps it is safe to call while
+// LoadRegion runs on another goroutine.
+func (l *layer) TileAt(col, row int) *Tile {
+  if l.Decode() != nil {
+    return nilTile
+  }
+  if len(l.Chunks) > 0 {
+    c := l.ChunkAt(col, row)
+    if c == nil {
+      return nilTile
+    }
+    if l.stream != nil {
+      // LoadRegion decodes and drops chunk data under the lock
+      l.stream.mu.Lock()
+      defer l.stream.mu.Unlock()
+    }
+    if ts := c.Tiles(); len(ts) == c.Width*c.Height {
+      return ts[(row-c.Y)*c.Width+(col-c.X)]
+    }
+    return nilTile
+  }
+  if col < 0 || row < 0 || col >= l.Width || row >= l.Height {
+    return nilTile
+  }
+  ts, _ := l.Tiles()
+  if len(ts) != l.Width*l.Height {
+    return nilTile
+  }
+  return ts[row*l.Width+col]
+}
+
+// SetTileAt sets the tile at a cell of a tile layer to a global id, which may
+// carry flip flags. Infinite layers get a new chunk for a cell outside of every
+// chunk, while the cells of finite layers have to be inside of the layer. Maps
+// loaded with StreamChunks can't be edited, since their chunks are dropped
+// back to the data in the file whenever they are evicted.
+func (m *tilemap) SetTileAt(l *layer, col, row int, gid uint32) error {
+  if m.streaming() {
+    return streamedEdit
+  }
+  if e := l.Decode(); e != nil {
+    return e
+  }
+  t, e := m.makeTile(gid)
+  if e != nil {
+    return e
+  }
+  if len(l.Chunks) == 0 && !m.Infinite {
+    if col < 0 || row < 0 || col >= l.Width || row >= l.Height {
+      return outsideLayer
+    }
+    ts, _ := l.Data.([]*Tile)
+    if ts == nil {
+      // a layer without any data starts out empty
+      ts = make([]*Tile, l.Width*l.Height)
+      for i := range ts {
+        ts[i] = nilTile
+      }
+      l.Data = ts
+    }
+    if len(ts) != l.Width*l.Height {
+      return dataSizeMismatch
+    }
+    ts[row*l.Width+col] = t
+    return nil
+  }
+  c := l.ChunkAt(col, row)
+  if c == nil {
+    // new chunks line up with the chunks that are already there
+    w, h := chunkSize, chunkSize
+    if idx := l.chunkIndex; idx.uniform && idx.w > 0 && idx.h > 0 {
+      w, h = idx.w, idx.h
+    }
+    ts := make([]*Tile, w*h)
+    for i := range ts {
+      ts[i] = nilTile
+    }
+    x, y := floorDiv(col, w)*w, floorDiv(row, h)*h
+    l.Chunks = append(l.Chunks, chunk{X: x, Y: y, Width: w, Height: h, Data: ts})
+    l.indexChunks()
+    c = l.ChunkAt(col, row)
+  }
+  ts := c.Tiles()
+  if len(ts) != c.Width*c.Height {
+    return chunkNotDecoded
+  }
+  ts[(row-c.Y)*c.Width+(col-c.X)] = t
+  return nil
+}
+
+// NestedLayer is a layer of a map along with the group it sits in.
+type NestedLayer struct {
+  Layer  *layer // the layer
+  Parent *layer // group the layer is in, nil at the top level
+  Depth  int    // number of groups the layer is in
+}
+
+// AllLayers returns every layer of the map in document order, each group
+// followed by the layers inside of it.
+func (m *tilemap) AllLayers() []NestedLayer {
+  return nestedLayers(m.Layers, nil, 0, nil)
+}
+
+// nestedLayers appends a set of layers and the layers inside of them.
+func nestedLayers(ls []layer, parent *layer, depth int, out []NestedLayer) []NestedLayer {
+  for i := 0; i < len(ls); i++ {
+    l := &ls[i]
+    out = append(out, NestedLayer{Layer: l, Parent: parent, Depth: depth})
+    if l.Type == groupLayer {
+      out = nestedLayers(l.Layers, l, depth+1, out)
+    }
+  }
+  return out
+}
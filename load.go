@@ -2,18 +2,21 @@ package tmx
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sync"
 )
 
 // path to the tile map from the current working directory
 var mapDirectory string
 
 // LoadTileMap reads in a tilemap from disk, sends the data out to be
-// processed, and finally returns a tilemap.
-func LoadTileMap(fp string) (m tilemap, e error) {
+// processed, and finally returns a tilemap. Options change when and how the
+// tile data of each layer is decoded.
+func LoadTileMap(fp string, opts ...Option) (m tilemap, e error) {
 	// get path to the map directory so relative paths can be resolved from there
 	if e = resolveMapPath(fp); e != nil {
 		return
@@ -23,19 +26,86 @@ func LoadTileMap(fp string) (m tilemap, e error) {
 	if b, e = read(fp); e == nil {
 		// store the json data into tilemap
 		if e = decode(b, &m); e == nil {
+			m.dir = mapDirectory
+			m.applyOptions(opts)
+			if m.opts.tolerant {
+				m.problems = &problems{}
+			}
 			// determine if there are external tilesets and load them if necessary
-			if e = processTilesets(&m.Tilesets); e != nil {
+			if e = processTilesets(&m.Tilesets, m.tilesetProblems); e != nil {
 				return
 			}
+			// index the gid ranges of the tilesets for quick lookups
+			m.indexTilesets()
 			// decode and if necessary decompress all layer data to a workable format
 			if e = m.processLayers(&m.Layers); e != nil {
 				return
 			}
+			// decode any tile data that was queued up to be decoded in parallel
+			if e = m.runQueue(); e != nil {
+				return
+			}
 		}
 	}
 	return
 }
 
+// problem is something wrong with a map that a Tolerant load kept going past.
+type problem struct {
+	check   string   // name of the check Validate reports it under
+	tileset *tileset // tileset the problem is in, if any
+	layer   *layer   // layer the problem is in, if any
+	object  int      // id of the object the problem is with, if any
+	e       error
+}
+
+// problems are the problems recorded while loading a map. Tile data may be
+// decoded from several goroutines, hence the lock.
+type problems struct {
+	mu   sync.Mutex
+	list []problem
+}
+
+// tolerate records a problem and drops its error when the map is loaded with
+// Tolerant, otherwise it returns the error. Each place only records its first
+// problem of a kind, so a layer with many broken chunks is reported once.
+func (m *tilemap) tolerate(p problem) error {
+	if p.e == nil || m.problems == nil {
+		return p.e
+	}
+	ps := m.problems
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, q := range ps.list {
+		if q.check == p.check && q.tileset == p.tileset && q.layer == p.layer && q.object == p.object {
+			return nil
+		}
+	}
+	ps.list = append(ps.list, p)
+	return nil
+}
+
+// tilesetProblems tolerates the problems with the tilesets of the map.
+func (m *tilemap) tilesetProblems(i int, e error) error {
+	return m.tolerate(problem{check: checkTileset, tileset: &m.Tilesets[i], e: e})
+}
+
+// objectProblems returns a function that tolerates the problems with the
+// objects of a layer.
+func (m *tilemap) objectProblems(l *layer, check string) func(i int, e error) error {
+	return func(i int, e error) error {
+		return m.tolerate(problem{check: check, layer: l, object: l.Objects[i].Id, e: e})
+	}
+}
+
+// fileError describes a file that a map refers to but that can't be loaded.
+func fileError(kind, fp string, e error) error {
+	if os.IsNotExist(e) {
+		return fmt.Errorf("%s %q does not exist", kind, fp)
+	}
+	return fmt.Errorf("%s %q can't be loaded: %v", kind, fp, e)
+}
+
 // loadTileset reads in a tileset from disk, and returns a external tileset.
 func loadTileset(fp string) (ts external, e error) {
 	// reslove path
@@ -62,9 +132,14 @@ func loadTemplate(fp string) (t template, e error) {
 	return
 }
 
-// read loads a file from the disk and reads it into a byte array.
+// read loads a file from the disk and reads it into a byte array. Files in the
+// xml format are converted to json so they decode the same way.
 func read(fp string) ([]byte, error) {
-	return ioutil.ReadFile(fp)
+	b, e := ioutil.ReadFile(fp)
+	if e != nil || FormatOf(fp) != FormatTMX {
+		return b, e
+	}
+	return tmxToJSON(b)
 }
 
 // decode takes an array of bytes and places the data inside the provided
@@ -81,7 +156,11 @@ func resolveMapPath(fp string) error {
 		return e
 	}
 	dir, _ := filepath.Split(fp)
-	mapDirectory = filepath.FromSlash(path.Join(pwd, dir))
+	if filepath.IsAbs(dir) {
+		// absolute paths don't need the working directory
+		pwd = empty
+	}
+	mapDirectory = filepath.FromSlash(path.Join(pwd, filepath.ToSlash(dir)))
 	return nil
 }
 
@@ -90,11 +169,6 @@ func externalFilePath(fp string) string {
 	return filepath.FromSlash(path.Join(mapDirectory, fp))
 }
 
-// matchTilesetName returns whether the names of the tilesets are equal.
-func matchTilesetName(fp1, fp2 string) bool {
-	return filename(fp1) == filename(fp2)
-}
-
 // filename strips off the path from a filepath, and returns the filename.
 func filename(fp string) string {
 	_, f := filepath.Split(fp)
@@ -1,9 +1,8 @@
 package tmx
 
 const (
-  // chunk size in bytes  
-  infiniteChunkSize = 16*16*numBytes
-  numBytes          = 4 
+  // bytes per tile  
+  numBytes = 4 
 )
 
 const (
@@ -35,6 +34,12 @@ type tilemap struct {
   Layers          []layer    `json:"layers"`          // layers
   Tilesets        []tileset  `json:"tilesets"`        // tilesets
   Properties      []property `json:"properties"`      // a list of properties
+  opts            options                                 // load options
+  queue           []job                                   // tile data to decode
+  index           *gidIndex                               // gid lookup
+  cache           *chunkCache                             // streamed chunks
+  problems        *problems                               // kept by Tolerant
+  dir             string                                  // map directory
 }
 
 // processLayers determines what data needs processed for a given map.
@@ -52,8 +57,9 @@ func (m *tilemap) processLayers(ls *[]layer) (e error) {
       }
     
     case tileLayer:
-      // process the tile data
-      e = m.processLayer(l) 
+      // process the tile data now, later, or in parallel depending on the 
+      // load options
+      e = m.scheduleLayer(l)
       if e != nil {
         return
       }
@@ -61,17 +67,15 @@ func (m *tilemap) processLayers(ls *[]layer) (e error) {
     case objectLayer:
       // load in template files and transform template objects into proper 
       // objects
-      e = processTemplates(&(l.Objects))
+      e = processTemplates(&(l.Objects), m.objectProblems(l, checkTemplate))
       if e != nil {
         return
       }
       // find objects that are tiles, adjust gids, and set flags
-      e = m.processTileObjects(&(l.Objects))
+      e = m.processTileObjects(&(l.Objects), m.objectProblems(l, checkTemplate))
       if e != nil {
         return
       }
-      // adjust the points of the polygons and polylines
-      translatePoints(&(l.Objects))
     }
   }
   return
@@ -80,25 +84,14 @@ func (m *tilemap) processLayers(ls *[]layer) (e error) {
 // processLayer determines where the tile data is stored in the map and sends 
 // it out for processing.
 func (m *tilemap) processLayer(l *layer) (e error) {
-  if m.Infinite {
-    // tile data is in the chunks
-    for j := 0; j < len(l.Chunks); j++ {
-      c := &l.Chunks[j]
-      if e = m.processTileData(&c.Data, *l); e != nil {
-          return
-      } 
-    }
-  } else {
-    // tile data is in the layer
-    if e = m.processTileData(&l.Data, *l); e != nil {
-        return
-    } 
-  }
-  return
+  // tile data is either in the chunks or in the layer, chunks are independent
+  // of each other so they may be decoded in parallel
+  return runJobs(m.layerJobs(l), m.opts.workers)
 }
 
-// processTileData sends the tile data out to be decoded and extracted.
-func (m *tilemap) processTileData(d *interface{}, l layer) (e error) {
+// processTileData sends the tile data out to be decoded and extracted, n is
+// the number of tiles the data should hold.
+func (m *tilemap) processTileData(d *interface{}, l layer, n int) (e error) {
   // make sure the pointer is not nil before a dereference
   if d == nil {
     return nilDataPtr
@@ -121,77 +114,88 @@ func (m *tilemap) processTileData(d *interface{}, l layer) (e error) {
     return 
   }  
   // check for flipped tiles
-  return m.extractTileData(d)      
+  return m.extractTileData(d, n)      
 }
 
 // extractTileData extracts and correlates information about each tile and 
 // repackages it for consumption.
-func (m *tilemap) extractTileData(d *interface{}) (e error) {
+func (m *tilemap) extractTileData(d *interface{}, n int) (e error) {
   // make sure the data is a byte array
   b, ok := (*d).([]byte)
   if !ok {
     return highBitDataMismatch
   }
   // make sure there is enough data for every tile
-  if m.Infinite && len(b) != infiniteChunkSize {
-    return dataSizeMismatch
-  }
-  if !m.Infinite && len(b) != (m.Width * m.Height * numBytes) {
+  if len(b) != n * numBytes {
     return dataSizeMismatch
   }
 
   var data []*Tile 
   for i := 0; i < len(b); i += numBytes {
-    // shift the bytes back into a variable
-    n := compressBytes(b[i:])
-    if n == 0 {
-      // there isn't a tile at this location
-      data = append(data, nilTile)
-      continue
+    // shift the bytes back into a variable and build the tile
+    g := compressBytes(b[i:])
+    t, e := m.makeTile(g)
+    if e == badGlobalId && m.opts.tolerant {
+      // keep the gid for Validate to report
+      h,v,d := flipFlags(g)
+      t, e   = &Tile{gid: clearHighBits(g), horizontialFlip: h, verticalFlip: v, diagonalFlip: d}, nil
     }
-    
-    // clear the high bits from the gid and get the flip flags
-    gid   := clearHighBits(n)
-    h,v,d := flipFlags(n)
-    
-    // verify that the gid is a valid id
-    var t *tileset
-    t, e = m.verifyGid(gid)
     if e != nil {
-      return
+      return e
     }
-
-    // add the tile into the container
-    data = append(data, &Tile{ 
-      // set the global and local ids
-      gid: gid, lid: localId(gid, t.Firstgid),
-      // set pointer to the tileset that this gid belongs to
-      tileset: t.Source,
-      // set flip flags
-      horizontialFlip: h, verticalFlip: v, diagonalFlip: d,
-      nil: false })  
+    data = append(data, t)
   }
   // reset the data container
   *d = data
   return
 }
 
- // verifyGid confirms a gid is a valid id for a tile in one of the tilesets.
+// makeTile builds the tile for a global id that may carry flip flags in its
+// high bits.
+func (m *tilemap) makeTile(n uint32) (*Tile, error) {
+  if n == 0 {
+    // there isn't a tile at this location
+    return nilTile, nil
+  }
+  
+  // clear the high bits from the gid and get the flip flags
+  gid   := clearHighBits(n)
+  h,v,d := flipFlags(n)
+  
+  // verify that the gid is a valid id
+  ts, ok := m.gids().find(gid)
+  if !ok {
+    return nil, badGlobalId
+  }
+  t   := &m.Tilesets[ts]
+  lid := localId(gid, t.Firstgid)
+
+  return &Tile{ 
+    // set the global and local ids
+    gid: gid, lid: lid,
+    // set pointer to the tileset that this gid belongs to
+    tileset: t.Source,
+    // link back to the tileset and the metadata of the tile
+    set: t, info: m.tile(ts, lid),
+    // set flip flags
+    horizontialFlip: h, verticalFlip: v, diagonalFlip: d,
+    nil: false }, nil
+}
+
+// verifyGid confirms a gid is a valid id for a tile in one of the tilesets.
 func (m *tilemap) verifyGid(gid uint32) (t *tileset, e error) {
-  for i := 0; i < len(m.Tilesets); i++ {
-    t := &m.Tilesets[i]
-    lastId := (t.Firstgid + t.Tilecount) - 1
-    // if the global id is in this tileset
-    if int(gid) >= t.Firstgid && int(gid) <= lastId {
-      return t, nil
-    }
+  i, ok := m.gids().find(gid)
+  if !ok {
+    return nil, badGlobalId
   }
-  return nil, badGlobalId
+  return &m.Tilesets[i], nil
 }
 
 // processTileObjects checks for objects that are from a tileset and extracts 
-// the gid and flip flags of the tile and saves them to the object. 
-func (m *tilemap) processTileObjects(objs *[]object) (e error) {
+// the gid and flip flags of the tile and saves them to the object. Templates
+// whose tileset isn't in the map are handed to tolerate, and gids that aren't
+// in any tileset are left for Validate to report when loading is tolerant.
+func (m *tilemap) processTileObjects(objs *[]object, tolerate func(i int, e error) error) (e error) {
   for i := 0; i < len(*objs); i++ {
     o := &(*objs)[i]
 
@@ -204,8 +208,21 @@ func (m *tilemap) processTileObjects(objs *[]object) (e error) {
       (*o).DiagonalFlip    = d
       // strip out the flags
       (*o).Gid = int(clearHighBits(uint32(o.Gid)))
-      // verify that there is a matching tileset
-      if e = m.matchTileset(o); e != nil {
+      // templates number their tiles from the tileset of the template
+      if o.Template != empty {
+        if e = m.matchTileset(o); e != nil {
+          if e = tolerate(i, e); e != nil {
+            return
+          }
+          continue
+        }
+      }
+      // verify the gid and link the object to its tileset
+      if e = m.linkTileset(o); e == badGlobalId && m.opts.tolerant {
+        e = nil
+        continue
+      }
+      if e != nil {
         return
       }
     }
@@ -215,16 +232,26 @@ func (m *tilemap) processTileObjects(objs *[]object) (e error) {
 
 // matchTileset compares the tileset of a template with the list of loaded
 // tileset to verify that there is a tileset loaded for the template. It sets
-// the local and global ids of the object.
+// the global id of the object.
 func (m *tilemap) matchTileset(o *object) (e error) {
-  for i := 0; i < len(m.Tilesets); i++ {
-    t := m.Tilesets[i] 
-    if matchTilesetName(t.Source, o.Source) {
-      (*o).Lid = o.Gid
-      (*o).Gid += (t.Firstgid - 1)
-      _, e = m.verifyGid(uint32(o.Gid))
-      return 
-    } 
+  i, ok := m.gids().names[filename(o.Source)]
+  if !ok {
+    return noMatchingTileset
   }
-  return noMatchingTileset
+  t := m.Tilesets[i]
+  (*o).Gid += (t.Firstgid - 1)
+  return
 }
+
+// linkTileset verifies the global id of a tile object, sets its local id, and
+// links it to its tileset so its image can be placed.
+func (m *tilemap) linkTileset(o *object) (e error) {
+  var t *tileset
+  if t, e = m.verifyGid(uint32(o.Gid)); e != nil {
+    return
+  }
+  (*o).Lid    = int(localId(uint32(o.Gid), t.Firstgid))
+  (*o).set    = t
+  (*o).anchor = t.anchor(m.Orientation)
+  return
+}
\ No newline at end of file
@@ -0,0 +1,717 @@
+package tmx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	// merge errors
+	streamedMerge = errors.New("maps loaded with StreamChunks can't be merged")
+)
+
+var (
+	// json fields that aren't merged field by field
+	mapSkip    = []string{"layers", "tilesets", "properties", "nextobjectid", "nextlayerid"}
+	layerSkip  = []string{"id", "type", "x", "y", "width", "height", "data", "layers", "chunks", "objects", "properties"}
+	objectSkip = []string{"id", "template", "gid", "properties"}
+)
+
+// Conflict is a change both sides of a merge made in different ways. The
+// merged map keeps our side of it.
+type Conflict struct {
+	Layer  int         `json:"layer,omitempty"`  // id of the layer, zero for the map and objects
+	Object int         `json:"object,omitempty"` // id of the object, zero for the map and layers
+	Cell   *Cell       `json:"cell,omitempty"`   // cell of a tile conflict
+	Field  string      `json:"field"`            // what both sides changed
+	Base   interface{} `json:"base"`             // value the sides started from
+	Ours   interface{} `json:"ours"`             // value our side changed it to
+	Theirs interface{} `json:"theirs"`           // value their side changed it to
+}
+
+// String returns a line like "layer 2 tile 3,4: base 1, ours 5, theirs 7".
+func (c Conflict) String() string {
+	var at []string
+	if c.Layer != 0 {
+		at = append(at, fmt.Sprintf("layer %d", c.Layer))
+	}
+	if c.Object != 0 {
+		at = append(at, fmt.Sprintf("object %d", c.Object))
+	}
+	if c.Cell != nil {
+		at = append(at, fmt.Sprintf("tile %d,%d", c.Cell.Col, c.Cell.Row))
+	}
+	if len(at) == 0 {
+		at = append(at, "map")
+	}
+	if c.Cell == nil || c.Field != "tile" {
+		at = append(at, c.Field)
+	}
+	s := strings.Join(at, " ") + ": "
+	if c.Base != nil {
+		s += fmt.Sprintf("base %v, ", c.Base)
+	}
+	return s + fmt.Sprintf("ours %v, theirs %v", c.Ours, c.Theirs)
+}
+
+// mergeSide is one of the three versions of a map in a merge.
+type mergeSide struct {
+	m       *tilemap
+	layers  map[int]*layer       // layers by id
+	objects map[int]placedObject // objects by id
+	same    bool                 // whether it has the tilesets of the merged map
+}
+
+// newMergeSide indexes a version of a map, decoding all of its tile data.
+func newMergeSide(m *tilemap) (*mergeSide, error) {
+	if m.streaming() {
+		return nil, streamedMerge
+	}
+	s := &mergeSide{m: m, layers: make(map[int]*layer), objects: objectsById(m)}
+	for _, n := range m.AllLayers() {
+		if e := n.Layer.Decode(); e != nil {
+			return nil, e
+		}
+		s.layers[n.Layer.Id] = n.Layer
+	}
+	return s, nil
+}
+
+// merger holds the state of a three-way merge.
+type merger struct {
+	base, ours, theirs *mergeSide
+	m                  *tilemap
+	cs                 []Conflict
+	layerIds           map[int]int      // new ids of layers both sides added under one id
+	objects            map[int][]object // merged objects by the id of their layer
+}
+
+// Merge merges the changes two sides made to a common base version of a map.
+// Tiles are merged cell by cell and objects by id, field by field, so the
+// sides only conflict where they changed the same cell or the same field of
+// the same layer or object. The merged map keeps our side of every conflict.
+//
+// Layers keep the order of ours, with the layers theirs added placed after
+// the layer they follow. Layers and objects that both sides added under the
+// same id get new ids. Tile ids of either side are moved onto the tilesets of
+// the merged map, which are taken whole from the side that changed them.
+func Merge(base, ours, theirs *tilemap) (m tilemap, cs []Conflict, e error) {
+	mg := &merger{m: &m, layerIds: make(map[int]int), objects: make(map[int][]object)}
+	if mg.base, e = newMergeSide(base); e != nil {
+		return
+	}
+	if mg.ours, e = newMergeSide(ours); e != nil {
+		return
+	}
+	if mg.theirs, e = newMergeSide(theirs); e != nil {
+		return
+	}
+	m = *ours
+	m.queue, m.index, m.cache = nil, nil, nil
+
+	mg.mapFields()
+	mg.tilesets()
+	mg.renumberLayers()
+	mg.mergeObjects()
+	if m.Layers, e = mg.layers(ours.Layers, 0); e != nil {
+		return
+	}
+	mg.removedLayers()
+	mg.strayObjects()
+	return m, mg.cs, nil
+}
+
+// mergeValue merges one value three ways. It returns the merged value and
+// whether both sides changed it in different ways, in which case ours wins.
+func mergeValue(b, o, t interface{}) (interface{}, bool) {
+	switch {
+	case reflect.DeepEqual(o, t), reflect.DeepEqual(b, t):
+		return o, false
+	case reflect.DeepEqual(b, o):
+		return t, false
+	}
+	return o, true
+}
+
+// jsonFields returns the indexes of the fields of a structure type that have a
+// json name, other than the ones in skip.
+func jsonFields(t reflect.Type, skip []string) (fs []int) {
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("json")
+		if name == empty {
+			continue
+		}
+		skipped := false
+		for _, s := range skip {
+			if s == name {
+				skipped = true
+			}
+		}
+		if !skipped {
+			fs = append(fs, i)
+		}
+	}
+	return
+}
+
+// mergeFields merges the json fields of three versions of a structure into
+// dst, which starts out as a copy of ours. The fields both sides changed are
+// passed to conflict by their json name.
+func mergeFields(dst, b, o, t interface{}, conflict func(field string, b, o, t interface{}), skip ...string) {
+	d := reflect.ValueOf(dst).Elem()
+	bv, ov, tv := reflect.ValueOf(b).Elem(), reflect.ValueOf(o).Elem(), reflect.ValueOf(t).Elem()
+	for _, i := range jsonFields(d.Type(), skip) {
+		bf, of, tf := bv.Field(i).Interface(), ov.Field(i).Interface(), tv.Field(i).Interface()
+		v, c := mergeValue(bf, of, tf)
+		if c {
+			conflict(d.Type().Field(i).Tag.Get("json"), bf, of, tf)
+		}
+		d.Field(i).Set(reflect.ValueOf(v))
+	}
+}
+
+// fieldsEqual returns whether two versions of a structure agree on their json
+// fields, other than the ones in skip.
+func fieldsEqual(a, b interface{}, skip []string) bool {
+	av, bv := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	for _, i := range jsonFields(av.Type(), skip) {
+		if !reflect.DeepEqual(av.Field(i).Interface(), bv.Field(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeProperties merges three versions of a list of properties by name. The
+// properties keep the order of ours, the ones only theirs has go at the end.
+func mergeProperties(b, o, t []property, conflict func(field string, b, o, t interface{})) (out []property) {
+	find := func(ps []property, name string) interface{} {
+		if p, ok := findProperty(ps, name); ok {
+			return p
+		}
+		return nil
+	}
+	value := func(p interface{}) interface{} {
+		if p == nil {
+			return nil
+		}
+		return p.(property).Value
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, ps := range [][]property{o, t, b} {
+		for _, p := range ps {
+			if !seen[p.Name] {
+				seen[p.Name] = true
+				names = append(names, p.Name)
+			}
+		}
+	}
+	for _, name := range names {
+		bp, op, tp := find(b, name), find(o, name), find(t, name)
+		v, c := mergeValue(bp, op, tp)
+		if c {
+			conflict("property:"+name, value(bp), value(op), value(tp))
+		}
+		if v != nil {
+			out = append(out, v.(property))
+		}
+	}
+	return
+}
+
+// fieldConflict returns a function that records the conflicts of the fields
+// of the map, a layer, or an object.
+func (mg *merger) fieldConflict(layer, object int) func(string, interface{}, interface{}, interface{}) {
+	return func(field string, b, o, t interface{}) {
+		mg.cs = append(mg.cs, Conflict{Layer: layer, Object: object, Field: field, Base: b, Ours: o, Theirs: t})
+	}
+}
+
+// mapFields merges the attributes and properties of the map.
+func (mg *merger) mapFields() {
+	b, o, t := mg.base.m, mg.ours.m, mg.theirs.m
+	conflict := mg.fieldConflict(0, 0)
+	mergeFields(mg.m, b, o, t, conflict, mapSkip...)
+	mg.m.Properties = mergeProperties(b.Properties, o.Properties, t.Properties, conflict)
+	mg.m.Nextobjectid = maxInt(o.Nextobjectid, t.Nextobjectid)
+	mg.m.NextLayerId = maxInt(o.NextLayerId, t.NextLayerId)
+}
+
+// tilesets picks the tilesets of the merged map. They are merged as a whole,
+// since changing one tileset moves the global ids of the ones after it.
+func (mg *merger) tilesets() {
+	b, o, t := mg.base.m.Tilesets, mg.ours.m.Tilesets, mg.theirs.m.Tilesets
+	ts, c := mergeValue(b, o, t)
+	if c {
+		mg.cs = append(mg.cs, Conflict{Field: "tilesets", Base: tilesetNames(b), Ours: tilesetNames(o), Theirs: tilesetNames(t)})
+	}
+	mg.m.Tilesets = append([]tileset(nil), ts.([]tileset)...)
+	mg.m.indexTilesets()
+	for _, s := range []*mergeSide{mg.base, mg.ours, mg.theirs} {
+		s.same = reflect.DeepEqual(s.m.Tilesets, mg.m.Tilesets)
+	}
+}
+
+// tilesetNames returns the names of a list of tilesets.
+func tilesetNames(ts []tileset) []string {
+	names := make([]string, len(ts))
+	for i := range ts {
+		names[i] = ts[i].Name
+	}
+	return names
+}
+
+// gid moves a global id of one side onto the tilesets of the merged map. It
+// fails when the merged map doesn't have the tileset of the tile.
+func (mg *merger) gid(s *mergeSide, raw uint32) (uint32, bool) {
+	if raw == 0 || s.same {
+		return raw, true
+	}
+	t, lid, e := s.m.TilesetForGid(raw)
+	if e != nil {
+		return 0, false
+	}
+	for i := range mg.m.Tilesets {
+		n := &mg.m.Tilesets[i]
+		if n.Name == t.Name && n.Source == t.Source {
+			return uint32(n.Firstgid) + lid | raw&(horizontalFlag|verticalFlag|diagonalFlag), true
+		}
+	}
+	return 0, false
+}
+
+// cell returns the global id at a cell of a layer of one side, moved onto the
+// tilesets of the merged map.
+func (mg *merger) cell(s *mergeSide, l *layer, col, row int) (uint32, bool) {
+	return mg.gid(s, rawGids([]*Tile{l.TileAt(col, row)})[0])
+}
+
+// cells returns the cells a tile layer of one side covers.
+func (mg *merger) cells(s *mergeSide, l *layer) CellRect {
+	// the tile data was decoded up front, so this can't fail
+	r, _ := layerCells(s.m, l)
+	return r
+}
+
+// sameTiles returns whether two versions of a tile layer have the same size
+// and tiles.
+func (mg *merger) sameTiles(as *mergeSide, a *layer, bs *mergeSide, b *layer) bool {
+	if !mg.m.Infinite && (a.X != b.X || a.Y != b.Y || a.Width != b.Width || a.Height != b.Height) {
+		return false
+	}
+	r := mg.cells(as, a).Union(mg.cells(bs, b))
+	for row := r.Min.Row; row < r.Max.Row; row++ {
+		for col := r.Min.Col; col < r.Max.Col; col++ {
+			ag, aok := mg.cell(as, a, col, row)
+			bg, bok := mg.cell(bs, b, col, row)
+			if ag != bg || aok != bok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// layerChanged returns whether two versions of a layer differ in their fields,
+// properties, or tiles. Objects are merged on their own.
+func (mg *merger) layerChanged(as *mergeSide, a *layer, bs *mergeSide, b *layer) bool {
+	if !fieldsEqual(a, b, layerSkip) || !reflect.DeepEqual(a.Properties, b.Properties) {
+		return true
+	}
+	return a.Type == tileLayer && !mg.sameTiles(as, a, bs, b)
+}
+
+// renumberLayers gives new ids to the layers theirs added under an id that
+// ours used for a different layer of its own.
+func (mg *merger) renumberLayers() {
+	ids := make([]int, 0, len(mg.theirs.layers))
+	for id := range mg.theirs.layers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if mg.base.layers[id] != nil {
+			continue
+		}
+		o := mg.ours.layers[id]
+		if o != nil && mg.layerChanged(mg.ours, o, mg.theirs, mg.theirs.layers[id]) {
+			mg.layerIds[id] = mg.m.NextLayerId
+			mg.m.NextLayerId++
+		}
+	}
+}
+
+// layerId returns the id a layer of theirs has in the merged map.
+func (mg *merger) layerId(id int) int {
+	if n, ok := mg.layerIds[id]; ok {
+		return n
+	}
+	return id
+}
+
+// addedByTheirs returns whether only theirs has a layer, counting the layers
+// both sides added under the same id that were renumbered.
+func (mg *merger) addedByTheirs(t *layer) bool {
+	if mg.base.layers[t.Id] != nil {
+		return false
+	}
+	_, renumbered := mg.layerIds[t.Id]
+	return mg.ours.layers[t.Id] == nil || renumbered
+}
+
+// layers merges a list of our layers, the layers of a group or of the map
+// when parent is zero. Layers theirs removed are dropped unless ours changed
+// them, and layers theirs added to the same group are put in.
+func (mg *merger) layers(ls []layer, parent int) (out []layer, e error) {
+	for i := 0; i < len(ls); i++ {
+		o := &ls[i]
+		b, t := mg.base.layers[o.Id], mg.theirs.layers[o.Id]
+		if b == nil {
+			// a layer theirs has under the same id is a layer of its own
+			t = nil
+		}
+		n := *o
+		n.lazy, n.chunkIndex = nil, nil
+		if b != nil && t != nil {
+			conflict := mg.fieldConflict(o.Id, 0)
+			mergeFields(&n, b, o, t, conflict, layerSkip...)
+			n.Properties = mergeProperties(b.Properties, o.Properties, t.Properties, conflict)
+		}
+		switch o.Type {
+		case groupLayer:
+			if n.Layers, e = mg.layers(o.Layers, o.Id); e != nil {
+				return
+			}
+		case tileLayer:
+			if e = mg.tiles(&n, b, o, t); e != nil {
+				return
+			}
+		case objectLayer:
+			n.Objects = mg.objects[o.Id]
+			delete(mg.objects, o.Id)
+		}
+		if b != nil && t == nil {
+			// theirs removed the layer, which only goes through if ours
+			// left it and everything in it alone
+			if !mg.layerChanged(mg.base, b, mg.ours, o) && len(n.Objects) == 0 && len(n.Layers) == 0 {
+				continue
+			}
+			mg.cs = append(mg.cs, Conflict{Layer: o.Id, Field: "removed", Ours: "modified", Theirs: "removed"})
+		}
+		out = append(out, n)
+	}
+
+	// the layers theirs added go after the layer they follow
+	var siblings []layer
+	if parent == 0 {
+		siblings = mg.theirs.m.Layers
+	} else if g := mg.theirs.layers[parent]; g != nil && mg.base.layers[parent] != nil {
+		siblings = g.Layers
+	}
+	for i := 0; i < len(siblings); i++ {
+		t := &siblings[i]
+		if !mg.addedByTheirs(t) {
+			continue
+		}
+		var n layer
+		if n, e = mg.added(t); e != nil {
+			return
+		}
+		at := len(out)
+		if i > 0 {
+			prev := mg.layerId(siblings[i-1].Id)
+			for j := range out {
+				if out[j].Id == prev {
+					at = j + 1
+				}
+			}
+		}
+		out = append(out, layer{})
+		copy(out[at+1:], out[at:])
+		out[at] = n
+	}
+	return
+}
+
+// added copies a layer only theirs has, along with the layers in it that only
+// theirs has.
+func (mg *merger) added(t *layer) (n layer, e error) {
+	n = *t
+	n.Id = mg.layerId(t.Id)
+	n.lazy, n.chunkIndex = nil, nil
+	switch t.Type {
+	case groupLayer:
+		n.Layers = nil
+		for i := 0; i < len(t.Layers); i++ {
+			if !mg.addedByTheirs(&t.Layers[i]) {
+				// layers ours has stay where ours put them
+				continue
+			}
+			var sub layer
+			if sub, e = mg.added(&t.Layers[i]); e != nil {
+				return
+			}
+			n.Layers = append(n.Layers, sub)
+		}
+	case tileLayer:
+		e = mg.copyTiles(mg.theirs, t, &n)
+	case objectLayer:
+		n.Objects = mg.objects[n.Id]
+		delete(mg.objects, n.Id)
+	}
+	return
+}
+
+// removedLayers reports the layers ours removed that theirs changed. They stay
+// removed.
+func (mg *merger) removedLayers() {
+	for _, nl := range mg.theirs.m.AllLayers() {
+		t := nl.Layer
+		b := mg.base.layers[t.Id]
+		if b != nil && mg.ours.layers[t.Id] == nil && mg.layerChanged(mg.base, b, mg.theirs, t) {
+			mg.cs = append(mg.cs, Conflict{Layer: t.Id, Field: "removed", Ours: "removed", Theirs: "modified"})
+		}
+	}
+}
+
+// tiles merges the tiles of a layer into n, a copy of our version of it.
+// Tiles are merged cell by cell, but a layer of a finite map that was resized
+// is taken whole from the side that changed it.
+func (mg *merger) tiles(n, b, o, t *layer) error {
+	if e := mg.copyTiles(mg.ours, o, n); e != nil || b == nil || t == nil {
+		return e
+	}
+	if !mg.m.Infinite && (o.X != t.X || o.Y != t.Y || o.Width != t.Width || o.Height != t.Height ||
+		b.X != o.X || b.Y != o.Y || b.Width != o.Width || b.Height != o.Height) {
+		switch {
+		case mg.sameTiles(mg.base, b, mg.ours, o):
+			return mg.copyTiles(mg.theirs, t, n)
+		case !mg.sameTiles(mg.base, b, mg.theirs, t):
+			size := func(l *layer) string { return fmt.Sprintf("%dx%d", l.Width, l.Height) }
+			mg.cs = append(mg.cs, Conflict{Layer: o.Id, Field: "size", Base: size(b), Ours: size(o), Theirs: size(t)})
+		}
+		return nil
+	}
+	r := mg.cells(mg.base, b).Union(mg.cells(mg.ours, o)).Union(mg.cells(mg.theirs, t))
+	for row := r.Min.Row; row < r.Max.Row; row++ {
+		for col := r.Min.Col; col < r.Max.Col; col++ {
+			bg, bok := mg.cell(mg.base, b, col, row)
+			og, ook := mg.cell(mg.ours, o, col, row)
+			tg, tok := mg.cell(mg.theirs, t, col, row)
+			switch {
+			case og == tg && ook == tok, bg == tg && bok == tok:
+				// theirs didn't change the cell, or made the same change
+			case bg == og && bok == ook && tok:
+				if e := mg.m.SetTileAt(n, col, row, tg); e != nil {
+					return e
+				}
+			case bg == og && bok == ook:
+				c := Cell{col, row}
+				mg.cs = append(mg.cs, Conflict{Layer: o.Id, Cell: &c, Field: "tileset", Theirs: rawGids([]*Tile{t.TileAt(col, row)})[0]})
+			default:
+				c := Cell{col, row}
+				mg.cs = append(mg.cs, Conflict{Layer: o.Id, Cell: &c, Field: "tile", Base: bg, Ours: og, Theirs: tg})
+			}
+		}
+	}
+	return nil
+}
+
+// copyTiles fills a tile layer of the merged map with the tiles of a layer of
+// one side. Tiles whose tileset the merged map doesn't have are left empty.
+func (mg *merger) copyTiles(s *mergeSide, src, dst *layer) (e error) {
+	dst.X, dst.Y, dst.Width, dst.Height = src.X, src.Y, src.Width, src.Height
+	dst.lazy, dst.chunkIndex = nil, nil
+	copyData := func(ts []*Tile, x, y, w int) ([]*Tile, error) {
+		out := make([]*Tile, len(ts))
+		for i, t := range ts {
+			raw := rawGids([]*Tile{t})[0]
+			g, ok := mg.gid(s, raw)
+			if !ok {
+				c := Cell{x + i%w, y + i/w}
+				cf := Conflict{Layer: dst.Id, Cell: &c, Field: "tileset", Ours: raw}
+				if s == mg.theirs {
+					cf.Ours, cf.Theirs = nil, raw
+				}
+				mg.cs = append(mg.cs, cf)
+			}
+			if out[i], e = mg.m.makeTile(g); e != nil {
+				return nil, e
+			}
+		}
+		return out, nil
+	}
+	if len(src.Chunks) == 0 {
+		ts, _ := src.Tiles()
+		var data []*Tile
+		if data, e = copyData(ts, 0, 0, maxInt(src.Width, 1)); e != nil {
+			return
+		}
+		dst.Data, dst.Chunks = data, nil
+		return
+	}
+	dst.Data = nil
+	dst.Chunks = make([]chunk, len(src.Chunks))
+	for i := range src.Chunks {
+		c := src.Chunks[i]
+		var data []*Tile
+		if data, e = copyData(c.Tiles(), c.X, c.Y, maxInt(c.Width, 1)); e != nil {
+			return
+		}
+		dst.Chunks[i] = chunk{X: c.X, Y: c.Y, Width: c.Width, Height: c.Height, Data: data}
+	}
+	return
+}
+
+// layerOf returns the id of the layer an object of one side is in, as an id
+// of the merged map.
+func (mg *merger) layerOf(s *mergeSide, p placedObject) int {
+	if s == mg.theirs {
+		return mg.layerId(p.l.Id)
+	}
+	return p.l.Id
+}
+
+// objectChanged returns whether two versions of an object differ.
+func (mg *merger) objectChanged(as *mergeSide, a placedObject, bs *mergeSide, b placedObject) bool {
+	ag, _ := mg.gid(as, objectGid(a.o))
+	bg, _ := mg.gid(bs, objectGid(b.o))
+	return ag != bg || mg.layerOf(as, a) != mg.layerOf(bs, b) ||
+		!fieldsEqual(a.o, b.o, objectSkip) || !reflect.DeepEqual(a.o.Properties, b.o.Properties)
+}
+
+// copyObject copies an object along with its points and properties.
+func copyObject(o *object) object {
+	n := *o
+	n.Polygon = append([]point(nil), o.Polygon...)
+	n.Polyline = append([]point(nil), o.Polyline...)
+	n.Properties = append([]property(nil), o.Properties...)
+	return n
+}
+
+// setGid makes an object the tile with a global id of the merged map.
+func (mg *merger) setGid(o *object, gid uint32) bool {
+	o.Gid = int(clearHighBits(gid))
+	o.HorizontialFlip, o.VerticalFlip, o.DiagonalFlip = flipFlags(gid)
+	if o.Gid == 0 {
+		o.Lid, o.set = 0, nil
+		return true
+	}
+	return mg.m.linkTileset(o) == nil
+}
+
+// relink moves a tile object of one side onto the tilesets of the merged map.
+func (mg *merger) relink(s *mergeSide, o *object) {
+	if o.Gid == 0 {
+		return
+	}
+	raw := objectGid(o)
+	if g, ok := mg.gid(s, raw); ok && mg.setGid(o, g) {
+		return
+	}
+	c := Conflict{Object: o.Id, Field: "tileset", Ours: raw}
+	if s == mg.theirs {
+		c.Ours, c.Theirs = nil, raw
+	}
+	mg.cs = append(mg.cs, c)
+}
+
+// place puts a merged object into a layer.
+func (mg *merger) place(layer int, o object) {
+	mg.objects[layer] = append(mg.objects[layer], o)
+}
+
+// mergeObjects merges the objects of the map by id and sorts them by the layer
+// they end up in. Our objects keep their order, the ones theirs added go at
+// the end of their layer.
+func (mg *merger) mergeObjects() {
+	bs, os, ts := mg.base.objects, mg.ours.objects, mg.theirs.objects
+	for _, nl := range mg.ours.m.AllLayers() {
+		for i := range nl.Layer.Objects {
+			id := nl.Layer.Objects[i].Id
+			op := os[id]
+			bp, inBase := bs[id]
+			tp, inTheirs := ts[id]
+			switch {
+			case inBase && inTheirs:
+				mg.object(bp, op, tp)
+				continue
+			case inBase && !mg.objectChanged(mg.base, bp, mg.ours, op):
+				// theirs removed it
+				continue
+			case inBase:
+				mg.cs = append(mg.cs, Conflict{Object: id, Field: "removed", Ours: "modified", Theirs: "removed"})
+			}
+			n := copyObject(op.o)
+			mg.relink(mg.ours, &n)
+			mg.place(op.l.Id, n)
+		}
+	}
+	for _, id := range sortedIds(ts) {
+		tp := ts[id]
+		bp, inBase := bs[id]
+		op, inOurs := os[id]
+		switch {
+		case inBase && !inOurs:
+			if mg.objectChanged(mg.base, bp, mg.theirs, tp) {
+				mg.cs = append(mg.cs, Conflict{Object: id, Field: "removed", Ours: "removed", Theirs: "modified"})
+			}
+		case !inBase && (!inOurs || mg.objectChanged(mg.ours, op, mg.theirs, tp)):
+			n := copyObject(tp.o)
+			if inOurs {
+				// both sides added an object under the same id
+				n.Id = mg.m.Nextobjectid
+				mg.m.Nextobjectid++
+			}
+			mg.relink(mg.theirs, &n)
+			mg.place(mg.layerOf(mg.theirs, tp), n)
+		}
+	}
+}
+
+// object merges an object that every side has, field by field.
+func (mg *merger) object(bp, op, tp placedObject) {
+	n := *op.o
+	conflict := mg.fieldConflict(0, n.Id)
+	mergeFields(&n, bp.o, op.o, tp.o, conflict, objectSkip...)
+	n.Properties = mergeProperties(bp.o.Properties, op.o.Properties, tp.o.Properties, conflict)
+	n = copyObject(&n)
+
+	bg, _ := mg.gid(mg.base, objectGid(bp.o))
+	og, _ := mg.gid(mg.ours, objectGid(op.o))
+	tg, tok := mg.gid(mg.theirs, objectGid(tp.o))
+	mg.relink(mg.ours, &n)
+	if g, c := mergeValue(bg, og, tg); c {
+		conflict("gid", bg, og, tg)
+	} else if g.(uint32) != og {
+		if !tok || !mg.setGid(&n, tg) {
+			mg.cs = append(mg.cs, Conflict{Object: n.Id, Field: "tileset", Theirs: objectGid(tp.o)})
+		}
+	}
+
+	l, c := mergeValue(bp.l.Id, op.l.Id, mg.layerOf(mg.theirs, tp))
+	if c {
+		conflict("layer", bp.l.Id, op.l.Id, mg.layerOf(mg.theirs, tp))
+	}
+	mg.place(l.(int), n)
+}
+
+// strayObjects reports the objects whose layer didn't make it into the merged
+// map, which happens when ours removed a layer that theirs added objects to.
+// The objects are dropped.
+func (mg *merger) strayObjects() {
+	ids := make([]int, 0, len(mg.objects))
+	for id := range mg.objects {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		for _, o := range mg.objects[id] {
+			mg.cs = append(mg.cs, Conflict{Object: o.Id, Field: "layer", Ours: "removed", Theirs: id})
+		}
+	}
+}
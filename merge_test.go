@@ -0,0 +1,131 @@
+package tmx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	set := func(m *tilemap, col, row int, gid uint32) {
+		if e := m.SetTileAt(&m.Layers[0], col, row, gid); e != nil {
+			t.Fatal(e)
+		}
+	}
+	rock := func(m *tilemap) *object { return &m.Layers[1].Objects[0] }
+	spawn := func(m *tilemap) *object { return &m.Layers[1].Objects[1] }
+	cases := []struct {
+		name         string
+		ours, theirs func(m *tilemap)
+		conflicts    []string
+		check        func(m *tilemap) bool
+	}{
+		{
+			name: "cells",
+			ours: func(m *tilemap) {
+				set(m, 0, 0, 4)
+				set(m, 1, 1, 2)
+				set(m, 2, 2, 1)
+			},
+			theirs: func(m *tilemap) {
+				set(m, 3, 2, 1)
+				set(m, 1, 1, 2)
+				set(m, 2, 2, 2)
+			},
+			conflicts: []string{"layer 1 tile 2,2: base 0, ours 1, theirs 2"},
+			check: func(m *tilemap) bool {
+				ts, e := m.Layers[0].Tiles()
+				return e == nil && reflect.DeepEqual(rawGids(ts), []uint32{4, 1, 2, 2, 1, 2, 3, 2, 4, 4, 1, 1})
+			},
+		},
+		{
+			name: "object fields",
+			ours: func(m *tilemap) {
+				rock(m).X = 0
+				spawn(m).Properties[0].Value = "blue"
+			},
+			theirs: func(m *tilemap) {
+				rock(m).X = 48
+				rock(m).Name = "boulder"
+				spawn(m).Y = 0
+				spawn(m).Properties[0].Value = "green"
+			},
+			conflicts: []string{
+				"object 1 x: base 16, ours 0, theirs 48",
+				"object 2 property:team: base red, ours blue, theirs green",
+			},
+			check: func(m *tilemap) bool {
+				r, s := rock(m), spawn(m)
+				return r.Name == "boulder" && r.X == 0 && s.Y == 0 && s.Properties[0].Value == "blue"
+			},
+		},
+		{
+			name: "same id added",
+			ours: func(m *tilemap) {
+				m.Layers[1].Objects = append(m.Layers[1].Objects, object{Id: 3, Name: "chest"})
+				m.Nextobjectid = 4
+			},
+			theirs: func(m *tilemap) {
+				m.Layers[1].Objects = append(m.Layers[1].Objects, object{Id: 3, Name: "door"})
+				m.Nextobjectid = 4
+			},
+			check: func(m *tilemap) bool {
+				objs := m.Layers[1].Objects
+				return len(objs) == 4 && objs[2].Id == 3 && objs[2].Name == "chest" &&
+					objs[3].Id == 4 && objs[3].Name == "door" && m.Nextobjectid == 5
+			},
+		},
+		{
+			name:   "layer removed",
+			ours:   func(m *tilemap) { set(m, 0, 0, 4) },
+			theirs: func(m *tilemap) { m.Layers = m.Layers[:1] },
+			check:  func(m *tilemap) bool { return len(m.Layers) == 1 },
+		},
+		{
+			name:   "modified layer removed",
+			ours:   func(m *tilemap) { rock(m).Y = 0 },
+			theirs: func(m *tilemap) { m.Layers = m.Layers[:1] },
+			conflicts: []string{
+				"object 1 removed: ours modified, theirs removed",
+				"layer 2 removed: ours modified, theirs removed",
+			},
+			check: func(m *tilemap) bool {
+				return len(m.Layers) == 2 && len(m.Layers[1].Objects) == 1 && rock(m).Y == 0
+			},
+		},
+		{
+			name:      "removed layer modified",
+			ours:      func(m *tilemap) { m.Layers = m.Layers[1:] },
+			theirs:    func(m *tilemap) { set(m, 0, 0, 4) },
+			conflicts: []string{"layer 1 removed: ours removed, theirs modified"},
+			check: func(m *tilemap) bool {
+				return len(m.Layers) == 1 && m.Layers[0].Id == 2
+			},
+		},
+	}
+	load := func() tilemap {
+		m, e := LoadTileMap("testdata/base.json")
+		if e != nil {
+			t.Fatal(e)
+		}
+		return m
+	}
+	for _, c := range cases {
+		base, ours, theirs := load(), load(), load()
+		c.ours(&ours)
+		c.theirs(&theirs)
+		m, cs, e := Merge(&base, &ours, &theirs)
+		if e != nil {
+			t.Fatalf("%s: %v", c.name, e)
+		}
+		var got []string
+		for _, cf := range cs {
+			got = append(got, cf.String())
+		}
+		if !reflect.DeepEqual(got, c.conflicts) {
+			t.Errorf("%s: conflicts %q, want %q", c.name, got, c.conflicts)
+		}
+		if !c.check(&m) {
+			t.Errorf("%s: merged map isn't right", c.name)
+		}
+	}
+}
@@ -1,10 +1,19 @@
 package tmx
 
-import "reflect"
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+)
+
+// ellipseSegments is the number of sides used when an ellipse is turned into
+// a polygon.
+const ellipseSegments = 32
 
 type object struct {
 	Name            string     `json:"name"`       // name field in editor
 	Type            string     `json:"type"`       // type field in editor
+	Class           string     `json:"class"`      // replaces type in tiled 1.9
 	Template        string     `json:"template"`   // path to a template file
 	Gid             int        `json:"gid"`        // global id
 	Id              int        `json:"id"`         // incremental id
@@ -17,14 +26,17 @@ type object struct {
 	Ellipse         bool       `json:"ellipse"`    // is object an ellipse
 	Point           bool       `json:"point"`      // is object a point
 	Text            text       `json:"text"`       // raw string of text object
-	Polygon         []point    `json:"polygon"`    // list of points x/y coords
-	Polyline        []point    `json:"polyline"`   // list of points x/y coords
+	Polygon         []point    `json:"polygon"`    // points relative to x/y
+	Polyline        []point    `json:"polyline"`   // points relative to x/y
 	Properties      []property `json:"properties"` // list of custom properties
 	Lid             int
 	Source          string
 	HorizontialFlip bool
 	VerticalFlip    bool
 	DiagonalFlip    bool
+	set             *tileset        // tileset of a tile object
+	anchor          Vec             // point of a tile object image at its position
+	fields          map[string]bool // fields the map file sets for the object
 }
 
 type text struct {
@@ -47,36 +59,76 @@ type template struct {
 	Tileset tileset `json:"tileset"` // abbreviated tile set
 }
 
+// UnmarshalJSON decodes an object, noting which of its fields the map file
+// sets. An object made from a template only overrides those, the same as in
+// Tiled, so it can still set a field back to zero.
+func (o *object) UnmarshalJSON(b []byte) error {
+	// the alias doesn't have this method, which keeps it from recursing
+	type plain object
+	var p plain
+	if e := json.Unmarshal(b, &p); e != nil {
+		return e
+	}
+	*o = object(p)
+	if o.Template == empty {
+		return nil
+	}
+	var keys map[string]json.RawMessage
+	if e := json.Unmarshal(b, &keys); e != nil {
+		return e
+	}
+	t := reflect.TypeOf(*o)
+	o.fields = make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := keys[t.Field(i).Tag.Get("json")]; ok {
+			o.fields[t.Field(i).Name] = true
+		}
+	}
+	return nil
+}
+
 // getTemplates minimizes the numbers of reads from the disk by calling load
-// template only once for each template file.
-func getTemplates(objs *[]object) (tmp map[string]template, e error) {
-	tmp = make(map[string]template)
+// template only once for each template file. Templates that fail to load are
+// returned apart with their errors.
+func getTemplates(objs *[]object) (tmp map[string]template, failed map[string]error) {
+	tmp, failed = make(map[string]template), make(map[string]error)
 	for i := 0; i < len(*(objs)); i++ {
 		o := &(*objs)[i]
-		if o.Template != empty {
-			if t, loaded := tmp[o.Template]; !loaded {
-				if t, e = loadTemplate(o.Template); e != nil {
-					return
-				}
-				tmp[o.Template] = t
+		if o.Template == empty || failed[o.Template] != nil {
+			continue
+		}
+		if _, loaded := tmp[o.Template]; !loaded {
+			t, e := loadTemplate(o.Template)
+			if e != nil {
+				failed[o.Template] = fileError("template", o.Template, e)
+				continue
 			}
+			tmp[o.Template] = t
 		}
 	}
 	return
 }
 
 // processTemplates determines if there are templates, if so it loads the
-// template, and applies it to the object.
-func processTemplates(objs *[]object) (e error) {
+// template, and applies it to the object. When a template can't be loaded the
+// error is handed to tolerate along with the index of each object using it,
+// and the objects are left as they are if it lets the error through.
+func processTemplates(objs *[]object, tolerate func(i int, e error) error) (e error) {
 	// load in the templates
-	tmp, er := getTemplates(objs)
-	// there was an error or none of the object are templates
-	if er != nil || len(tmp) == 0 {
-		return er
+	tmp, failed := getTemplates(objs)
+	// none of the object are templates
+	if len(tmp) == 0 && len(failed) == 0 {
+		return
 	}
 	for i := 0; i < len(*objs); i++ {
 		o := &(*objs)[i]
 		if o.Template != empty {
+			if fe := failed[o.Template]; fe != nil {
+				if e = tolerate(i, fe); e != nil {
+					return
+				}
+				continue
+			}
 			// get the template
 			t, loaded := tmp[o.Template]
 			if !loaded {
@@ -86,8 +138,8 @@ func processTemplates(objs *[]object) (e error) {
 			to := t.Object
 			// get the reflect value of the object and template object
 			src, dst := reflect.ValueOf(*o), reflect.ValueOf(&to).Elem()
-			// copy the fields of the src into the dst
-			if e = copyFields(&src, &dst); e != nil {
+			// copy the fields the object overrides into the dst
+			if e = copyFields(&src, &dst, o.fields); e != nil {
 				return
 			}
 			// insert new and overridden properties
@@ -133,22 +185,105 @@ func overridePoints(o, n []point) []point {
 	return n
 }
 
-// translatePoints adjusts the coordinates of polygons and polylines from being
-// relative coordinates to being global coordinates.
-func translatePoints(objs *[]object) {
-	for i := 0; i < len(*(objs)); i++ {
-		o := &(*objs)[i]
-		// if there are polygons, fix their points
-		for j := 0; j < len(o.Polygon); j++ {
-			p := &o.Polygon[j]
-			p.X += o.X
-			p.Y += o.Y
+// points returns a copy of the points of a polygon or polyline.
+func (o object) points() []Vec {
+	ps := o.Polygon
+	if len(ps) == 0 {
+		ps = o.Polyline
+	}
+	out := make([]Vec, len(ps))
+	for i, p := range ps {
+		out[i] = Vec{p.X, p.Y}
+	}
+	return out
+}
+
+// transform returns the transform from the local space of the object, where
+// its position is the origin, to map pixel space. Objects rotate about their
+// position, which is the top left corner of shapes and the anchor of tiles.
+func (o object) transform() affine {
+	return translation(o.X, o.Y).then(rotation(o.Rotation))
+}
+
+// tileBox returns the area the image of a tile object covers in local space,
+// placed by the object alignment and the tile offset of its tileset.
+func (o object) tileBox() Rect {
+	w, h := o.Width, o.Height
+	anchor := Vec{0, 1}
+	var off Vec
+	if o.set != nil {
+		if w == 0 || h == 0 {
+			w, h = o.set.tileSize(o.Lid)
 		}
-		// if there are polylines, fix their points
-		for j := 0; j < len(o.Polyline); j++ {
-			p := &o.Polyline[j]
-			p.X += o.X
-			p.Y += o.Y
+		anchor = o.anchor
+		off = Vec{float64(o.set.TileOffsets.X), float64(o.set.TileOffsets.Y)}
+	}
+	min := Vec{-anchor.X * w, -anchor.Y * h}.Add(off)
+	return Rect{Min: min, Max: min.Add(Vec{w, h})}
+}
+
+// localPolygon returns the outline of the object in local space.
+func (o object) localPolygon() []Vec {
+	switch {
+	case o.Gid != 0:
+		return rectPoints(o.tileBox())
+	case o.Point:
+		return []Vec{{}}
+	case o.Ellipse:
+		rx, ry := o.Width/2, o.Height/2
+		ps := make([]Vec, ellipseSegments)
+		for i := range ps {
+			s, c := math.Sincos(2 * math.Pi * float64(i) / ellipseSegments)
+			ps[i] = Vec{rx + rx*c, ry + ry*s}
 		}
+		return ps
+	case len(o.Polygon) > 0 || len(o.Polyline) > 0:
+		return o.points()
+	}
+	// rectangles and text
+	return rectPoints(Rect{Max: Vec{o.Width, o.Height}})
+}
+
+// WorldPoints returns the points of a polygon or polyline in map pixel space.
+// The points are worked out from the authored points, which stay relative to
+// the object, so they follow the object when it is moved or rotated.
+func (o object) WorldPoints() []Vec {
+	return o.transform().applyAll(o.points())
+}
+
+// WorldPolygon returns the outline of the object in map pixel space with its
+// rotation applied. Rectangles, text, and tile objects give their four
+// corners, ellipses are approximated by a polygon, polylines give their
+// points in order, and points give a single point.
+func (o object) WorldPolygon() []Vec {
+	return o.transform().applyAll(o.localPolygon())
+}
+
+// Bounds returns the axis aligned bounding box of the object in map pixel
+// space with its rotation applied.
+func (o object) Bounds() Rect {
+	if o.Ellipse && o.Gid == 0 {
+		// the extents of a rotated ellipse
+		t := o.transform()
+		c := t.apply(Vec{o.Width / 2, o.Height / 2})
+		a, b := t.vector(Vec{o.Width / 2, 0}), t.vector(Vec{0, o.Height / 2})
+		e := Vec{math.Hypot(a.X, b.X), math.Hypot(a.Y, b.Y)}
+		return Rect{Min: c.Sub(e), Max: c.Add(e)}
+	}
+	return boundsOf(o.WorldPolygon())
+}
+
+// rectPoints returns the corners of a rectangle clockwise from the top left.
+func rectPoints(r Rect) []Vec {
+	return []Vec{r.Min, {r.Max.X, r.Min.Y}, r.Max, {r.Min.X, r.Max.Y}}
+}
+
+// contains returns whether a point in map pixel space is inside the outline of
+// the object. Polylines and points have no inside, so any point within their
+// bounds counts.
+func (o object) contains(p Vec) bool {
+	if o.Gid == 0 && (o.Point || len(o.Polyline) > 0) {
+		return o.Bounds().Contains(p)
 	}
+	return pointInPolygon(o.WorldPolygon(), p)
 }
@@ -0,0 +1,107 @@
+package tmx
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTemplateOverrides(t *testing.T) {
+	type want struct {
+		name     string
+		class    string
+		x, y     float64
+		rotation float64
+		visible  bool
+	}
+	wants := []want{
+		// only the position is set, everything else comes from the template
+		{name: "crate", class: "box", x: 10, y: 20, rotation: 45, visible: false},
+		// the fields set back to zero or empty override the template
+		{name: "", class: "box", x: 0, y: 0, rotation: 0, visible: true},
+	}
+	for _, fp := range []string{"testdata/templates.json", "testdata/templates.tmx"} {
+		m, e := LoadTileMap(fp)
+		if e != nil {
+			t.Fatalf("%s: %v", fp, e)
+		}
+		objs := m.Layers[0].Objects
+		if len(objs) != len(wants) {
+			t.Fatalf("%s: got %d objects, want %d", fp, len(objs), len(wants))
+		}
+		for i, w := range wants {
+			o := objs[i]
+			got := want{o.Name, o.Type, o.X, o.Y, o.Rotation, o.Visible}
+			if got != w {
+				t.Errorf("%s: object %d = %+v, want %+v", fp, o.Id, got, w)
+			}
+			if o.Width != 16 || o.Height != 16 {
+				t.Errorf("%s: object %d is %gx%g, want the 16x16 of the template", fp, o.Id, o.Width, o.Height)
+			}
+		}
+	}
+}
+
+func TestObjectGeometry(t *testing.T) {
+	ts := &tileset{Firstgid: 1, Name: "ground", Tilewidth: 16, Tileheight: 16, Tilecount: 4}
+	centered := *ts
+	centered.ObjectAlignment = "center"
+	tileObject := func(o object, set *tileset) object {
+		o.Gid, o.set, o.anchor = 1, set, set.anchor(orthogonal)
+		return o
+	}
+	cases := []struct {
+		name    string
+		o       object
+		polygon []Vec
+		bounds  Rect
+	}{
+		{"rect", object{X: 5, Y: 5, Width: 10, Height: 20},
+			[]Vec{{5, 5}, {15, 5}, {15, 25}, {5, 25}}, Rect{Vec{5, 5}, Vec{15, 25}}},
+		// objects turn clockwise about their position
+		{"turned rect", object{X: 5, Y: 5, Width: 10, Height: 20, Rotation: 90},
+			[]Vec{{5, 5}, {5, 15}, {-15, 15}, {-15, 5}}, Rect{Vec{-15, 5}, Vec{5, 15}}},
+		// the bounds of an ellipse are exact rather than those of its polygon
+		{"turned ellipse", object{Width: 20, Height: 10, Ellipse: true, Rotation: 90},
+			nil, Rect{Vec{-10, 0}, Vec{0, 20}}},
+		{"polyline", object{X: 10, Y: 10, Rotation: 90, Polyline: []point{{0, 0}, {10, 0}}},
+			[]Vec{{10, 10}, {10, 20}}, Rect{Vec{10, 10}, Vec{10, 20}}},
+		{"point", object{X: 3, Y: 4, Point: true}, []Vec{{3, 4}}, Rect{Vec{3, 4}, Vec{3, 4}}},
+		// tile images sit on their bottom left corner by default
+		{"tile", tileObject(object{X: 32, Y: 48}, ts),
+			[]Vec{{32, 32}, {48, 32}, {48, 48}, {32, 48}}, Rect{Vec{32, 32}, Vec{48, 48}}},
+		{"turned tile", tileObject(object{X: 32, Y: 48, Rotation: 90}, ts),
+			[]Vec{{48, 48}, {48, 64}, {32, 64}, {32, 48}}, Rect{Vec{32, 48}, Vec{48, 64}}},
+		// flips mirror the image but not its outline
+		{"flipped tile", tileObject(object{X: 32, Y: 48, HorizontialFlip: true, DiagonalFlip: true}, ts),
+			[]Vec{{32, 32}, {48, 32}, {48, 48}, {32, 48}}, Rect{Vec{32, 32}, Vec{48, 48}}},
+		{"centered tile", tileObject(object{X: 100, Y: 100, Width: 32, Height: 16}, &centered),
+			[]Vec{{84, 92}, {116, 92}, {116, 108}, {84, 108}}, Rect{Vec{84, 92}, Vec{116, 108}}},
+	}
+	near := func(a, b Vec) bool { return math.Hypot(a.X-b.X, a.Y-b.Y) < 1e-9 }
+	for _, c := range cases {
+		if c.polygon != nil {
+			p := c.o.WorldPolygon()
+			ok := len(p) == len(c.polygon)
+			for i := 0; ok && i < len(p); i++ {
+				ok = near(p[i], c.polygon[i])
+			}
+			if !ok {
+				t.Errorf("%s: polygon %v, want %v", c.name, p, c.polygon)
+			}
+		}
+		if b := c.o.Bounds(); !near(b.Min, c.bounds.Min) || !near(b.Max, c.bounds.Max) {
+			t.Errorf("%s: bounds %v, want %v", c.name, b, c.bounds)
+		}
+	}
+
+	// the world points of a polyline follow the object when it moves
+	o := cases[3].o
+	o.X, o.Y = 0, 0
+	if p := o.WorldPoints(); len(p) != 2 || !near(p[1], Vec{0, 10}) {
+		t.Errorf("moved polyline points %v", p)
+	}
+	r := cases[1].o
+	if !r.contains(Vec{0, 10}) || r.contains(Vec{10, 10}) {
+		t.Errorf("turned rect contains the wrong points")
+	}
+}
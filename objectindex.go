@@ -0,0 +1,319 @@
+package tmx
+
+import (
+	"math"
+	"sort"
+)
+
+// ObjectIndex is a uniform grid over the world bounds of the objects in a map
+// that answers area and proximity queries without visiting every object.
+type ObjectIndex struct {
+	cell    float64                  // width and height of a grid cell
+	cells   map[[2]int][]*indexEntry // objects overlapping each cell
+	entries map[*object]*indexEntry  // the entry of every indexed object
+	seq     int                      // insertion counter for stable results
+	bounds  [4]int                   // cells covered by all the entries
+	placed  int                      // number of entries in the cells
+	stale   bool                     // an entry at the edge of bounds was removed
+}
+
+// indexEntry is an object in the index.
+type indexEntry struct {
+	o      *object
+	l      *layer
+	bounds Rect   // bounds of the object when it was indexed
+	span   [4]int // cells covered, min col, min row, max col, max row
+	seq    int    // order the object was added in
+}
+
+// ObjectFilter narrows down the objects a query returns. Empty fields match
+// every object.
+type ObjectFilter struct {
+	Layer string // name of the object layer
+	Type  string // type or class of the object
+}
+
+// match returns whether an entry passes the filter.
+func (f ObjectFilter) match(e *indexEntry) bool {
+	if f.Layer != empty && e.l.Name != f.Layer {
+		return false
+	}
+	if f.Type != empty && e.o.Type != f.Type && e.o.Class != f.Type {
+		return false
+	}
+	return true
+}
+
+// ObjectIndex builds a spatial index over every object in every object layer
+// of the map, group layers included. The grid cells are four tiles across.
+func (m *tilemap) ObjectIndex() *ObjectIndex {
+	size := 4 * float64(maxInt(m.Tilewidth, m.Tileheight))
+	if size <= 0 {
+		size = 64
+	}
+	x := &ObjectIndex{
+		cell:    size,
+		cells:   make(map[[2]int][]*indexEntry),
+		entries: make(map[*object]*indexEntry),
+	}
+	x.insertLayers(m.Layers)
+	return x
+}
+
+// insertLayers adds the objects of a set of layers to the index.
+func (x *ObjectIndex) insertLayers(ls []layer) {
+	for i := 0; i < len(ls); i++ {
+		l := &ls[i]
+		switch l.Type {
+		case groupLayer:
+			x.insertLayers(l.Layers)
+		case objectLayer:
+			for j := 0; j < len(l.Objects); j++ {
+				x.Insert(l, &l.Objects[j])
+			}
+		}
+	}
+}
+
+// Insert adds an object of a layer to the index. Inserting an object that is
+// already indexed updates it instead.
+func (x *ObjectIndex) Insert(l *layer, o *object) {
+	if _, ok := x.entries[o]; ok {
+		x.Update(o)
+		return
+	}
+	e := &indexEntry{o: o, l: l, seq: x.seq}
+	x.seq++
+	x.entries[o] = e
+	x.place(e)
+}
+
+// Remove takes an object out of the index.
+func (x *ObjectIndex) Remove(o *object) {
+	e, ok := x.entries[o]
+	if !ok {
+		return
+	}
+	x.unplace(e)
+	delete(x.entries, o)
+}
+
+// Update re-indexes an object after it was moved, resized, or rotated. Only
+// the cells the object left or entered are touched.
+func (x *ObjectIndex) Update(o *object) {
+	e, ok := x.entries[o]
+	if !ok {
+		return
+	}
+	b := o.Bounds()
+	if b == e.bounds {
+		return
+	}
+	if x.span(b) == e.span {
+		e.bounds = b
+		return
+	}
+	x.unplace(e)
+	x.place(e)
+}
+
+// Len returns the number of objects in the index.
+func (x *ObjectIndex) Len() int {
+	return len(x.entries)
+}
+
+// place adds an entry to every cell its bounds overlap.
+func (x *ObjectIndex) place(e *indexEntry) {
+	e.bounds = e.o.Bounds()
+	e.span = x.span(e.bounds)
+	if x.placed == 0 {
+		x.bounds, x.stale = e.span, false
+	} else {
+		x.bounds = unionSpan(x.bounds, e.span)
+	}
+	x.placed++
+	for r := e.span[1]; r <= e.span[3]; r++ {
+		for c := e.span[0]; c <= e.span[2]; c++ {
+			k := [2]int{c, r}
+			x.cells[k] = append(x.cells[k], e)
+		}
+	}
+}
+
+// unplace removes an entry from the cells it was placed in. The bounds are
+// only worked out again when the entry was at their edge, and not until they
+// are needed.
+func (x *ObjectIndex) unplace(e *indexEntry) {
+	x.placed--
+	b := e.span
+	if b[0] == x.bounds[0] || b[1] == x.bounds[1] || b[2] == x.bounds[2] || b[3] == x.bounds[3] {
+		x.stale = true
+	}
+	for r := e.span[1]; r <= e.span[3]; r++ {
+		for c := e.span[0]; c <= e.span[2]; c++ {
+			k := [2]int{c, r}
+			es := x.cells[k]
+			for i := range es {
+				if es[i] == e {
+					es = append(es[:i], es[i+1:]...)
+					break
+				}
+			}
+			if len(es) == 0 {
+				delete(x.cells, k)
+			} else {
+				x.cells[k] = es
+			}
+		}
+	}
+}
+
+// spanAll returns the cells covered by all the entries of the index.
+func (x *ObjectIndex) spanAll() [4]int {
+	if x.stale {
+		first := true
+		for _, e := range x.entries {
+			if first {
+				x.bounds, first = e.span, false
+				continue
+			}
+			x.bounds = unionSpan(x.bounds, e.span)
+		}
+		x.stale = false
+	}
+	return x.bounds
+}
+
+// unionSpan returns the block of cells covering two blocks.
+func unionSpan(a, b [4]int) [4]int {
+	return [4]int{minInt(a[0], b[0]), minInt(a[1], b[1]), maxInt(a[2], b[2]), maxInt(a[3], b[3])}
+}
+
+// span returns the cells a rectangle covers.
+func (x *ObjectIndex) span(r Rect) [4]int {
+	c0, r0 := x.cellOf(r.Min)
+	c1, r1 := x.cellOf(r.Max)
+	return [4]int{c0, r0, c1, r1}
+}
+
+// cellOf returns the cell a point is in.
+func (x *ObjectIndex) cellOf(p Vec) (int, int) {
+	return int(math.Floor(p.X / x.cell)), int(math.Floor(p.Y / x.cell))
+}
+
+// collect gathers the entries in a block of cells that pass a test, once each
+// and in the order they were added. Only the part of the block that holds
+// objects is walked.
+func (x *ObjectIndex) collect(span [4]int, test func(e *indexEntry) bool) (out []*object) {
+	if len(x.entries) == 0 {
+		return
+	}
+	all := x.spanAll()
+	span = [4]int{maxInt(span[0], all[0]), maxInt(span[1], all[1]), minInt(span[2], all[2]), minInt(span[3], all[3])}
+	seen := make(map[*indexEntry]bool)
+	var es []*indexEntry
+	for r := span[1]; r <= span[3]; r++ {
+		for c := span[0]; c <= span[2]; c++ {
+			for _, e := range x.cells[[2]int{c, r}] {
+				if !seen[e] {
+					seen[e] = true
+					if test(e) {
+						es = append(es, e)
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(es, func(i, j int) bool {
+		return es[i].seq < es[j].seq
+	})
+	for _, e := range es {
+		out = append(out, e.o)
+	}
+	return
+}
+
+// QueryRect returns the objects whose bounds overlap a rectangle.
+func (x *ObjectIndex) QueryRect(r Rect, f ObjectFilter) []*object {
+	return x.collect(x.span(r), func(e *indexEntry) bool {
+		return f.match(e) && e.bounds.Overlaps(r)
+	})
+}
+
+// QueryPoint returns the objects that contain a point. Shapes with an area
+// are tested against their exact outline, other objects against their
+// bounds.
+func (x *ObjectIndex) QueryPoint(p Vec, f ObjectFilter) []*object {
+	return x.collect(x.span(Rect{Min: p, Max: p}), func(e *indexEntry) bool {
+		return f.match(e) && e.bounds.Contains(p) && e.o.contains(p)
+	})
+}
+
+// QueryCircle returns the objects whose bounds come within a radius of a
+// point.
+func (x *ObjectIndex) QueryCircle(c Vec, radius float64, f ObjectFilter) []*object {
+	r := Rect{Min: c.Sub(Vec{radius, radius}), Max: c.Add(Vec{radius, radius})}
+	return x.collect(x.span(r), func(e *indexEntry) bool {
+		return f.match(e) && rectDistance(e.bounds, c) <= radius
+	})
+}
+
+// Nearest returns the object whose bounds are closest to a point along with
+// the distance to them, searching outwards ring by ring from the cell of the
+// point. It returns nil if no object passes the filter.
+func (x *ObjectIndex) Nearest(p Vec, f ObjectFilter) (*object, float64) {
+	if len(x.entries) == 0 {
+		return nil, 0
+	}
+	// the rings only need to grow until they cover every indexed object, and
+	// only the part of each ring inside of the objects is walked
+	all := x.spanAll()
+	pc, pr := x.cellOf(p)
+	reach := maxInt(maxInt(pc-all[0], all[2]-pc), maxInt(pr-all[1], all[3]-pr))
+	var best *indexEntry
+	bestD := math.Inf(1)
+	visit := func(c, r int) {
+		for _, e := range x.cells[[2]int{c, r}] {
+			if !f.match(e) {
+				continue
+			}
+			d := rectDistance(e.bounds, p)
+			if d < bestD || d == bestD && e.seq < best.seq {
+				best, bestD = e, d
+			}
+		}
+	}
+	for ring := 0; ring <= reach; ring++ {
+		// anything in this ring or beyond is at least this far away
+		if best != nil && float64(ring-1)*x.cell > bestD {
+			break
+		}
+		c0, c1 := maxInt(pc-ring, all[0]), minInt(pc+ring, all[2])
+		for r := maxInt(pr-ring, all[1]); r <= minInt(pr+ring, all[3]); r++ {
+			if r == pr-ring || r == pr+ring {
+				for c := c0; c <= c1; c++ {
+					visit(c, r)
+				}
+				continue
+			}
+			if pc-ring >= all[0] {
+				visit(pc-ring, r)
+			}
+			if ring > 0 && pc+ring <= all[2] {
+				visit(pc+ring, r)
+			}
+		}
+	}
+	if best == nil {
+		return nil, 0
+	}
+	return best.o, bestD
+}
+
+// rectDistance returns the distance from a point to a rectangle, zero when
+// the point is inside.
+func rectDistance(r Rect, p Vec) float64 {
+	dx := math.Max(math.Max(r.Min.X-p.X, 0), p.X-r.Max.X)
+	dy := math.Max(math.Max(r.Min.Y-p.Y, 0), p.Y-r.Max.Y)
+	return math.Hypot(dx, dy)
+}
@@ -0,0 +1,97 @@
+package tmx
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestNearest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	m := tilemap{Tilewidth: 16, Tileheight: 16}
+	l := &layer{Name: "things", Type: objectLayer}
+	for i := 0; i < 200; i++ {
+		l.Objects = append(l.Objects, object{Id: i + 1, X: r.Float64() * 2000, Y: r.Float64() * 2000,
+			Width: r.Float64() * 100, Height: r.Float64() * 100})
+	}
+	m.Layers = []layer{*l}
+	l = &m.Layers[0]
+	x := m.ObjectIndex()
+
+	// every object is looked at to find the expected answer
+	nearest := func(p Vec) (*object, float64) {
+		var best *object
+		d := 0.0
+		for i := range l.Objects {
+			o := &l.Objects[i]
+			if _, ok := x.entries[o]; !ok {
+				continue
+			}
+			if od := rectDistance(o.Bounds(), p); best == nil || od < d {
+				best, d = o, od
+			}
+		}
+		return best, d
+	}
+	check := func(what string) {
+		t.Helper()
+		for i := 0; i < 50; i++ {
+			p := Vec{r.Float64()*3000 - 500, r.Float64()*3000 - 500}
+			o, d := x.Nearest(p, ObjectFilter{})
+			wo, wd := nearest(p)
+			if o != wo || d != wd {
+				t.Fatalf("%s: nearest to %v is %v at %g, want %v at %g", what, p, o, d, wo, wd)
+			}
+		}
+	}
+	check("indexed")
+
+	// taking out and moving the objects at the edge shrinks the bounds
+	for i := range l.Objects {
+		o := &l.Objects[i]
+		switch {
+		case o.X < 300:
+			x.Remove(o)
+		case o.Y > 1700:
+			o.Y -= 1000
+			x.Update(o)
+		}
+	}
+	check("moved")
+	if b, want := x.spanAll(), x.span(Rect{Vec{300, 0}, Vec{2100, 1800}}); b[0] < want[0] || b[3] > want[3] {
+		t.Errorf("bounds %v weren't shrunk to %v", b, want)
+	}
+
+	for i := range l.Objects {
+		x.Remove(&l.Objects[i])
+	}
+	if o, _ := x.Nearest(Vec{}, ObjectFilter{}); o != nil {
+		t.Errorf("empty index returned %v", o)
+	}
+	x.Insert(l, &l.Objects[0])
+	check("reinserted")
+}
+
+func TestQueryLargeArea(t *testing.T) {
+	m := tilemap{Tilewidth: 16, Tileheight: 16}
+	m.Layers = []layer{{Name: "things", Type: objectLayer, Objects: []object{
+		{Id: 1, X: 10, Y: 10, Width: 10, Height: 10},
+		{Id: 2, X: 500, Y: 300, Width: 10, Height: 10},
+	}}}
+	x := m.ObjectIndex()
+	// these would walk tens of millions of empty cells without clamping
+	huge := Rect{Vec{-3e5, -3e5}, Vec{3e5, 3e5}}
+	if os := x.QueryRect(huge, ObjectFilter{}); len(os) != 2 {
+		t.Errorf("rect query found %d objects, want 2", len(os))
+	}
+	if os := x.QueryCircle(Vec{}, 4e5, ObjectFilter{}); len(os) != 2 {
+		t.Errorf("circle query found %d objects, want 2", len(os))
+	}
+	if os := x.QueryRect(Rect{Vec{1000, 1000}, Vec{2000, 2000}}, ObjectFilter{}); len(os) != 0 {
+		t.Errorf("query outside of every object found %v", os)
+	}
+	x.Remove(&m.Layers[0].Objects[0])
+	x.Remove(&m.Layers[0].Objects[1])
+	if os := x.QueryRect(huge, ObjectFilter{}); len(os) != 0 {
+		t.Errorf("query of an empty index found %v", os)
+	}
+}
@@ -0,0 +1,384 @@
+package tmx
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+)
+
+var (
+	// pathfinding errors
+	noPath      = errors.New("there is no path between the cells")
+	cellOutside = errors.New("the cell is outside of the navigation grid")
+)
+
+// Diagonals decides if and when a path can move diagonally between cells.
+type Diagonals int
+
+const (
+	// NoDiagonals only moves between cells that share an edge.
+	NoDiagonals Diagonals = iota
+	// DiagonalsNoCorners moves diagonally when both cells next to the move
+	// are walkable, so paths never cut a corner.
+	DiagonalsNoCorners
+	// DiagonalsOneCorner moves diagonally when at least one of the cells next
+	// to the move is walkable.
+	DiagonalsOneCorner
+	// DiagonalsAlways moves diagonally even between two blocked cells.
+	DiagonalsAlways
+)
+
+// CostFunc returns the cost of entering a cell, given the tile at the cell in
+// each of the layers the grid was built from (nil tiles are empty). Costs
+// that are infinite, NaN or less than zero block the cell.
+type CostFunc func(c Cell, tiles []*Tile) float64
+
+// PropertyCost returns a CostFunc driven by tile properties. Any tile with
+// the bool property blocked set to true blocks the cell, otherwise the cost
+// is the largest value of the numeric property cost, or def when no tile has
+// one.
+func PropertyCost(blocked, cost string, def float64) CostFunc {
+	return func(_ Cell, tiles []*Tile) float64 {
+		c, found := def, false
+		for _, t := range tiles {
+			if t == nil || t.Nil() {
+				continue
+			}
+			if p, ok := findProperty(t.Properties(), blocked); ok {
+				if b, _ := p.Value.(bool); b {
+					return math.Inf(1)
+				}
+			}
+			if p, ok := findProperty(t.Properties(), cost); ok {
+				if v, ok := p.Value.(float64); ok && (!found || v > c) {
+					c, found = v, true
+				}
+			}
+		}
+		return c
+	}
+}
+
+// NavGrid is a navigation grid over the cells of one or more tile layers. The
+// neighbours of a cell follow the orientation of the map: square grids for
+// orthogonal and isometric maps, six neighbours for hexagonal maps, and the
+// diamond neighbours of staggered maps.
+type NavGrid struct {
+	Diagonals Diagonals // diagonal movement on square and staggered grids
+	m         *tilemap
+	min       Cell      // top left cell of the grid
+	w, h      int       // size of the grid in cells
+	cost      []float64 // cost of entering each cell, row major
+}
+
+// Path is the result of a search.
+type Path struct {
+	Cells  []Cell  // cells from the start to the goal, both included
+	Points []Vec   // center of each cell in map pixel space
+	Cost   float64 // total cost of the path
+}
+
+// NewNavGrid builds a navigation grid from tile layers of the map, with the
+// cost of each cell worked out from the tiles stacked on it. The grid covers
+// the map, or on infinite maps the chunks of all the layers.
+func NewNavGrid(m *tilemap, cost CostFunc, layers ...*layer) (*NavGrid, error) {
+	g := &NavGrid{m: m, w: m.Width, h: m.Height}
+	if m.Infinite {
+		first := true
+		for _, l := range layers {
+			if e := l.Decode(); e != nil {
+				return nil, e
+			}
+			for i := 0; i < len(l.Chunks); i++ {
+				c := &l.Chunks[i]
+				if first {
+					g.min, g.w, g.h, first = Cell{c.X, c.Y}, c.Width, c.Height, false
+					continue
+				}
+				maxCol, maxRow := maxInt(g.min.Col+g.w, c.X+c.Width), maxInt(g.min.Row+g.h, c.Y+c.Height)
+				g.min = Cell{minInt(g.min.Col, c.X), minInt(g.min.Row, c.Y)}
+				g.w, g.h = maxCol-g.min.Col, maxRow-g.min.Row
+			}
+		}
+	}
+	// gather the stack of tiles at every cell
+	stacks := make([][]*Tile, g.w*g.h)
+	for i := range stacks {
+		stacks[i] = make([]*Tile, len(layers))
+	}
+	for li, l := range layers {
+		e := m.eachTile(l, func(col, row int, t *Tile) {
+			if i, ok := g.index(Cell{col, row}); ok {
+				stacks[i][li] = t
+			}
+		})
+		if e != nil {
+			return nil, e
+		}
+	}
+	g.cost = make([]float64, len(stacks))
+	for i, s := range stacks {
+		g.cost[i] = cost(Cell{g.min.Col + i%g.w, g.min.Row + i/g.w}, s)
+	}
+	return g, nil
+}
+
+// index returns the position of a cell in the cost slice.
+func (g *NavGrid) index(c Cell) (int, bool) {
+	x, y := c.Col-g.min.Col, c.Row-g.min.Row
+	if x < 0 || y < 0 || x >= g.w || y >= g.h {
+		return 0, false
+	}
+	return y*g.w + x, true
+}
+
+// Cost returns the cost of entering a cell, infinite for blocked cells and
+// cells outside the grid.
+func (g *NavGrid) Cost(c Cell) float64 {
+	i, ok := g.index(c)
+	if !ok || !walkable(g.cost[i]) {
+		return math.Inf(1)
+	}
+	return g.cost[i]
+}
+
+// SetCost changes the cost of entering a cell, for doors that open or walls
+// that get built while the game runs.
+func (g *NavGrid) SetCost(c Cell, cost float64) {
+	if i, ok := g.index(c); ok {
+		g.cost[i] = cost
+	}
+}
+
+// Walkable returns whether a cell can be entered.
+func (g *NavGrid) Walkable(c Cell) bool {
+	return !math.IsInf(g.Cost(c), 1)
+}
+
+// walkable returns whether a cost lets a cell be entered.
+func walkable(c float64) bool {
+	return c >= 0 && !math.IsInf(c, 1) && !math.IsNaN(c)
+}
+
+// step is a move to a neighbouring cell.
+type step struct {
+	to     Cell
+	length float64 // length of the move, one for a move across an edge
+}
+
+// neighbours returns the moves out of a cell allowed by the orientation of
+// the map and the diagonal rule.
+func (g *NavGrid) neighbours(c Cell) (out []step) {
+	m := g.m
+	switch m.Orientation {
+	case hexagonal:
+		for _, d := range m.staggerNeighbours(c) {
+			out = append(out, step{to: d, length: 1})
+		}
+		// the two cells straight along the stagger axis
+		if m.staggerAxisX() {
+			out = append(out, step{Cell{c.Col, c.Row - 1}, 1}, step{Cell{c.Col, c.Row + 1}, 1})
+		} else {
+			out = append(out, step{Cell{c.Col - 1, c.Row}, 1}, step{Cell{c.Col + 1, c.Row}, 1})
+		}
+		return g.filter(out)
+	case staggered:
+		edges := m.staggerNeighbours(c)
+		for _, d := range edges {
+			out = append(out, step{to: d, length: 1})
+		}
+		// the corner neighbours, between two of the edge neighbours
+		var corners [4]Cell
+		if m.staggerAxisX() {
+			corners = [4]Cell{{c.Col, c.Row - 1}, {c.Col + 2, c.Row}, {c.Col, c.Row + 1}, {c.Col - 2, c.Row}}
+		} else {
+			corners = [4]Cell{{c.Col, c.Row - 2}, {c.Col + 1, c.Row}, {c.Col, c.Row + 2}, {c.Col - 1, c.Row}}
+		}
+		// edges are ordered up right, down right, down left, up left so
+		// each corner sits between edges i-1 and i
+		for i, d := range corners {
+			if g.diagonal(edges[(i+3)%4], edges[i]) {
+				out = append(out, step{to: d, length: math.Sqrt2})
+			}
+		}
+		return g.filter(out)
+	}
+	// orthogonal and isometric maps are square grids
+	for _, d := range [4][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+		out = append(out, step{Cell{c.Col + d[0], c.Row + d[1]}, 1})
+	}
+	for _, d := range [4][2]int{{1, -1}, {1, 1}, {-1, 1}, {-1, -1}} {
+		if g.diagonal(Cell{c.Col + d[0], c.Row}, Cell{c.Col, c.Row + d[1]}) {
+			out = append(out, step{Cell{c.Col + d[0], c.Row + d[1]}, math.Sqrt2})
+		}
+	}
+	return g.filter(out)
+}
+
+// diagonal returns whether a diagonal move is allowed given the two cells
+// either side of it.
+func (g *NavGrid) diagonal(a, b Cell) bool {
+	switch g.Diagonals {
+	case DiagonalsNoCorners:
+		return g.Walkable(a) && g.Walkable(b)
+	case DiagonalsOneCorner:
+		return g.Walkable(a) || g.Walkable(b)
+	case DiagonalsAlways:
+		return true
+	}
+	return false
+}
+
+// filter drops the moves into cells that can't be entered.
+func (g *NavGrid) filter(ss []step) []step {
+	out := ss[:0]
+	for _, s := range ss {
+		if g.Walkable(s.to) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// staggerNeighbours returns the four cells that share an edge with a cell of a
+// staggered map, or the four slanted neighbours of a hexagonal map, ordered up
+// right, down right, down left, up left.
+func (m *tilemap) staggerNeighbours(c Cell) [4]Cell {
+	if m.staggerAxisX() {
+		// every other column is shifted down
+		up, down := c.Row-1, c.Row
+		if m.staggered(c.Col) {
+			up, down = c.Row, c.Row+1
+		}
+		return [4]Cell{{c.Col + 1, up}, {c.Col + 1, down}, {c.Col - 1, down}, {c.Col - 1, up}}
+	}
+	// every other row is shifted right
+	left, right := c.Col-1, c.Col
+	if m.staggered(c.Row) {
+		left, right = c.Col, c.Col+1
+	}
+	return [4]Cell{{right, c.Row - 1}, {right, c.Row + 1}, {left, c.Row + 1}, {left, c.Row - 1}}
+}
+
+// heuristic estimates the number of moves between two cells without ever
+// overestimating it.
+func (g *NavGrid) heuristic(a, b Cell) float64 {
+	m := g.m
+	var dx, dy float64
+	switch m.Orientation {
+	case hexagonal:
+		aq, ar := m.axial(a)
+		bq, br := m.axial(b)
+		dq, dr := float64(aq-bq), float64(ar-br)
+		return (math.Abs(dq) + math.Abs(dr) + math.Abs(dq+dr)) / 2
+	case staggered:
+		// staggered maps are isometric grids numbered differently, measure
+		// in isometric coordinates
+		pa, pb := m.TileCenter(a.Col, a.Row), m.TileCenter(b.Col, b.Row)
+		// the cells are laid out with the even tile size
+		tw, th := float64(m.Tilewidth&^1), float64(m.Tileheight&^1)
+		d := pa.Sub(pb)
+		dx, dy = math.Abs(d.X/tw+d.Y/th), math.Abs(d.Y/th-d.X/tw)
+	default:
+		dx, dy = math.Abs(float64(a.Col-b.Col)), math.Abs(float64(a.Row-b.Row))
+	}
+	if g.Diagonals == NoDiagonals {
+		return dx + dy
+	}
+	return math.Max(dx, dy) + (math.Sqrt2-1)*math.Min(dx, dy)
+}
+
+// axial converts a cell of a hexagonal map to axial coordinates.
+func (m *tilemap) axial(c Cell) (q, r int) {
+	even := 0
+	if m.StaggerIndex == staggerEven {
+		even = 1
+	}
+	if m.staggerAxisX() {
+		return c.Col, c.Row - (c.Col+even)>>1
+	}
+	return c.Col - (c.Row+even)>>1, c.Row
+}
+
+// FindPath finds the cheapest path between two cells with A*. Each move
+// costs the cost of the cell it enters times the length of the move.
+func (g *NavGrid) FindPath(from, to Cell) (p Path, e error) {
+	if _, ok := g.index(from); !ok {
+		return p, cellOutside
+	}
+	if _, ok := g.index(to); !ok {
+		return p, cellOutside
+	}
+	if !g.Walkable(to) {
+		return p, noPath
+	}
+	// the cheapest cell keeps the heuristic admissible
+	minCost := math.Inf(1)
+	for _, c := range g.cost {
+		if walkable(c) && c < minCost {
+			minCost = c
+		}
+	}
+	cost := map[Cell]float64{from: 0}
+	came := make(map[Cell]Cell)
+	open := &pathQueue{}
+	heap.Push(open, pathNode{from, g.heuristic(from, to) * minCost, 0})
+	for open.Len() > 0 {
+		n := heap.Pop(open).(pathNode)
+		if n.cell == to {
+			return g.path(came, from, to, n.cost), nil
+		}
+		if n.cost > cost[n.cell] {
+			// a cheaper way here was already expanded
+			continue
+		}
+		for _, s := range g.neighbours(n.cell) {
+			c := n.cost + g.Cost(s.to)*s.length
+			if old, seen := cost[s.to]; seen && c >= old {
+				continue
+			}
+			cost[s.to], came[s.to] = c, n.cell
+			heap.Push(open, pathNode{s.to, c + g.heuristic(s.to, to)*minCost, c})
+		}
+	}
+	return p, noPath
+}
+
+// path walks back from the goal to build the path.
+func (g *NavGrid) path(came map[Cell]Cell, from, to Cell, cost float64) (p Path) {
+	for c := to; ; c = came[c] {
+		p.Cells = append(p.Cells, c)
+		if c == from {
+			break
+		}
+	}
+	for i, j := 0, len(p.Cells)-1; i < j; i, j = i+1, j-1 {
+		p.Cells[i], p.Cells[j] = p.Cells[j], p.Cells[i]
+	}
+	for _, c := range p.Cells {
+		p.Points = append(p.Points, g.m.TileCenter(c.Col, c.Row))
+	}
+	p.Cost = cost
+	return
+}
+
+// pathNode is a cell waiting to be expanded.
+type pathNode struct {
+	cell     Cell
+	priority float64 // cost so far plus the estimate to the goal
+	cost     float64 // cost so far
+}
+
+// pathQueue is a min heap of nodes ordered by priority.
+type pathQueue []pathNode
+
+func (q pathQueue) Len() int            { return len(q) }
+func (q pathQueue) Less(i, j int) bool  { return q[i].priority < q[j].priority }
+func (q pathQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x interface{}) { *q = append(*q, x.(pathNode)) }
+func (q *pathQueue) Pop() interface{} {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
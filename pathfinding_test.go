@@ -0,0 +1,184 @@
+package tmx
+
+import (
+	"math"
+	"testing"
+)
+
+// gridMap turns rows of text into a map with a single tile layer, a wall tile
+// for every # and an empty cell for anything else. The tileset is the one of
+// testdata/base.json.
+func gridMap(t *testing.T, orientation string, tw, th int, rows ...string) *tilemap {
+	t.Helper()
+	m, e := LoadTileMap("testdata/base.json")
+	if e != nil {
+		t.Fatal(e)
+	}
+	m.Orientation, m.Tilewidth, m.Tileheight = orientation, tw, th
+	m.Width, m.Height = len(rows[0]), len(rows)
+	m.Layers = m.Layers[:1]
+	l := &m.Layers[0]
+	l.Width, l.Height = m.Width, m.Height
+	var ts []*Tile
+	for _, row := range rows {
+		for _, c := range row {
+			gid := uint32(0)
+			if c == '#' {
+				gid = 1
+			}
+			tile, e := m.makeTile(gid)
+			if e != nil {
+				t.Fatal(e)
+			}
+			ts = append(ts, tile)
+		}
+	}
+	l.Data = ts
+	return &m
+}
+
+// wallCost blocks the cells with a tile.
+func wallCost(_ Cell, tiles []*Tile) float64 {
+	if !tiles[0].Nil() {
+		return math.Inf(1)
+	}
+	return 1
+}
+
+// cheapest finds the cost of the cheapest path with Dijkstra's algorithm, to
+// check the paths A* finds against.
+func cheapest(g *NavGrid, from, to Cell) float64 {
+	dist := map[Cell]float64{from: 0}
+	done := make(map[Cell]bool)
+	for {
+		cur, best := Cell{}, math.Inf(1)
+		for c, d := range dist {
+			if !done[c] && d < best {
+				cur, best = c, d
+			}
+		}
+		if math.IsInf(best, 1) || cur == to {
+			return best
+		}
+		done[cur] = true
+		for _, s := range g.neighbours(cur) {
+			d := best + g.Cost(s.to)*s.length
+			if old, ok := dist[s.to]; !ok || d < old {
+				dist[s.to] = d
+			}
+		}
+	}
+}
+
+func TestFindPath(t *testing.T) {
+	maze := []string{
+		".....",
+		".###.",
+		".#.#.",
+		".#...",
+		".....",
+	}
+	// staggered cells only touch the rows above and below, a wall across
+	// with a gap at the end
+	wall := []string{
+		".....",
+		".....",
+		"####.",
+		".....",
+		".....",
+	}
+	cases := []struct {
+		name        string
+		orientation string
+		axis, index string
+		tw, th      int
+		diagonals   Diagonals
+		staggered   bool    // use the wall instead of the maze
+		cost        float64 // zero to only check against cheapest
+	}{
+		{name: "orthogonal", orientation: orthogonal, tw: 16, th: 16, cost: 8},
+		{name: "orthogonal diagonals", orientation: orthogonal, tw: 16, th: 16, diagonals: DiagonalsOneCorner, cost: 4 + 2*math.Sqrt2},
+		{name: "isometric", orientation: isometric, tw: 32, th: 16, cost: 8},
+		{name: "hexagonal", orientation: hexagonal, axis: "y", index: "odd", tw: 28, th: 32},
+		{name: "hexagonal x", orientation: hexagonal, axis: staggerX, index: staggerEven, tw: 32, th: 28},
+		{name: "staggered", orientation: staggered, axis: "y", index: "odd", tw: 32, th: 16, staggered: true},
+		// odd tile sizes are laid out with the even size below them
+		{name: "staggered odd", orientation: staggered, axis: "y", index: "odd", tw: 33, th: 17, diagonals: DiagonalsNoCorners, staggered: true},
+		{name: "staggered x", orientation: staggered, axis: staggerX, index: staggerEven, tw: 32, th: 16, diagonals: DiagonalsAlways, staggered: true},
+	}
+	for _, c := range cases {
+		rows, from, to := maze, Cell{2, 2}, Cell{0, 0}
+		if c.staggered {
+			rows, from = wall, Cell{0, 4}
+		}
+		m := gridMap(t, c.orientation, c.tw, c.th, rows...)
+		m.StaggerAxis, m.StaggerIndex, m.HexSideLength = c.axis, c.index, c.tw/2
+		g, e := NewNavGrid(m, wallCost, &m.Layers[0])
+		if e != nil {
+			t.Fatal(e)
+		}
+		g.Diagonals = c.diagonals
+		p, e := g.FindPath(from, to)
+		if e != nil {
+			t.Errorf("%s: %v", c.name, e)
+			continue
+		}
+		want := c.cost
+		if want == 0 {
+			want = cheapest(g, from, to)
+		}
+		if math.Abs(p.Cost-want) > 1e-9 {
+			t.Errorf("%s: path %v costs %g, want %g", c.name, p.Cells, p.Cost, want)
+		}
+		if p.Cells[0] != from || p.Cells[len(p.Cells)-1] != to || len(p.Points) != len(p.Cells) {
+			t.Errorf("%s: path %v doesn't go from %v to %v", c.name, p.Cells, from, to)
+		}
+		// every move is to a walkable neighbour
+		for i := 1; i < len(p.Cells); i++ {
+			ok := false
+			for _, s := range g.neighbours(p.Cells[i-1]) {
+				ok = ok || s.to == p.Cells[i]
+			}
+			if !ok {
+				t.Errorf("%s: %v to %v isn't a move", c.name, p.Cells[i-1], p.Cells[i])
+			}
+		}
+	}
+}
+
+func TestFindPathEnds(t *testing.T) {
+	m := gridMap(t, orthogonal, 16, 16,
+		"..#..",
+		"..#..",
+		"..#..",
+	)
+	g, e := NewNavGrid(m, wallCost, &m.Layers[0])
+	if e != nil {
+		t.Fatal(e)
+	}
+	cases := []struct {
+		name     string
+		from, to Cell
+		e        error
+		cells    int
+	}{
+		{"same cell", Cell{1, 1}, Cell{1, 1}, nil, 1},
+		{"walled off", Cell{0, 0}, Cell{4, 2}, noPath, 0},
+		{"blocked goal", Cell{0, 0}, Cell{2, 1}, noPath, 0},
+		{"outside", Cell{0, 0}, Cell{9, 0}, cellOutside, 0},
+	}
+	for _, c := range cases {
+		p, e := g.FindPath(c.from, c.to)
+		if e != c.e || len(p.Cells) != c.cells {
+			t.Errorf("%s: got %v and %d cells, want %v and %d", c.name, e, len(p.Cells), c.e, c.cells)
+		}
+		if e == nil && p.Cost != 0 {
+			t.Errorf("%s: costs %g", c.name, p.Cost)
+		}
+	}
+	// opening a door in the wall makes a path
+	g.SetCost(Cell{2, 2}, 1)
+	if p, e := g.FindPath(Cell{0, 0}, Cell{4, 2}); e != nil || p.Cost != 6 {
+		t.Errorf("through the door: %v, cost %g, want 6", e, p.Cost)
+	}
+}
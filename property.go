@@ -5,3 +5,14 @@ type property struct {
   Type  string      `json:"type"`  // string, int, float, bool, color or file
   Value interface{} `json:"value"` // value of the property
 }
+
+// findProperty returns the property with the given name from a list of
+// properties.
+func findProperty(ps []property, name string) (property, bool) {
+  for i := 0; i < len(ps); i++ {
+    if ps[i].Name == name {
+      return ps[i], true
+    }
+  }
+  return property{}, false
+}
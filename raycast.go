@@ -0,0 +1,200 @@
+package tmx
+
+import (
+	"errors"
+	"math"
+)
+
+var (
+	// grid traversal errors
+	unsupportedOrientation = errors.New("the map orientation is unsupported")
+)
+
+// Hit is where a ray was stopped by a tile.
+type Hit struct {
+	Cell     Cell    // cell of the blocking tile
+	Tile     *Tile   // the blocking tile
+	Point    Vec     // where the ray entered the cell in map pixel space
+	Normal   Vec     // unit normal of the side of the cell that was hit
+	Distance float64 // distance from the start of the ray in pixels
+}
+
+// tileSpace converts between map pixel space and a space where every cell of
+// a tile layer is a unit square, so that orthogonal and isometric maps can be
+// walked the same way.
+type tileSpace struct {
+	toTile, toPixel affine
+}
+
+// tileSpace returns the conversion for the orientation of the map and the
+// offset of a layer.
+func (m *tilemap) tileSpace(l *layer) (s tileSpace, e error) {
+	tw, th := float64(m.Tilewidth), float64(m.Tileheight)
+	switch m.Orientation {
+	case orthogonal, empty:
+		s.toPixel = scaling(tw, th)
+	case isometric:
+		originX := float64(m.Height) * tw / 2
+		s.toPixel = affine{a: tw / 2, b: th / 2, c: -tw / 2, d: th / 2, tx: originX}
+	default:
+		return s, unsupportedOrientation
+	}
+	s.toPixel = translation(l.Offsetx, l.Offsety).then(s.toPixel)
+	s.toTile = s.toPixel.inverse()
+	return s, nil
+}
+
+// Raycast walks the cells of a tile layer along the segment from one point
+// to another in map pixel space, and returns the first tile the predicate
+// says blocks the ray. Empty cells and cells outside of the layer never
+// block, so the ray passes over chunk edges of infinite maps. Orthogonal and
+// isometric maps are supported.
+func (m *tilemap) Raycast(l *layer, from, to Vec, blocks func(t *Tile) bool) (h Hit, hit bool, e error) {
+	s, e := m.tileSpace(l)
+	if e != nil {
+		return h, false, e
+	}
+	a, b := s.toTile.apply(from), s.toTile.apply(to)
+	d := b.Sub(a)
+	col, row := int(math.Floor(a.X)), int(math.Floor(a.Y))
+	endCol, endRow := int(math.Floor(b.X)), int(math.Floor(b.Y))
+
+	// distance along the ray, as a fraction of it, to the next cell edge on
+	// each axis and between edges
+	stepX, nextX, deltaX := ddaAxis(a.X, d.X)
+	stepY, nextY, deltaY := ddaAxis(a.Y, d.Y)
+
+	t, normal := 0.0, Vec{}
+	for {
+		if tl := l.TileAt(col, row); !tl.Nil() && blocks(tl) {
+			h = Hit{Cell: Cell{col, row}, Tile: tl, Point: s.toPixel.apply(Vec{a.X + d.X*t, a.Y + d.Y*t})}
+			if normal != (Vec{}) {
+				h.Normal = s.normal(normal)
+			}
+			h.Distance = math.Hypot(h.Point.X-from.X, h.Point.Y-from.Y)
+			return h, true, nil
+		}
+		if col == endCol && row == endRow {
+			return h, false, nil
+		}
+		if nextX < nextY {
+			t, col, nextX, normal = nextX, col+stepX, nextX+deltaX, Vec{float64(-stepX), 0}
+		} else {
+			t, row, nextY, normal = nextY, row+stepY, nextY+deltaY, Vec{0, float64(-stepY)}
+		}
+		if t > 1 {
+			return h, false, nil
+		}
+	}
+}
+
+// ddaAxis sets up the traversal along one axis: the direction of the steps,
+// the fraction of the ray to the first cell edge and between edges.
+func ddaAxis(start, d float64) (step int, next, delta float64) {
+	switch {
+	case d > 0:
+		return 1, (math.Floor(start) + 1 - start) / d, 1 / d
+	case d < 0:
+		return -1, (start - math.Floor(start)) / -d, 1 / -d
+	}
+	return 0, math.Inf(1), math.Inf(1)
+}
+
+// normal converts the normal of a cell side from tile space to a unit vector
+// in map pixel space.
+func (s tileSpace) normal(n Vec) Vec {
+	// normals transform with the transpose of the inverse
+	t := s.toTile
+	p := Vec{t.a*n.X + t.b*n.Y, t.c*n.X + t.d*n.Y}
+	l := math.Hypot(p.X, p.Y)
+	return Vec{p.X / l, p.Y / l}
+}
+
+// inverse returns the transform that undoes t.
+func (t affine) inverse() affine {
+	det := t.a*t.d - t.b*t.c
+	i := affine{a: t.d / det, b: -t.b / det, c: -t.c / det, d: t.a / det}
+	i.tx, i.ty = -(i.a*t.tx + i.c*t.ty), -(i.b*t.tx + i.d*t.ty)
+	return i
+}
+
+// HasLineOfSight returns whether nothing the predicate says blocks lies on
+// the segment between two points in map pixel space.
+func (m *tilemap) HasLineOfSight(l *layer, from, to Vec, blocks func(t *Tile) bool) (bool, error) {
+	_, hit, e := m.Raycast(l, from, to, blocks)
+	return !hit && e == nil, e
+}
+
+// octants transform the first octant of the shadowcasting into the others.
+var octants = [8][4]int{
+	{1, 0, 0, 1}, {0, 1, 1, 0}, {0, -1, 1, 0}, {-1, 0, 0, 1},
+	{-1, 0, 0, -1}, {0, -1, -1, 0}, {0, 1, -1, 0}, {1, 0, 0, -1},
+}
+
+// FieldOfView returns the cells visible from a cell within a radius in
+// cells, using recursive shadowcasting. Tiles the predicate says block are
+// visible themselves but hide what is behind them. On finite maps the cells
+// outside of the layer block the view. Shadowcasting works on square grids,
+// so like Raycast only orthogonal and isometric maps are supported.
+func (m *tilemap) FieldOfView(l *layer, origin Cell, radius int, blocks func(t *Tile) bool) (map[Cell]bool, error) {
+	if _, e := m.tileSpace(l); e != nil {
+		return nil, e
+	}
+	seen := map[Cell]bool{origin: true}
+	opaque := func(c Cell) bool {
+		if !m.Infinite && (c.Col < 0 || c.Row < 0 || c.Col >= l.Width || c.Row >= l.Height) {
+			return true
+		}
+		t := l.TileAt(c.Col, c.Row)
+		return !t.Nil() && blocks(t)
+	}
+	visible := func(c Cell) {
+		if m.Infinite || (c.Col >= 0 && c.Row >= 0 && c.Col < l.Width && c.Row < l.Height) {
+			seen[c] = true
+		}
+	}
+	for _, o := range octants {
+		castLight(origin, radius, 1, 1, 0, o, opaque, visible)
+	}
+	return seen, nil
+}
+
+// castLight scans one octant row by row, recursing around the shadows cast by
+// blocking cells. The slopes bound the part of the octant still lit.
+func castLight(o Cell, radius, row int, start, end float64, t [4]int, opaque func(Cell) bool, visible func(Cell)) {
+	if start < end {
+		return
+	}
+	r2 := float64(radius * radius)
+	newStart := 0.0
+	for j := row; j <= radius; j++ {
+		blocked := false
+		dy := -j
+		for dx := -j; dx <= 0; dx++ {
+			c := Cell{o.Col + dx*t[0] + dy*t[1], o.Row + dx*t[2] + dy*t[3]}
+			left, right := (float64(dx)-0.5)/(float64(dy)+0.5), (float64(dx)+0.5)/(float64(dy)-0.5)
+			if start < right {
+				continue
+			} else if end > left {
+				break
+			}
+			if float64(dx*dx+dy*dy) <= r2 {
+				visible(c)
+			}
+			if blocked {
+				if opaque(c) {
+					newStart = right
+					continue
+				}
+				blocked, start = false, newStart
+			} else if opaque(c) && j < radius {
+				blocked = true
+				castLight(o, radius, j+1, start, left, t, opaque, visible)
+				newStart = right
+			}
+		}
+		if blocked {
+			break
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package tmx
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRaycast(t *testing.T) {
+	m := gridMap(t, orthogonal, 16, 16,
+		"......",
+		"......",
+		"...#..",
+		"......",
+	)
+	l := &m.Layers[0]
+	blocks := func(*Tile) bool { return true }
+	cases := []struct {
+		name     string
+		from, to Vec
+		hit      bool
+		cell     Cell
+		point    Vec
+		normal   Vec
+		distance float64
+	}{
+		{"right", Vec{8, 40}, Vec{90, 40}, true, Cell{3, 2}, Vec{48, 40}, Vec{-1, 0}, 40},
+		{"left", Vec{90, 40}, Vec{0, 40}, true, Cell{3, 2}, Vec{64, 40}, Vec{1, 0}, 26},
+		{"down", Vec{56, 0}, Vec{56, 60}, true, Cell{3, 2}, Vec{56, 32}, Vec{0, -1}, 32},
+		{"diagonal", Vec{8, 0}, Vec{72, 64}, true, Cell{3, 2}, Vec{48, 40}, Vec{-1, 0}, 40 * math.Sqrt2},
+		// a ray starting in a blocking tile stops right away without a normal
+		{"inside", Vec{56, 40}, Vec{90, 40}, true, Cell{3, 2}, Vec{56, 40}, Vec{}, 0},
+		{"short", Vec{8, 40}, Vec{40, 40}, false, Cell{}, Vec{}, Vec{}, 0},
+		{"past", Vec{0, 8}, Vec{90, 8}, false, Cell{}, Vec{}, Vec{}, 0},
+	}
+	near := func(a, b Vec) bool { return math.Hypot(a.X-b.X, a.Y-b.Y) < 1e-9 }
+	for _, c := range cases {
+		h, hit, e := m.Raycast(l, c.from, c.to, blocks)
+		if e != nil {
+			t.Fatalf("%s: %v", c.name, e)
+		}
+		if hit != c.hit {
+			t.Errorf("%s: hit %v, want %v", c.name, hit, c.hit)
+			continue
+		}
+		if !hit {
+			continue
+		}
+		if h.Cell != c.cell || !near(h.Point, c.point) || !near(h.Normal, c.normal) || math.Abs(h.Distance-c.distance) > 1e-9 {
+			t.Errorf("%s: hit %v at %v normal %v distance %g, want %v at %v normal %v distance %g",
+				c.name, h.Cell, h.Point, h.Normal, h.Distance, c.cell, c.point, c.normal, c.distance)
+		}
+		if see, _ := m.HasLineOfSight(l, c.from, c.to, blocks); see {
+			t.Errorf("%s: line of sight through the wall", c.name)
+		}
+	}
+
+	// rays cross isometric maps in their diamond shaped cells
+	m.Orientation = isometric
+	from, to := m.TileCenter(0, 2), m.TileCenter(5, 2)
+	h, hit, e := m.Raycast(l, from, to, blocks)
+	if e != nil || !hit || h.Cell != (Cell{3, 2}) {
+		t.Errorf("isometric: hit %v %v, %v, want the wall at 3,2", hit, h.Cell, e)
+	}
+	// the hit point is on the edge of the wall, just past it is the wall
+	d := to.Sub(from)
+	if c, r := m.PixelToTile(h.Point.Add(Vec{d.X * 1e-6, d.Y * 1e-6})); c != 3 || r != 2 {
+		t.Errorf("isometric: just past the hit point %v is cell %d,%d, not the wall", h.Point, c, r)
+	}
+
+	m.Orientation, m.StaggerAxis, m.StaggerIndex = hexagonal, "y", "odd"
+	if _, _, e := m.Raycast(l, from, to, blocks); e != unsupportedOrientation {
+		t.Errorf("hexagonal: %v", e)
+	}
+}
+
+func TestFieldOfView(t *testing.T) {
+	m := gridMap(t, orthogonal, 16, 16,
+		".......",
+		".......",
+		"...#...",
+		"...#...",
+		"...#...",
+		".......",
+		".......",
+	)
+	l := &m.Layers[0]
+	blocks := func(*Tile) bool { return true }
+	seen, e := m.FieldOfView(l, Cell{1, 3}, 10, blocks)
+	if e != nil {
+		t.Fatal(e)
+	}
+	cases := []struct {
+		c    Cell
+		seen bool
+	}{
+		{Cell{1, 3}, true}, // the origin
+		{Cell{2, 3}, true},
+		{Cell{3, 3}, true}, // the wall itself
+		{Cell{3, 2}, true},
+		{Cell{4, 3}, false}, // behind the wall
+		{Cell{6, 3}, false},
+		{Cell{5, 2}, false},
+		{Cell{3, 0}, true}, // around the ends of the wall
+		{Cell{3, 6}, true},
+		{Cell{6, 0}, false},
+		{Cell{1, 0}, true},
+	}
+	for _, c := range cases {
+		if seen[c.c] != c.seen {
+			t.Errorf("cell %v seen %v, want %v", c.c, seen[c.c], c.seen)
+		}
+	}
+	for c := range seen {
+		if c.Col < 0 || c.Row < 0 || c.Col >= 7 || c.Row >= 7 {
+			t.Errorf("cell %v outside of the layer is seen", c)
+		}
+	}
+
+	// the radius limits the view
+	seen, _ = m.FieldOfView(l, Cell{1, 3}, 2, blocks)
+	if !seen[Cell{1, 1}] || seen[Cell{1, 0}] || seen[Cell{4, 0}] {
+		t.Errorf("radius 2 sees %v", seen)
+	}
+
+	for _, o := range []string{hexagonal, staggered} {
+		m.Orientation, m.StaggerAxis, m.StaggerIndex = o, "y", "odd"
+		if _, e := m.FieldOfView(l, Cell{1, 3}, 10, blocks); e != unsupportedOrientation {
+			t.Errorf("%s: %v", o, e)
+		}
+	}
+}
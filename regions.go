@@ -0,0 +1,312 @@
+package tmx
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+var (
+	// region errors
+	notHexagonal = errors.New("hex connectivity needs a hexagonal map")
+)
+
+// Connectivity decides which cells count as neighbours when tiles are grouped
+// into regions.
+type Connectivity int
+
+const (
+	// Connect4 joins cells that share an edge, four neighbours on orthogonal,
+	// isometric and staggered maps.
+	Connect4 Connectivity = iota
+	// Connect8 also joins cells that only share a corner, eight neighbours.
+	Connect8
+	// ConnectHex joins the six neighbours of a cell on a hexagonal map. Cells
+	// of hexagonal maps only ever meet along an edge, so they are always
+	// joined this way whatever the connectivity.
+	ConnectHex
+)
+
+// Region is a group of connected tiles of a tile layer.
+type Region struct {
+	Label    int       // number of the region, counting from one
+	Cells    []Cell    // cells of the region, row by row
+	Bounds   CellRect  // smallest block of cells holding the region
+	Outlines []Outline // loops around the region and its holes
+}
+
+// ConnectedRegions groups the tiles of a layer that match the predicate into
+// regions of connected cells, such as the rooms of a dungeon or the islands of
+// a sea. Regions are labelled in the order of their first cell, going row by
+// row. The outlines of a region are in map pixel space and follow the shape of
+// the cells for every orientation. With Connect8 cells that only touch at a
+// corner get outlines of their own, the same as with Outlines.
+func ConnectedRegions(m *tilemap, l *layer, match func(t *Tile) bool, conn Connectivity) ([]Region, error) {
+	if conn == ConnectHex && m.Orientation != hexagonal {
+		return nil, notHexagonal
+	}
+	g, e := m.solidCells(l, match)
+	if e != nil {
+		return nil, e
+	}
+	labels := make([]int, len(g.solid))
+	var rs []Region
+	for i, solid := range g.solid {
+		if !solid || labels[i] != 0 {
+			continue
+		}
+		// flood the region from its first cell
+		r := Region{Label: len(rs) + 1}
+		labels[i] = r.Label
+		stack := []Cell{{g.col + i%g.w, g.row + i/g.w}}
+		for len(stack) > 0 {
+			c := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			r.Cells = append(r.Cells, c)
+			for _, n := range m.cellNeighbours(c, conn == Connect8) {
+				if !g.at(n.Col, n.Row) {
+					continue
+				}
+				if j := (n.Row-g.row)*g.w + n.Col - g.col; labels[j] == 0 {
+					labels[j] = r.Label
+					stack = append(stack, n)
+				}
+			}
+		}
+		sort.Slice(r.Cells, func(a, b int) bool {
+			ca, cb := r.Cells[a], r.Cells[b]
+			return ca.Row < cb.Row || ca.Row == cb.Row && ca.Col < cb.Col
+		})
+		for _, c := range r.Cells {
+			r.Bounds = r.Bounds.Union(CellRect{c, Cell{c.Col + 1, c.Row + 1}})
+		}
+		r.Outlines = m.regionOutlines(l, r.Cells)
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+// cellNeighbours returns the cells next to a cell, following the orientation
+// of the map, along with the ones that only share a corner if corners is set.
+func (m *tilemap) cellNeighbours(c Cell, corners bool) []Cell {
+	switch m.Orientation {
+	case hexagonal:
+		s := m.staggerNeighbours(c)
+		out := s[:]
+		// the two cells straight along the stagger axis
+		if m.staggerAxisX() {
+			return append(out, Cell{c.Col, c.Row - 1}, Cell{c.Col, c.Row + 1})
+		}
+		return append(out, Cell{c.Col - 1, c.Row}, Cell{c.Col + 1, c.Row})
+	case staggered:
+		s := m.staggerNeighbours(c)
+		out := s[:]
+		if !corners {
+			return out
+		}
+		if m.staggerAxisX() {
+			return append(out, Cell{c.Col, c.Row - 1}, Cell{c.Col + 2, c.Row}, Cell{c.Col, c.Row + 1}, Cell{c.Col - 2, c.Row})
+		}
+		return append(out, Cell{c.Col, c.Row - 2}, Cell{c.Col + 1, c.Row}, Cell{c.Col, c.Row + 2}, Cell{c.Col - 1, c.Row})
+	}
+	out := []Cell{{c.Col, c.Row - 1}, {c.Col + 1, c.Row}, {c.Col, c.Row + 1}, {c.Col - 1, c.Row}}
+	if corners {
+		out = append(out, Cell{c.Col + 1, c.Row - 1}, Cell{c.Col + 1, c.Row + 1}, Cell{c.Col - 1, c.Row + 1}, Cell{c.Col - 1, c.Row - 1})
+	}
+	return out
+}
+
+// cellPolygon returns the corners of the shape of a cell in map pixel space,
+// clockwise on screen: a rectangle on orthogonal maps, a diamond on isometric
+// and staggered maps, and a hexagon on hexagonal maps.
+func (m *tilemap) cellPolygon(l *layer, c Cell) []Vec {
+	p := m.TileToPixel(c.Col, c.Row).Add(Vec{l.Offsetx, l.Offsety})
+	tw, th := float64(m.Tilewidth), float64(m.Tileheight)
+	var ps []Vec
+	switch m.Orientation {
+	case orthogonal:
+		ps = []Vec{{0, 0}, {tw, 0}, {tw, th}, {0, th}}
+	case isometric:
+		ps = []Vec{{tw / 2, 0}, {tw, th / 2}, {tw / 2, th}, {0, th / 2}}
+	default:
+		// staggered maps are hexagonal maps with a side length of zero, and
+		// use the even tile size to line up their cells
+		tw, th = float64(m.Tilewidth&^1), float64(m.Tileheight&^1)
+		sideX, sideY, _, _ := m.staggerMetrics()
+		if m.staggerAxisX() {
+			ps = []Vec{{(tw - sideX) / 2, 0}, {(tw + sideX) / 2, 0}, {tw, th / 2},
+				{(tw + sideX) / 2, th}, {(tw - sideX) / 2, th}, {0, th / 2}}
+		} else {
+			ps = []Vec{{tw / 2, 0}, {tw, (th - sideY) / 2}, {tw, (th + sideY) / 2},
+				{tw / 2, th}, {0, (th + sideY) / 2}, {0, (th - sideY) / 2}}
+		}
+	}
+	out := make([]Vec, 0, len(ps))
+	for i, q := range ps {
+		if i > 0 && q == ps[i-1] || i == len(ps)-1 && q == ps[0] {
+			// sides of zero length
+			continue
+		}
+		out = append(out, p.Add(q))
+	}
+	return out
+}
+
+// regionOutlines traces the loops around a set of cells. Every side of a cell
+// that isn't shared with another cell of the set is on an outline.
+func (m *tilemap) regionOutlines(l *layer, cells []Cell) (out []Outline) {
+	type edge struct {
+		from, to Vec
+	}
+	// corners are matched on a fine grid, so that neighbouring cells meet
+	// exactly even when their corners are worked out differently
+	key := func(v Vec) [2]int64 {
+		return [2]int64{int64(math.Round(v.X * 1024)), int64(math.Round(v.Y * 1024))}
+	}
+	sides := make(map[[2][2]int64]edge)
+	for _, c := range cells {
+		ps := m.cellPolygon(l, c)
+		for i, p := range ps {
+			e := edge{p, ps[(i+1)%len(ps)]}
+			back := [2][2]int64{key(e.to), key(e.from)}
+			if _, ok := sides[back]; ok {
+				// the side is shared with a neighbour
+				delete(sides, back)
+				continue
+			}
+			sides[[2][2]int64{key(e.from), key(e.to)}] = e
+		}
+	}
+	// order the sides so that the outlines come out the same every time
+	var edges []edge
+	for _, e := range sides {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(a, b int) bool {
+		ea, eb := edges[a], edges[b]
+		if ea.from != eb.from {
+			return ea.from.Y < eb.from.Y || ea.from.Y == eb.from.Y && ea.from.X < eb.from.X
+		}
+		return ea.to.Y < eb.to.Y || ea.to.Y == eb.to.Y && ea.to.X < eb.to.X
+	})
+	starts := make(map[[2]int64][]int)
+	for i, e := range edges {
+		starts[key(e.from)] = append(starts[key(e.from)], i)
+	}
+	// link the sides into loops, turning right where two loops touch
+	used := make([]bool, len(edges))
+	for i := range edges {
+		if used[i] {
+			continue
+		}
+		var loop []Vec
+		for cur := i; cur >= 0 && !used[cur]; {
+			used[cur] = true
+			e := edges[cur]
+			loop = append(loop, e.from)
+			d := e.to.Sub(e.from)
+			next, best := -1, math.Inf(-1)
+			for _, n := range starts[key(e.to)] {
+				if used[n] {
+					continue
+				}
+				nd := edges[n].to.Sub(edges[n].from)
+				// right turns have a positive angle with y pointing down
+				if a := math.Atan2(d.X*nd.Y-d.Y*nd.X, d.X*nd.X+d.Y*nd.Y); a > best {
+					next, best = n, a
+				}
+			}
+			cur = next
+		}
+		out = append(out, polygonOutline(loop))
+	}
+	return
+}
+
+// polygonOutline makes an outline out of a loop of points, dropping the points
+// that lie on a straight line.
+func polygonOutline(loop []Vec) (o Outline) {
+	n := len(loop)
+	area := 0.0
+	for i := 0; i < n; i++ {
+		a, b, c := loop[(i+n-1)%n], loop[i], loop[(i+1)%n]
+		if math.Abs((b.X-a.X)*(c.Y-b.Y)-(b.Y-a.Y)*(c.X-b.X)) > 1e-9 {
+			o.Points = append(o.Points, b)
+		}
+		area += b.X*c.Y - c.X*b.Y
+	}
+	o.Hole = area < 0
+	return
+}
+
+// PropertyEquals returns a predicate for tiles that have a property with the
+// given name and value. Numbers are compared by value, so an int matches the
+// same float.
+func PropertyEquals(name string, value interface{}) func(t *Tile) bool {
+	return func(t *Tile) bool {
+		p, ok := findProperty(t.Properties(), name)
+		if !ok {
+			return false
+		}
+		if a, ok := number(p.Value); ok {
+			b, ok := number(value)
+			return ok && a == b
+		}
+		return p.Value == value
+	}
+}
+
+// number converts a numeric property value to a float.
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// TerrainIs returns a predicate for tiles with the named legacy terrain at all
+// four corners.
+func TerrainIs(name string) func(t *Tile) bool {
+	return func(t *Tile) bool {
+		for _, corner := range [4]int{WangTopRight, WangBottomRight, WangBottomLeft, WangTopLeft} {
+			if tt := t.TerrainAt(corner); tt == nil || tt.Name != name {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// WangColorIs returns a predicate for tiles of a wang set of the map that have
+// a color at every edge and corner the wang set uses, taking the flips of the
+// tile into account. Wang sets are picked by index like for Autotile.
+func WangColorIs(m *tilemap, tileset, wangset, color int) func(t *Tile) bool {
+	first, last, ok := m.GidRange(tileset)
+	if !ok || wangset < 0 || wangset >= len(m.Tilesets[tileset].Wangsets) {
+		return func(*Tile) bool { return false }
+	}
+	w := &m.Tilesets[tileset].Wangsets[wangset]
+	return func(t *Tile) bool {
+		if t.Gid() < first || t.Gid() > last {
+			return false
+		}
+		id, ok := w.TileWangId(int(t.Gid() - first))
+		if !ok {
+			return false
+		}
+		id = id.Transform(t.HorizontialFlip(), t.VerticalFlip(), t.DiagonalFlip())
+		for pos, c := range id {
+			if w.uses(pos) && c != color {
+				return false
+			}
+		}
+		return true
+	}
+}
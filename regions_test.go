@@ -0,0 +1,107 @@
+package tmx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConnectedRegions(t *testing.T) {
+	gids := func(gs ...uint32) func(t *Tile) bool {
+		return func(t *Tile) bool {
+			for _, g := range gs {
+				if t.Gid() == g {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	// testdata/base.json with the last row changed:
+	//
+	//	1 1 2 2
+	//	1 3 3 2
+	//	4 4 2 1
+	cases := []struct {
+		name        string
+		orientation string
+		match       func(t *Tile) bool
+		conn        Connectivity
+		cells       [][]Cell
+		outlines    []Outline // outlines of the first region
+	}{
+		{
+			name:     "edges",
+			match:    gids(2),
+			conn:     Connect4,
+			cells:    [][]Cell{{{2, 0}, {3, 0}, {3, 1}}, {{2, 2}}},
+			outlines: []Outline{{Points: []Vec{{32, 0}, {64, 0}, {64, 32}, {48, 32}, {48, 16}, {32, 16}}}},
+		},
+		{
+			name:  "corners",
+			match: gids(2),
+			conn:  Connect8,
+			cells: [][]Cell{{{2, 0}, {3, 0}, {3, 1}, {2, 2}}},
+			// cells that only touch at a corner are outlined apart
+			outlines: []Outline{
+				{Points: []Vec{{32, 0}, {64, 0}, {64, 32}, {48, 32}, {48, 16}, {32, 16}}},
+				{Points: []Vec{{32, 32}, {48, 32}, {48, 48}, {32, 48}}},
+			},
+		},
+		{
+			name:  "hole",
+			match: gids(1, 2, 4),
+			conn:  Connect4,
+			cells: [][]Cell{{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {0, 1}, {3, 1}, {0, 2}, {1, 2}, {2, 2}, {3, 2}}},
+			outlines: []Outline{
+				{Points: []Vec{{0, 0}, {64, 0}, {64, 48}, {0, 48}}},
+				{Points: []Vec{{16, 16}, {16, 32}, {48, 32}, {48, 16}}, Hole: true},
+			},
+		},
+		{
+			name:        "isometric",
+			orientation: isometric,
+			match:       gids(3),
+			conn:        Connect4,
+			cells:       [][]Cell{{{1, 1}, {2, 1}}},
+			// two diamonds side by side along a row make a longer diamond
+			outlines: []Outline{{Points: []Vec{{24, 16}, {40, 32}, {32, 40}, {16, 24}}}},
+		},
+	}
+	for _, c := range cases {
+		m, e := LoadTileMap("testdata/base.json")
+		if e != nil {
+			t.Fatal(e)
+		}
+		if c.orientation != empty {
+			m.Orientation = c.orientation
+		}
+		m.SetTileAt(&m.Layers[0], 2, 2, 2)
+		m.SetTileAt(&m.Layers[0], 3, 2, 1)
+		rs, e := ConnectedRegions(&m, &m.Layers[0], c.match, c.conn)
+		if e != nil {
+			t.Fatalf("%s: %v", c.name, e)
+		}
+		var cells [][]Cell
+		for i, r := range rs {
+			if r.Label != i+1 {
+				t.Errorf("%s: region %d has label %d", c.name, i, r.Label)
+			}
+			cells = append(cells, r.Cells)
+		}
+		if !reflect.DeepEqual(cells, c.cells) {
+			t.Errorf("%s: regions %v, want %v", c.name, cells, c.cells)
+			continue
+		}
+		if !reflect.DeepEqual(rs[0].Outlines, c.outlines) {
+			t.Errorf("%s: outlines %v, want %v", c.name, rs[0].Outlines, c.outlines)
+		}
+	}
+
+	m, e := LoadTileMap("testdata/base.json")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e = ConnectedRegions(&m, &m.Layers[0], gids(1), ConnectHex); e != notHexagonal {
+		t.Errorf("hex connectivity on an orthogonal map gave %v", e)
+	}
+}
@@ -0,0 +1,468 @@
+package tmx
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"  // tileset images may be gifs
+	_ "image/jpeg" // tileset images may be jpegs
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var (
+	// rendering errors
+	nothingToRender = errors.New("the area to render is empty")
+)
+
+// RenderOptions controls how a map is rendered.
+type RenderOptions struct {
+	Layers   LayerFilter // layers to draw, nil for every visible layer
+	Crop     Rect        // area of the map in pixels, empty for the whole map
+	Scale    float64     // output pixels per map pixel, zero for one
+	Outlines bool        // draw the outlines of objects
+	Names    bool        // draw the names of objects
+}
+
+// renderer draws a map into an image.
+type renderer struct {
+	m      *tilemap
+	o      RenderOptions
+	dst    *image.RGBA
+	view   affine                 // map pixel space to image space
+	images map[string]image.Image // decoded images, nil when missing
+}
+
+var (
+	// colors of the things drawn on top of the map
+	outlineColor = color.RGBA{255, 200, 0, 255}
+	nameColor    = color.RGBA{255, 255, 255, 255}
+	shadowColor  = color.RGBA{0, 0, 0, 255}
+	missingColor = color.RGBA{255, 0, 255, 255}
+)
+
+// Render draws the map into an image, the way Tiled would show it. Layers are
+// drawn in order with their offsets and opacity, and tiles and tile objects
+// with their flips. Images that can't be found are drawn as a magenta box so
+// a preview can still be made. Only the image formats of the standard library
+// are supported.
+func (m *tilemap) Render(o RenderOptions) (*image.RGBA, error) {
+	if o.Scale <= 0 {
+		o.Scale = 1
+	}
+	if o.Crop.Empty() {
+		b, e := m.PixelBounds()
+		if e != nil {
+			return nil, e
+		}
+		o.Crop = b
+	}
+	w := int(math.Ceil(o.Crop.Width() * o.Scale))
+	h := int(math.Ceil(o.Crop.Height() * o.Scale))
+	if w <= 0 || h <= 0 {
+		return nil, nothingToRender
+	}
+	r := &renderer{
+		m:      m,
+		o:      o,
+		dst:    image.NewRGBA(image.Rect(0, 0, w, h)),
+		view:   scaling(o.Scale, o.Scale).then(translation(-o.Crop.Min.X, -o.Crop.Min.Y)),
+		images: make(map[string]image.Image),
+	}
+	if c, ok := parseColor(m.Backgroundcolor); ok {
+		for i := 0; i < len(r.dst.Pix); i += 4 {
+			r.dst.Pix[i], r.dst.Pix[i+1], r.dst.Pix[i+2], r.dst.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+	}
+	if e := r.layers(m.Layers, Vec{}, 1); e != nil {
+		return nil, e
+	}
+	return r.dst, nil
+}
+
+// PixelBounds returns the area the tiles of the map cover in map pixel space.
+// For infinite maps it is the area of the cells that hold tiles.
+func (m *tilemap) PixelBounds() (b Rect, e error) {
+	cells := CellRect{Max: Cell{m.Width, m.Height}}
+	if m.Infinite {
+		if cells, e = m.UsedBounds(); e != nil {
+			return
+		}
+	}
+	if cells.Empty() {
+		return b, nothingToRender
+	}
+	// the cells along the border are the ones furthest out in every
+	// orientation
+	tile := Vec{float64(m.Tilewidth), float64(m.Tileheight)}
+	first := true
+	add := func(col, row int) {
+		if !cells.Contains(Cell{col, row}) {
+			return
+		}
+		p := m.TileToPixel(col, row)
+		r := Rect{Min: p, Max: p.Add(tile)}
+		if first {
+			b, first = r, false
+		}
+		b = b.Union(r)
+	}
+	for col := cells.Min.Col; col < cells.Max.Col; col++ {
+		add(col, cells.Min.Row)
+		add(col, cells.Min.Row+1)
+		add(col, cells.Max.Row-1)
+		add(col, cells.Max.Row-2)
+	}
+	for row := cells.Min.Row; row < cells.Max.Row; row++ {
+		add(cells.Min.Col, row)
+		add(cells.Min.Col+1, row)
+		add(cells.Max.Col-1, row)
+		add(cells.Max.Col-2, row)
+	}
+	return
+}
+
+// layers draws a set of layers in order.
+func (r *renderer) layers(ls []layer, off Vec, opacity float64) error {
+	for i := 0; i < len(ls); i++ {
+		l := &ls[i]
+		if r.o.Layers == nil && !l.Visible || r.o.Layers != nil && !r.o.Layers(l) {
+			continue
+		}
+		o := off.Add(Vec{l.Offsetx, l.Offsety})
+		a := opacity * l.Opacity
+		var e error
+		switch l.Type {
+		case groupLayer:
+			e = r.layers(l.Layers, o, a)
+		case tileLayer:
+			e = r.tileLayer(l, o, a)
+		case objectLayer:
+			r.objectLayer(l, o, a)
+		default:
+			if l.Image != empty {
+				img := r.image(l.Image)
+				var sr image.Rectangle
+				if img != nil {
+					sr = img.Bounds()
+				}
+				r.draw(img, sr, translation(o.X, o.Y), a)
+			}
+		}
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// tileLayer draws the tiles of a layer, aligned to the bottom left corner of
+// their cell.
+func (r *renderer) tileLayer(l *layer, off Vec, opacity float64) error {
+	return r.m.eachTile(l, func(col, row int, t *Tile) {
+		if t.Nil() {
+			return
+		}
+		rect, e := r.m.TileImage(t.gid)
+		if e != nil {
+			return
+		}
+		w, h := float64(rect.Width), float64(rect.Height)
+		p := r.m.TileToPixel(col, row).Add(off)
+		p.Y += float64(r.m.Tileheight) - h
+		if t.set != nil {
+			p = p.Add(Vec{float64(t.set.TileOffsets.X), float64(t.set.TileOffsets.Y)})
+		}
+		place := translation(p.X, p.Y).then(flipping(w, h, t.horizontialFlip, t.verticalFlip, t.diagonalFlip))
+		r.drawRect(rect, place, opacity)
+	})
+}
+
+// objectLayer draws the tile objects of a layer, and the outlines and names of
+// every object when asked to.
+func (r *renderer) objectLayer(l *layer, off Vec, opacity float64) {
+	for i := 0; i < len(l.Objects); i++ {
+		o := &l.Objects[i]
+		if !o.Visible || o.Gid == 0 {
+			continue
+		}
+		rect, e := r.m.TileImage(uint32(o.Gid))
+		if e != nil {
+			continue
+		}
+		w, h := float64(rect.Width), float64(rect.Height)
+		if w == 0 || h == 0 {
+			continue
+		}
+		box := o.tileBox()
+		place := translation(off.X, off.Y).then(o.transform()).
+			then(translation(box.Min.X, box.Min.Y)).
+			then(scaling(box.Width()/w, box.Height()/h)).
+			then(flipping(w, h, o.HorizontialFlip, o.VerticalFlip, o.DiagonalFlip))
+		r.drawRect(rect, place, opacity)
+	}
+	for i := 0; i < len(l.Objects); i++ {
+		o := &l.Objects[i]
+		if !o.Visible {
+			continue
+		}
+		if r.o.Outlines {
+			ps := translation(off.X, off.Y).applyAll(o.WorldPolygon())
+			r.outline(ps, o.Gid != 0 || len(o.Polyline) == 0)
+		}
+		if r.o.Names && o.Name != empty {
+			p := r.view.apply(o.Bounds().Min.Add(off))
+			r.text(int(p.X), int(p.Y)-glyphHeight-2, o.Name)
+		}
+	}
+}
+
+// drawRect draws the region of an image a tile comes from.
+func (r *renderer) drawRect(rect ImageRect, place affine, opacity float64) {
+	img := r.image(rect.Source)
+	sr := image.Rect(rect.X, rect.Y, rect.X+rect.Width, rect.Y+rect.Height)
+	if img != nil {
+		sr = sr.Add(img.Bounds().Min)
+	}
+	r.draw(img, sr, place, opacity)
+}
+
+// image returns a decoded image from a path relative to the map, or nil if it
+// can't be read.
+func (r *renderer) image(src string) image.Image {
+	if img, ok := r.images[src]; ok {
+		return img
+	}
+	fp := filepath.FromSlash(src)
+	if !filepath.IsAbs(fp) {
+		fp = filepath.Join(r.m.dir, fp)
+	}
+	var img image.Image
+	if f, e := os.Open(fp); e == nil {
+		img, _, _ = image.Decode(f)
+		f.Close()
+	}
+	r.images[src] = img
+	return img
+}
+
+// draw blends a region of an image into the output, placing the region with a
+// transform from its own pixels into map pixel space. Pixels are sampled at
+// their centers from the nearest source pixel. A nil image draws a magenta box
+// in place of the region.
+func (r *renderer) draw(img image.Image, sr image.Rectangle, place affine, opacity float64) {
+	w, h := float64(sr.Dx()), float64(sr.Dy())
+	if w <= 0 || h <= 0 || opacity <= 0 {
+		return
+	}
+	t := r.view.then(place)
+	b := boundsOf(t.applyAll([]Vec{{0, 0}, {w, 0}, {w, h}, {0, h}}))
+	area := image.Rect(int(math.Floor(b.Min.X)), int(math.Floor(b.Min.Y)),
+		int(math.Ceil(b.Max.X)), int(math.Ceil(b.Max.Y))).Intersect(r.dst.Rect)
+	inv := t.inverse()
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			q := inv.apply(Vec{float64(x) + 0.5, float64(y) + 0.5})
+			if q.X < 0 || q.Y < 0 || q.X >= w || q.Y >= h {
+				continue
+			}
+			var c color.Color = missingColor
+			if img != nil {
+				c = img.At(sr.Min.X+int(q.X), sr.Min.Y+int(q.Y))
+			}
+			r.blend(x, y, c, opacity)
+		}
+	}
+}
+
+// blend draws a color over a pixel of the output with the given opacity.
+func (r *renderer) blend(x, y int, c color.Color, opacity float64) {
+	sr, sg, sb, sa := c.RGBA()
+	if sa == 0 {
+		return
+	}
+	i := r.dst.PixOffset(x, y)
+	p := r.dst.Pix[i : i+4]
+	// colors are premultiplied, scale the source and keep what shows through
+	k := opacity / 0xffff
+	keep := 1 - float64(sa)*k
+	mix := func(s uint32, d uint8) uint8 {
+		return uint8(math.Min(float64(s)*k*0xff+float64(d)*keep+0.5, 0xff))
+	}
+	p[0], p[1], p[2], p[3] = mix(sr, p[0]), mix(sg, p[1]), mix(sb, p[2]), mix(sa, p[3])
+}
+
+// outline draws lines between points in map pixel space, back to the first
+// point when the outline is closed. A single point is drawn as a cross.
+func (r *renderer) outline(ps []Vec, closed bool) {
+	if len(ps) == 1 {
+		p := r.view.apply(ps[0])
+		r.line(p.Sub(Vec{3, 0}), p.Add(Vec{3, 0}), outlineColor)
+		r.line(p.Sub(Vec{0, 3}), p.Add(Vec{0, 3}), outlineColor)
+		return
+	}
+	for i := 0; i+1 < len(ps); i++ {
+		r.line(r.view.apply(ps[i]), r.view.apply(ps[i+1]), outlineColor)
+	}
+	if closed && len(ps) > 2 {
+		r.line(r.view.apply(ps[len(ps)-1]), r.view.apply(ps[0]), outlineColor)
+	}
+}
+
+// line draws a line between two points in image space with Bresenham's
+// algorithm.
+func (r *renderer) line(a, b Vec, c color.RGBA) {
+	x0, y0 := int(math.Floor(a.X)), int(math.Floor(a.Y))
+	x1, y1 := int(math.Floor(b.X)), int(math.Floor(b.Y))
+	dx, dy := absInt(x1-x0), -absInt(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		if (image.Point{x0, y0}).In(r.dst.Rect) {
+			r.dst.SetRGBA(x0, y0, c)
+		}
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * err; e2 >= dy {
+			err += dy
+			x0 += sx
+		} else {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+// absInt returns the absolute value of an int.
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// text draws a string in image space with the top left corner at x, y, using
+// a small built in font with a shadow so it reads on any background.
+func (r *renderer) text(x, y int, s string) {
+	for _, pass := range []struct {
+		d int
+		c color.RGBA
+	}{{1, shadowColor}, {0, nameColor}} {
+		cx := x
+		for _, ch := range s {
+			g := glyph(ch)
+			for row := 0; row < glyphHeight; row++ {
+				for col := 0; col < glyphWidth; col++ {
+					if g[row]&(1<<uint(glyphWidth-1-col)) == 0 {
+						continue
+					}
+					p := image.Point{cx + col + pass.d, y + row + pass.d}
+					if p.In(r.dst.Rect) {
+						r.dst.SetRGBA(p.X, p.Y, pass.c)
+					}
+				}
+			}
+			cx += glyphWidth + 1
+		}
+	}
+}
+
+// parseColor parses a color written as #rrggbb or #aarrggbb.
+func parseColor(s string) (c color.RGBA, ok bool) {
+	if !validColor(s) || s == empty {
+		return c, false
+	}
+	n, e := strconv.ParseUint(s[1:], 16, 32)
+	if e != nil {
+		return c, false
+	}
+	c = color.RGBA{uint8(n >> 16), uint8(n >> 8), uint8(n), 0xff}
+	if len(s) == 9 {
+		c.A = uint8(n >> 24)
+	}
+	// premultiply the alpha
+	c.R = uint8(uint32(c.R) * uint32(c.A) / 0xff)
+	c.G = uint8(uint32(c.G) * uint32(c.A) / 0xff)
+	c.B = uint8(uint32(c.B) * uint32(c.A) / 0xff)
+	return c, true
+}
+
+const (
+	// size of a glyph of the built in font
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+// glyphs is a 5x7 font covering digits, letters, and some punctuation, one
+// byte per row with the leftmost pixel in the highest bit. Lower case letters
+// are drawn as upper case.
+var glyphs = map[rune][glyphHeight]uint8{
+	'A': {0x0E, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'B': {0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E},
+	'C': {0x0E, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0E},
+	'D': {0x1E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x1E},
+	'E': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x1F},
+	'F': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x10},
+	'G': {0x0E, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0F},
+	'H': {0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'I': {0x0E, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'J': {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0C},
+	'K': {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L': {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1F},
+	'M': {0x11, 0x1B, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N': {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O': {0x0E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'P': {0x1E, 0x11, 0x11, 0x1E, 0x10, 0x10, 0x10},
+	'Q': {0x0E, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0D},
+	'R': {0x1E, 0x11, 0x11, 0x1E, 0x14, 0x12, 0x11},
+	'S': {0x0F, 0x10, 0x10, 0x0E, 0x01, 0x01, 0x1E},
+	'T': {0x1F, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U': {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'V': {0x11, 0x11, 0x11, 0x11, 0x11, 0x0A, 0x04},
+	'W': {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0A},
+	'X': {0x11, 0x11, 0x0A, 0x04, 0x0A, 0x11, 0x11},
+	'Y': {0x11, 0x11, 0x11, 0x0A, 0x04, 0x04, 0x04},
+	'Z': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1F},
+	'0': {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E},
+	'1': {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F},
+	'3': {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4': {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02},
+	'5': {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6': {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E},
+	'7': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E},
+	'9': {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	' ': {},
+	'-': {0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00},
+	'_': {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1F},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C},
+	':': {0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x0C, 0x00},
+	'/': {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	'(': {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')': {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'#': {0x0A, 0x0A, 0x1F, 0x0A, 0x1F, 0x0A, 0x0A},
+	'?': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+}
+
+// glyph returns the glyph of a character, a question mark for characters the
+// font doesn't have.
+func glyph(r rune) [glyphHeight]uint8 {
+	if r >= 'a' && r <= 'z' {
+		r -= 'a' - 'A'
+	}
+	if g, ok := glyphs[r]; ok {
+		return g
+	}
+	return glyphs['?']
+}
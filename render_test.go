@@ -0,0 +1,110 @@
+package tmx
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	// tile 0 is red on the left and blue on the right, tile 1 is green
+	red, blue, green := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}, color.RGBA{0, 255, 0, 255}
+	img := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			c := green
+			if x < 2 {
+				c = red
+			} else if x < 4 {
+				c = blue
+			}
+			img.Set(x, y, c)
+		}
+	}
+	dir := t.TempDir()
+	f, e := os.Create(filepath.Join(dir, "tiles.png"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e = png.Encode(f, img); e != nil {
+		t.Fatal(e)
+	}
+	f.Close()
+
+	m := &tilemap{Orientation: orthogonal, Width: 3, Height: 1, Tilewidth: 4, Tileheight: 4,
+		Backgroundcolor: "#000000", dir: dir}
+	m.Tilesets = []tileset{{Firstgid: 1, Name: "tiles", Tilewidth: 4, Tileheight: 4, Tilecount: 2, Columns: 2,
+		Image: "tiles.png", Imagewidth: 8, Imageheight: 4}}
+	tiles := func(gids ...uint32) (ts []*Tile) {
+		for _, gid := range gids {
+			tile, e := m.makeTile(gid)
+			if e != nil {
+				t.Fatal(e)
+			}
+			ts = append(ts, tile)
+		}
+		return
+	}
+	m.Layers = []layer{
+		{Name: "ground", Type: tileLayer, Width: 3, Height: 1, Visible: true, Opacity: 1,
+			Data: tiles(1, 1|horizontalFlag, 2)},
+		// hidden layers aren't drawn
+		{Name: "hidden", Type: tileLayer, Width: 3, Height: 1, Opacity: 1, Data: tiles(2, 2, 2)},
+	}
+
+	cases := []struct {
+		name  string
+		o     RenderOptions
+		size  image.Point
+		x, y  int
+		color color.RGBA
+	}{
+		{"left of the tile", RenderOptions{}, image.Pt(12, 4), 0, 0, red},
+		{"right of the tile", RenderOptions{}, image.Pt(12, 4), 3, 3, blue},
+		{"flipped tile", RenderOptions{}, image.Pt(12, 4), 4, 0, blue},
+		{"right of the flipped tile", RenderOptions{}, image.Pt(12, 4), 7, 0, red},
+		{"other tile", RenderOptions{}, image.Pt(12, 4), 9, 2, green},
+		{"scaled", RenderOptions{Scale: 2}, image.Pt(24, 8), 3, 7, red},
+		{"scaled right", RenderOptions{Scale: 2}, image.Pt(24, 8), 4, 0, blue},
+		{"cropped", RenderOptions{Crop: Rect{Vec{4, 0}, Vec{8, 4}}}, image.Pt(4, 4), 0, 0, blue},
+		{"hidden layer", RenderOptions{Layers: LayersNamed("hidden")}, image.Pt(12, 4), 0, 0, green},
+	}
+	for _, c := range cases {
+		out, e := m.Render(c.o)
+		if e != nil {
+			t.Errorf("%s: %v", c.name, e)
+			continue
+		}
+		if out.Rect.Size() != c.size {
+			t.Errorf("%s: image is %v, want %v", c.name, out.Rect.Size(), c.size)
+		}
+		if got := out.RGBAAt(c.x, c.y); got != c.color {
+			t.Errorf("%s: pixel %d,%d is %v, want %v", c.name, c.x, c.y, got, c.color)
+		}
+	}
+
+	// half opacity over the black background
+	m.Layers[0].Opacity = 0.5
+	out, e := m.Render(RenderOptions{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got, want := out.RGBAAt(0, 0), (color.RGBA{128, 0, 0, 255}); got != want {
+		t.Errorf("half opacity: pixel is %v, want %v", got, want)
+	}
+
+	// an image that can't be found shows as a magenta box
+	m.Layers[0].Opacity = 1
+	m.Tilesets[0].Image = "gone.png"
+	if out, e = m.Render(RenderOptions{}); e != nil || out.RGBAAt(0, 0) != missingColor {
+		t.Errorf("missing image: %v, %v", out.RGBAAt(0, 0), e)
+	}
+
+	m.Width = 0
+	if _, e = m.Render(RenderOptions{}); e != nothingToRender {
+		t.Errorf("empty map: %v", e)
+	}
+}
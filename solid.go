@@ -0,0 +1,282 @@
+package tmx
+
+import "errors"
+
+var (
+	// solid area errors
+	notOrthogonal = errors.New("tiles can only be merged into rectangles on orthogonal maps")
+)
+
+// SolidProperty returns a predicate for tiles that have a bool property with
+// the given name set to true.
+func SolidProperty(name string) func(t *Tile) bool {
+	return func(t *Tile) bool {
+		p, ok := findProperty(t.Properties(), name)
+		if !ok {
+			return false
+		}
+		b, _ := p.Value.(bool)
+		return b
+	}
+}
+
+// HasCollisionShapes is a predicate for tiles that have shapes in the tile
+// collision editor.
+func HasCollisionShapes(t *Tile) bool {
+	return len(t.CollisionShapes()) > 0
+}
+
+// cellGrid is a dense grid of which cells of a tile layer are solid.
+type cellGrid struct {
+	col, row int    // cell of the top left corner of the grid
+	w, h     int    // size of the grid in cells
+	solid    []bool // row major
+}
+
+// at returns whether a cell is solid, cells outside the grid are not.
+func (g *cellGrid) at(col, row int) bool {
+	x, y := col-g.col, row-g.row
+	if x < 0 || y < 0 || x >= g.w || y >= g.h {
+		return false
+	}
+	return g.solid[y*g.w+x]
+}
+
+// solidCells builds a grid of the cells of a layer that match the predicate.
+// On infinite maps the grid covers every chunk.
+func (m *tilemap) solidCells(l *layer, solid func(t *Tile) bool) (*cellGrid, error) {
+	g := &cellGrid{w: l.Width, h: l.Height}
+	if m.Infinite {
+		if e := l.Decode(); e != nil {
+			return nil, e
+		}
+		// the grid covers the bounding box of the chunks
+		g.w, g.h = 0, 0
+		for i := 0; i < len(l.Chunks); i++ {
+			c := &l.Chunks[i]
+			if i == 0 {
+				g.col, g.row, g.w, g.h = c.X, c.Y, c.Width, c.Height
+				continue
+			}
+			maxCol, maxRow := maxInt(g.col+g.w, c.X+c.Width), maxInt(g.row+g.h, c.Y+c.Height)
+			g.col, g.row = minInt(g.col, c.X), minInt(g.row, c.Y)
+			g.w, g.h = maxCol-g.col, maxRow-g.row
+		}
+	}
+	g.solid = make([]bool, g.w*g.h)
+	e := m.eachTile(l, func(col, row int, t *Tile) {
+		if !t.Nil() && solid(t) {
+			g.solid[(row-g.row)*g.w+(col-g.col)] = true
+		}
+	})
+	return g, e
+}
+
+// MergeRects merges the tiles of a layer that match the predicate into
+// rectangles in map pixel space. Runs of solid cells are grown greedily along
+// rows and then down columns, which yields few rectangles without any seams
+// inside of a solid area. The greedy merge is an approximation: some shapes
+// could be covered by fewer rectangles. Infinite maps are merged across chunk
+// boundaries. The cells of other orientations aren't rectangles, so only
+// orthogonal maps can be merged; use Outlines for those.
+func MergeRects(m *tilemap, l *layer, solid func(t *Tile) bool) ([]Rect, error) {
+	if !m.orthogonal() {
+		return nil, notOrthogonal
+	}
+	g, e := m.solidCells(l, solid)
+	if e != nil {
+		return nil, e
+	}
+	used := make([]bool, len(g.solid))
+	free := func(x, y int) bool {
+		i := y*g.w + x
+		return g.solid[i] && !used[i]
+	}
+	var rs []Rect
+	for y := 0; y < g.h; y++ {
+		for x := 0; x < g.w; x++ {
+			if !free(x, y) {
+				continue
+			}
+			// grow to the right
+			w := 1
+			for x+w < g.w && free(x+w, y) {
+				w++
+			}
+			// grow downwards while the whole run is solid
+			h := 1
+		grow:
+			for y+h < g.h {
+				for i := 0; i < w; i++ {
+					if !free(x+i, y+h) {
+						break grow
+					}
+				}
+				h++
+			}
+			for j := 0; j < h; j++ {
+				for i := 0; i < w; i++ {
+					used[(y+j)*g.w+x+i] = true
+				}
+			}
+			rs = append(rs, m.cellRect(l, g.col+x, g.row+y, w, h))
+		}
+	}
+	return rs, nil
+}
+
+// cellRect returns the pixel rectangle covered by a block of cells of an
+// orthogonal map.
+func (m *tilemap) cellRect(l *layer, col, row, w, h int) Rect {
+	off := Vec{l.Offsetx, l.Offsety}
+	return Rect{Min: m.TileToPixel(col, row).Add(off), Max: m.TileToPixel(col+w, row+h).Add(off)}
+}
+
+// orthogonal returns whether the cells of the map are rectangles lined up with
+// the axes.
+func (m *tilemap) orthogonal() bool {
+	return m.Orientation == orthogonal || m.Orientation == empty
+}
+
+// Outline is a closed loop around a solid area of a tile layer. Outer
+// outlines wind clockwise on screen and holes wind counter clockwise, which
+// suits both polygon colliders and looped chain colliders.
+type Outline struct {
+	Points []Vec // corners of the loop in map pixel space
+	Hole   bool  // whether the loop is the edge of a hole in a solid area
+}
+
+// Outlines traces the edges of the solid areas of a layer. Each area yields an
+// outer loop and a loop for every hole inside of it. Areas that only touch at
+// a corner are kept apart. On isometric, staggered and hexagonal maps the
+// loops follow the sides of the diamond or hexagon shaped cells.
+func Outlines(m *tilemap, l *layer, solid func(t *Tile) bool) ([]Outline, error) {
+	g, e := m.solidCells(l, solid)
+	if e != nil {
+		return nil, e
+	}
+	if !m.orthogonal() {
+		var cells []Cell
+		for i, s := range g.solid {
+			if s {
+				cells = append(cells, Cell{g.col + i%g.w, g.row + i/g.w})
+			}
+		}
+		return m.regionOutlines(l, cells), nil
+	}
+	type edge struct {
+		from, to [2]int
+	}
+	// collect every cell side between a solid and an empty cell, walking
+	// clockwise around each solid cell
+	var edges []edge
+	starts := make(map[[2]int][]int)
+	add := func(x0, y0, x1, y1 int) {
+		starts[[2]int{x0, y0}] = append(starts[[2]int{x0, y0}], len(edges))
+		edges = append(edges, edge{[2]int{x0, y0}, [2]int{x1, y1}})
+	}
+	for y := 0; y < g.h; y++ {
+		for x := 0; x < g.w; x++ {
+			c, r := g.col+x, g.row+y
+			if !g.at(c, r) {
+				continue
+			}
+			if !g.at(c, r-1) {
+				add(c, r, c+1, r)
+			}
+			if !g.at(c+1, r) {
+				add(c+1, r, c+1, r+1)
+			}
+			if !g.at(c, r+1) {
+				add(c+1, r+1, c, r+1)
+			}
+			if !g.at(c-1, r) {
+				add(c, r+1, c, r)
+			}
+		}
+	}
+	// link the edges into loops, turning right where two loops touch
+	used := make([]bool, len(edges))
+	var out []Outline
+	for i := range edges {
+		if used[i] {
+			continue
+		}
+		var loop [][2]int
+		cur := i
+		for !used[cur] {
+			used[cur] = true
+			ed := edges[cur]
+			loop = append(loop, ed.from)
+			dir := [2]int{ed.to[0] - ed.from[0], ed.to[1] - ed.from[1]}
+			next, best := -1, 3
+			for _, n := range starts[ed.to] {
+				if used[n] {
+					continue
+				}
+				nd := [2]int{edges[n].to[0] - edges[n].from[0], edges[n].to[1] - edges[n].from[1]}
+				if t := turn(dir, nd); t < best {
+					next, best = n, t
+				}
+			}
+			if next < 0 {
+				break
+			}
+			cur = next
+		}
+		out = append(out, m.outline(l, simplifyLoop(loop)))
+	}
+	return out, nil
+}
+
+// turn ranks a change of direction, right turns first then straight ahead
+// and finally left turns.
+func turn(d, n [2]int) int {
+	switch {
+	case n[0] == -d[1] && n[1] == d[0]:
+		return 0
+	case n == d:
+		return 1
+	}
+	return 2
+}
+
+// simplifyLoop drops the corners of a loop that lie on a straight line.
+func simplifyLoop(loop [][2]int) (out [][2]int) {
+	n := len(loop)
+	for i := 0; i < n; i++ {
+		a, b, c := loop[(i+n-1)%n], loop[i], loop[(i+1)%n]
+		if (b[0]-a[0])*(c[1]-b[1])-(b[1]-a[1])*(c[0]-b[0]) != 0 {
+			out = append(out, b)
+		}
+	}
+	return
+}
+
+// outline converts a loop of cell corners of an orthogonal map into pixel
+// space.
+func (m *tilemap) outline(l *layer, loop [][2]int) (o Outline) {
+	off := Vec{l.Offsetx, l.Offsety}
+	area := 0.0
+	for i, c := range loop {
+		o.Points = append(o.Points, m.TileToPixel(c[0], c[1]).Add(off))
+		n := loop[(i+1)%len(loop)]
+		area += float64(c[0]*n[1] - n[0]*c[1])
+	}
+	o.Hole = area < 0
+	return
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,186 @@
+package tmx
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"unsafe"
+)
+
+// StreamChunks keeps the chunk data of infinite maps encoded when the map is
+// loaded. Chunks are decoded when a region that overlaps them is requested
+// through LoadRegion, and the least recently requested chunks are encoded
+// again whenever the decoded chunks take up more than budget bytes. Anything
+// that reads a whole layer only sees the chunks that are decoded at the time.
+func StreamChunks(budget int) Option {
+	return func(o *options) {
+		o.budget = budget
+	}
+}
+
+// chunkCache tracks the decoded chunks of a streamed map, most recently used
+// at the front.
+type chunkCache struct {
+	mu     sync.Mutex
+	budget int                      // bytes the decoded chunks may take up
+	used   int                      // bytes the decoded chunks take up
+	lru    *list.List               // of *cachedChunk
+	items  map[*chunk]*list.Element // decoded chunks
+}
+
+// cachedChunk is a decoded chunk.
+type cachedChunk struct {
+	c    *chunk
+	size int // estimated bytes of the decoded tiles
+}
+
+// streaming returns whether the chunks of the map are streamed.
+func (m *tilemap) streaming() bool {
+	return m.Infinite && m.opts.budget > 0
+}
+
+// streamLayer keeps the encoded data of every chunk in a layer so chunks can
+// be decoded and dropped again.
+func (m *tilemap) streamLayer(l *layer) {
+	if m.cache == nil {
+		m.cache = &chunkCache{
+			budget: m.opts.budget,
+			lru:    list.New(),
+			items:  make(map[*chunk]*list.Element),
+		}
+	}
+	l.stream = m.cache
+	for i := 0; i < len(l.Chunks); i++ {
+		l.Chunks[i].raw = l.Chunks[i].Data
+	}
+}
+
+// LoadRegion decodes the chunks of a tile layer that overlap a rectangle of
+// cells and returns them. Chunks decoded by earlier calls may be dropped to
+// stay within the budget, so only the chunks of the latest call are sure to
+// be decoded. Maps that aren't streamed have every chunk decoded already.
+// Chunks that fail to decode on a map loaded with Tolerant are left out and
+// reported by Validate.
+//
+// A later call may drop the chunks returned here, so goroutines that read a
+// streamed map while others load regions of it should go through TileAt.
+func (m *tilemap) LoadRegion(l *layer, r CellRect) (cs []*chunk, e error) {
+	cs = l.chunksIn(r)
+	if !m.streaming() || m.cache == nil {
+		return cs, l.Decode()
+	}
+	cc := m.cache
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	wanted := make(map[*chunk]bool, len(cs))
+	n := 0
+	for _, c := range cs {
+		wanted[c] = true
+		if el, ok := cc.items[c]; ok {
+			cc.lru.MoveToFront(el)
+			cs[n], n = c, n+1
+			continue
+		}
+		if e = m.processTileData(&c.Data, *l, c.Width*c.Height); e != nil {
+			c.Data = c.raw
+			if e = m.tolerate(problem{check: checkTileData, layer: l, e: e}); e != nil {
+				return nil, e
+			}
+			continue
+		}
+		cs[n], n = c, n+1
+		size := decodedSize(c.Tiles())
+		cc.items[c] = cc.lru.PushFront(&cachedChunk{c: c, size: size})
+		cc.used += size
+	}
+	// drop the least recently used chunks, never the ones just requested
+	for el := cc.lru.Back(); el != nil && cc.used > cc.budget; {
+		prev := el.Prev()
+		cached := el.Value.(*cachedChunk)
+		if !wanted[cached.c] {
+			cached.c.Data = cached.c.raw
+			cc.used -= cached.size
+			cc.lru.Remove(el)
+			delete(cc.items, cached.c)
+		}
+		el = prev
+	}
+	return cs[:n], nil
+}
+
+// chunksIn returns the chunks of a layer that overlap a rectangle of cells.
+// Chunks on a single grid are looked up by their chunk coordinates, unless the
+// rectangle covers more of them than the layer has.
+func (l *layer) chunksIn(r CellRect) (cs []*chunk) {
+	if r.Empty() {
+		return nil
+	}
+	if l.chunkIndex == nil {
+		l.indexChunks()
+	}
+	idx := l.chunkIndex
+	if idx.uniform && idx.w > 0 && idx.h > 0 {
+		min := Cell{floorDiv(r.Min.Col, idx.w), floorDiv(r.Min.Row, idx.h)}
+		max := Cell{floorDiv(r.Max.Col-1, idx.w), floorDiv(r.Max.Row-1, idx.h)}
+		if n := (max.Col - min.Col + 1) * (max.Row - min.Row + 1); n <= len(l.Chunks) {
+			for cy := min.Row; cy <= max.Row; cy++ {
+				for cx := min.Col; cx <= max.Col; cx++ {
+					if c := l.Chunk(cx, cy); c != nil {
+						cs = append(cs, c)
+					}
+				}
+			}
+			return
+		}
+	}
+	for i := 0; i < len(l.Chunks); i++ {
+		c := &l.Chunks[i]
+		if r.Min.Col < c.X+c.Width && c.X < r.Max.Col && r.Min.Row < c.Y+c.Height && c.Y < r.Max.Row {
+			cs = append(cs, c)
+		}
+	}
+	return
+}
+
+// LoadPixelRegion is LoadRegion for a rectangle in map pixel space. The right
+// and bottom edges of the rectangle are left out, so a rectangle lined up with
+// the cells doesn't reach into the next row and column of chunks.
+func (m *tilemap) LoadPixelRegion(l *layer, r Rect) ([]*chunk, error) {
+	// move the right and bottom edges just inside, a rectangle without any
+	// width or height still loads the cells it is on
+	const inside = 1e-6
+	if w := r.Width(); w > 0 {
+		r.Max.X -= math.Min(inside, w/2)
+	}
+	if h := r.Height(); h > 0 {
+		r.Max.Y -= math.Min(inside, h/2)
+	}
+	var cr CellRect
+	for _, p := range rectPoints(r) {
+		c, rw := m.PixelToTile(p)
+		cr = cr.Union(CellRect{Min: Cell{c, rw}, Max: Cell{c + 1, rw + 1}})
+	}
+	return m.LoadRegion(l, cr)
+}
+
+// DecodedBytes returns the estimated number of bytes the decoded chunks of a
+// streamed map take up.
+func (m *tilemap) DecodedBytes() int {
+	if m.cache == nil {
+		return 0
+	}
+	m.cache.mu.Lock()
+	defer m.cache.mu.Unlock()
+	return m.cache.used
+}
+
+// decodedSize estimates the bytes taken up by a slice of decoded tiles.
+func decodedSize(ts []*Tile) int {
+	n := len(ts) * int(unsafe.Sizeof(ts[0]))
+	for _, t := range ts {
+		if !t.Nil() {
+			n += int(unsafe.Sizeof(*t))
+		}
+	}
+	return n
+}
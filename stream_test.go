@@ -0,0 +1,132 @@
+package tmx
+
+import "testing"
+
+func TestLoadRegion(t *testing.T) {
+	m, e := LoadTileMap("testdata/infinite.json", StreamChunks(1))
+	if e != nil {
+		t.Fatal(e)
+	}
+	l := &m.Layers[0]
+	type chunkAt struct{ X, Y int }
+	cells := []struct {
+		r    CellRect
+		want []chunkAt
+	}{
+		{CellRect{Cell{0, 0}, Cell{16, 16}}, []chunkAt{{0, 0}}},
+		{CellRect{Cell{15, 0}, Cell{17, 1}}, []chunkAt{{0, 0}, {16, 0}}},
+		{CellRect{Cell{-1, 0}, Cell{17, 17}}, []chunkAt{{0, 0}, {16, 0}, {-16, 16}}},
+		{CellRect{Cell{-100, -100}, Cell{100, 100}}, []chunkAt{{0, 0}, {16, 0}, {-16, 16}}},
+		{CellRect{Cell{40, 40}, Cell{50, 50}}, nil},
+		{CellRect{}, nil},
+	}
+	pixels := []struct {
+		r    Rect
+		want []chunkAt
+	}{
+		// lined up with the chunk, the edges don't reach the next ones
+		{Rect{Vec{0, 0}, Vec{256, 256}}, []chunkAt{{0, 0}}},
+		{Rect{Vec{0, 0}, Vec{257, 1}}, []chunkAt{{0, 0}, {16, 0}}},
+		// a point still loads the chunk it is in
+		{Rect{Vec{10, 10}, Vec{10, 10}}, []chunkAt{{0, 0}}},
+	}
+	check := func(what interface{}, cs []*chunk, e error, want []chunkAt) {
+		t.Helper()
+		if e != nil {
+			t.Fatalf("%v: %v", what, e)
+		}
+		var got []chunkAt
+		for _, c := range cs {
+			got = append(got, chunkAt{c.X, c.Y})
+			if c.Tiles() == nil {
+				t.Errorf("%v: chunk %d,%d isn't decoded", what, c.X, c.Y)
+			}
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%v: got chunks %v, want %v", what, got, want)
+		}
+		seen := make(map[chunkAt]bool)
+		for _, c := range got {
+			seen[c] = true
+		}
+		for _, c := range want {
+			if !seen[c] {
+				t.Errorf("%v: got chunks %v, want %v", what, got, want)
+			}
+		}
+	}
+	for _, c := range cells {
+		cs, e := m.LoadRegion(l, c.r)
+		check(c.r, cs, e, c.want)
+	}
+	for _, c := range pixels {
+		cs, e := m.LoadPixelRegion(l, c.r)
+		check(c.r, cs, e, c.want)
+	}
+}
+
+func TestLoadRegionTolerant(t *testing.T) {
+	all := CellRect{Cell{-100, -100}, Cell{100, 100}}
+	for _, tolerant := range []bool{false, true} {
+		opts := []Option{StreamChunks(1)}
+		if tolerant {
+			opts = append(opts, Tolerant())
+		}
+		m, e := LoadTileMap("testdata/infinite.json", opts...)
+		if e != nil {
+			t.Fatal(e)
+		}
+		l := &m.Layers[0]
+		c := l.ChunkAt(16, 0)
+		c.Data, c.raw = "not base64", "not base64"
+		cs, e := m.LoadRegion(l, all)
+		if !tolerant {
+			if e == nil {
+				t.Error("a chunk that can't be decoded loaded without Tolerant")
+			}
+			continue
+		}
+		if e != nil {
+			t.Fatal(e)
+		}
+		if len(cs) != 2 {
+			t.Errorf("got %d chunks, want the 2 that decode", len(cs))
+		}
+		n := 0
+		for _, f := range Validate(&m) {
+			if f.Check == checkTileData && f.Layer == "ground" {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Errorf("got %d tile data findings on the ground layer, want 1", n)
+		}
+	}
+}
+
+func TestStreamedTileAtConcurrent(t *testing.T) {
+	m, e := LoadTileMap("testdata/infinite.json", StreamChunks(1))
+	if e != nil {
+		t.Fatal(e)
+	}
+	l := &m.Layers[0]
+	done := make(chan bool)
+	go func() {
+		// every call drops the chunk of the one before
+		for i := 0; i < 200; i++ {
+			if _, e := m.LoadRegion(l, CellRect{Cell{16 * (i % 2), 0}, Cell{16*(i%2) + 1, 1}}); e != nil {
+				t.Error(e)
+			}
+		}
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			l.TileAt(0, 0)
+			l.TileAt(16, 0)
+		}
+	}
+}
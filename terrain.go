@@ -0,0 +1,86 @@
+package tmx
+
+// terrainColors are the colors given to the wang colors made from terrains,
+// the same ones Tiled picks for new wang colors.
+var terrainColors = []string{
+	"#ff0000", "#00ff00", "#0000ff", "#ff7700", "#00e9ff", "#ff00d8",
+	"#ffff00", "#a000ff", "#00ff78", "#ff0069", "#006dff", "#b6ff00",
+}
+
+// terrainWangId returns the wang id of the legacy terrain corners of a tile,
+// which are listed top left, top right, bottom left, bottom right. Each corner
+// has the index of its terrain plus one, and zero where there is none.
+func terrainWangId(corners []int) (id WangId) {
+	for i, pos := range [4]int{WangTopLeft, WangTopRight, WangBottomLeft, WangBottomRight} {
+		if i < len(corners) && corners[i] >= 0 {
+			id[pos] = corners[i] + 1
+		}
+	}
+	return
+}
+
+// TerrainId returns the terrains at the corners of the tile as it is placed,
+// with its flips applied, in the corner positions of a wang id. Like the colors
+// of a wang id they count from one, so each is the index of the terrain plus
+// one, and zero is no terrain.
+func (t Tile) TerrainId() WangId {
+	if t.info == nil {
+		return WangId{}
+	}
+	return terrainWangId(t.info.Terrian).Transform(t.horizontialFlip, t.verticalFlip, t.diagonalFlip)
+}
+
+// TerrainAt returns the terrain at a corner of the tile as it is placed, one
+// of WangTopRight, WangBottomRight, WangBottomLeft or WangTopLeft, or nil if
+// the corner has no terrain.
+func (t Tile) TerrainAt(corner int) *terrian {
+	if t.set == nil || corner < 0 || corner >= len(WangId{}) {
+		return nil
+	}
+	i := t.TerrainId()[corner] - 1
+	if i < 0 || i >= len(t.set.TerrianTypes) {
+		return nil
+	}
+	return &t.set.TerrianTypes[i]
+}
+
+// TerrainWangset returns a corner wang set made from the terrains of the
+// tileset, the way Tiled 1.5 converts them. Each terrain becomes a color, in
+// the same order, and each tile with terrains becomes a wang tile with them at
+// its corners. It returns false if the tileset has no terrains.
+func (t *tileset) TerrainWangset() (wangset, bool) {
+	if len(t.TerrianTypes) == 0 {
+		return wangset{}, false
+	}
+	w := wangset{Name: "Terrains", Type: wangCorner, Tile: -1}
+	for i, tt := range t.TerrianTypes {
+		w.Colors = append(w.Colors, wangcolor{
+			Color:       terrainColors[i%len(terrainColors)],
+			Name:        tt.Name,
+			Probability: 1,
+			Tile:        tt.Tile,
+			Properties:  append([]property(nil), tt.Properties...),
+		})
+	}
+	for _, ti := range t.Tiles {
+		id := terrainWangId(ti.Terrian)
+		if id == (WangId{}) {
+			continue
+		}
+		w.WangTiles = append(w.WangTiles, wangtile{TileId: ti.Id, WangId: id[:]})
+	}
+	return w, true
+}
+
+// ConvertTerrains adds the wang set made from the terrains of the tileset to
+// its wang sets, so the terrains can be autotiled, and returns its index. It
+// returns -1 and leaves the tileset alone if it has no terrains. The terrains
+// themselves are kept.
+func (t *tileset) ConvertTerrains() int {
+	w, ok := t.TerrainWangset()
+	if !ok {
+		return -1
+	}
+	t.Wangsets = append(t.Wangsets, w)
+	return len(t.Wangsets) - 1
+}
@@ -0,0 +1,134 @@
+package tmx
+
+import "testing"
+
+// terrainMap returns a map with a tileset of two terrains. Tile 0 has grass at
+// the top left and bottom right, sand at the top right and nothing at the
+// bottom left, tile 1 has a terrain the tileset doesn't have and tile 2 has no
+// terrains at all.
+func terrainMap() *tilemap {
+	return &tilemap{Orientation: orthogonal, Tilewidth: 16, Tileheight: 16, Tilesets: []tileset{{
+		Firstgid: 1, Name: "terrain", Tilewidth: 16, Tileheight: 16, Tilecount: 4, Columns: 2,
+		TerrianTypes: []terrian{
+			{Name: "grass", Tile: 3, Properties: []property{{Name: "speed", Type: "int", Value: 1}}},
+			{Name: "sand", Tile: 2},
+		},
+		Tiles: []tile{
+			{Id: 0, Terrian: []int{0, 1, -1, 0}},
+			{Id: 1, Terrian: []int{5, 5, 5, 5}},
+			{Id: 2, Type: "plain"},
+		},
+	}}}
+}
+
+func TestTerrainAt(t *testing.T) {
+	m := terrainMap()
+	corners := [4]int{WangTopLeft, WangTopRight, WangBottomLeft, WangBottomRight}
+	// the terrains at the top left, top right, bottom left and bottom right
+	// of tile 0 as it is placed
+	wants := [8][4]string{
+		{"grass", "sand", "", "grass"}, // none
+		{"grass", "", "sand", "grass"}, // d swaps the top right and bottom left
+		{"", "grass", "grass", "sand"}, // v
+		{"sand", "grass", "grass", ""}, // vd
+		{"sand", "grass", "grass", ""}, // h
+		{"", "grass", "grass", "sand"}, // hd
+		{"grass", "", "sand", "grass"}, // hv, half a turn
+		{"grass", "sand", "", "grass"}, // hvd
+	}
+	for i, w := range wants {
+		h, v, d := flipBits(i)
+		tile, e := m.makeTile(1 | flagBits(h, v, d))
+		if e != nil {
+			t.Fatal(e)
+		}
+		id := tile.TerrainId()
+		for j, corner := range corners {
+			name := ""
+			if tt := tile.TerrainAt(corner); tt != nil {
+				name = tt.Name
+			}
+			if name != w[j] {
+				t.Errorf("%s: terrain at corner %d is %q, want %q", flipNames[i], corner, name, w[j])
+			}
+			if want := map[string]int{"": 0, "grass": 1, "sand": 2}[w[j]]; id[corner] != want {
+				t.Errorf("%s: terrain id %v has %d at corner %d, want %d", flipNames[i], id, id[corner], corner, want)
+			}
+		}
+		for _, edge := range [4]int{WangTop, WangRight, WangBottom, WangLeft} {
+			if id[edge] != 0 || tile.TerrainAt(edge) != nil {
+				t.Errorf("%s: terrain on edge %d", flipNames[i], edge)
+			}
+		}
+	}
+
+	cases := []struct {
+		name   string
+		gid    uint32
+		corner int
+	}{
+		{"unknown terrain", 2, WangTopLeft},
+		{"no terrains", 3, WangTopLeft},
+		{"no tile info", 4, WangTopLeft},
+		{"past the corners", 1, len(WangId{})},
+		{"negative corner", 1, -1},
+	}
+	for _, c := range cases {
+		tile, e := m.makeTile(c.gid)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if tt := tile.TerrainAt(c.corner); tt != nil {
+			t.Errorf("%s: terrain %q", c.name, tt.Name)
+		}
+	}
+	if nilTile.TerrainAt(WangTopLeft) != nil || nilTile.TerrainId() != (WangId{}) {
+		t.Errorf("the nil tile has terrains")
+	}
+}
+
+func TestTerrainWangset(t *testing.T) {
+	m := terrainMap()
+	ts := &m.Tilesets[0]
+	w, ok := ts.TerrainWangset()
+	if !ok {
+		t.Fatal("no wang set from the terrains")
+	}
+	if w.Type != wangCorner || len(w.Colors) != 2 {
+		t.Fatalf("wang set %+v", w)
+	}
+	for i, tt := range ts.TerrianTypes {
+		c := w.Colors[i]
+		if c.Name != tt.Name || c.Tile != tt.Tile || c.Probability != 1 || c.Color != terrainColors[i] {
+			t.Errorf("color %d is %+v for terrain %+v", i+1, c, tt)
+		}
+	}
+	// the properties are copied rather than shared
+	w.Colors[0].Properties[0].Name = "changed"
+	if ts.TerrianTypes[0].Properties[0].Name != "speed" {
+		t.Errorf("changing the wang color changed the terrain")
+	}
+	// tiles without terrains are left out, the unknown terrain is kept
+	if len(w.WangTiles) != 2 {
+		t.Fatalf("wang tiles %+v, want tiles 0 and 1", w.WangTiles)
+	}
+	if id, ok := w.TileWangId(0); !ok || id != (WangId{0, 2, 0, 1, 0, 0, 0, 1}) {
+		t.Errorf("tile 0 has the wang id %v", id)
+	}
+	// placed tiles give the same colors as their terrain ids
+	tile, _ := m.makeTile(1 | horizontalFlag | diagonalFlag)
+	if id, _ := w.TileWangId(0); id.Transform(true, false, true) != tile.TerrainId() {
+		t.Errorf("turned tile 0 has the terrain id %v and wang id %v", tile.TerrainId(), id.Transform(true, false, true))
+	}
+
+	if i := ts.ConvertTerrains(); i != 0 || len(ts.Wangsets) != 1 || ts.Wangsets[0].Name != "Terrains" {
+		t.Errorf("converted to wang set %d of %d", i, len(ts.Wangsets))
+	}
+	ts.TerrianTypes = nil
+	if _, ok := ts.TerrainWangset(); ok {
+		t.Errorf("wang set from a tileset without terrains")
+	}
+	if i := ts.ConvertTerrains(); i != -1 || len(ts.Wangsets) != 1 {
+		t.Errorf("converting no terrains gave %d and %d wang sets", i, len(ts.Wangsets))
+	}
+}
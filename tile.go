@@ -9,13 +9,15 @@ const (
 )
 
 type Tile struct {
-	gid             uint32 // the id of the tile in the tile layer
-	lid             uint32 // the id of the tile in the tileset
-	tileset         string // the tileset this tile is a part of
-	horizontialFlip bool   // is the tile flipped over the x-axis
-	verticalFlip    bool   // is the tile flipped over the y-axis
-	diagonalFlip    bool   // is the tile flipped diagonally
-	nil             bool   // if the global id is zero
+	gid             uint32   // the id of the tile in the tile layer
+	lid             uint32   // the id of the tile in the tileset
+	tileset         string   // the tileset this tile is a part of
+	horizontialFlip bool     // is the tile flipped over the x-axis
+	verticalFlip    bool     // is the tile flipped over the y-axis
+	diagonalFlip    bool     // is the tile flipped diagonally
+	nil             bool     // if the global id is zero
+	set             *tileset // the tileset this tile is a part of
+	info            *tile    // metadata of the tile, nil if there is none
 }
 
 var nilTile = &Tile{nil: true}
@@ -48,6 +50,63 @@ func (t Tile) Nil() bool {
 	return t.nil
 }
 
+// TilesetInfo returns the tileset the tile is a part of.
+func (t Tile) TilesetInfo() *tileset {
+	return t.set
+}
+
+// Info returns the metadata of the tile from its tileset, or nil if the tileset
+// doesn't have any for this tile.
+func (t Tile) Info() *tile {
+	return t.info
+}
+
+// Properties returns the custom properties of the tile.
+func (t Tile) Properties() []property {
+	if t.info == nil {
+		return nil
+	}
+	return t.info.Properties
+}
+
+// Class returns the class of the tile, called type before Tiled 1.9.
+func (t Tile) Class() string {
+	if t.info == nil {
+		return empty
+	}
+	if t.info.Class != empty {
+		return t.info.Class
+	}
+	return t.info.Type
+}
+
+// Animation returns the frames of the tile animation, nil if the tile isn't
+// animated.
+func (t Tile) Animation() []frame {
+	if t.info == nil {
+		return nil
+	}
+	return t.info.Animation
+}
+
+// CollisionShapes returns the objects of the tile collision editor. They are
+// relative to the top left corner of the tile.
+func (t Tile) CollisionShapes() []object {
+	if t.info == nil {
+		return nil
+	}
+	return t.info.ObjectGroup.Objects
+}
+
+// Terrain returns the index of the terrain at each corner of the tile (top
+// left, top right, bottom left, bottom right), nil if there is none.
+func (t Tile) Terrain() []int {
+	if t.info == nil {
+		return nil
+	}
+	return t.info.Terrian
+}
+
 // clearHighBits flips bits 31,30,29 to zero and returns a gid.
 func clearHighBits(n uint32) uint32 {
 	return n &^ (horizontalFlag | verticalFlag | diagonalFlag)
@@ -64,3 +123,15 @@ func flipFlags(n uint32) (h, v, d bool) {
 func localId(g uint32, f int) uint32 {
 	return g - uint32(f)
 }
+
+// size returns the size of the tile image in pixels, which for image
+// collections can differ from tile to tile.
+func (t Tile) size() (w, h float64) {
+	if t.info != nil && t.info.Image != empty {
+		return float64(t.info.ImageWidth), float64(t.info.ImageHeight)
+	}
+	if t.set == nil {
+		return 0, 0
+	}
+	return float64(t.set.Tilewidth), float64(t.set.Tileheight)
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/binary"
 	"io"
 	"io/ioutil"
+	"path"
 	"reflect"
 )
 
@@ -20,42 +21,60 @@ const (
 )
 
 type tileset struct {
-	Name             string     `json:"name"`             // name of tileset
-	Type             string     `json:"type"`             // "tileset"
-	Source           string     `json:"source"`           // path to tileset file
-	Image            string     `json:"image"`            // path to image file
-	TransparentColor string     `json:"transparentcolor"` // hex color (#rrggbb)
-	Firstgid         int        `json:"firstgid"`         // first tile in a set
-	Tilewidth        int        `json:"tilewidth"`        // width of tiles
-	Tileheight       int        `json:"tileheight"`       // height of tiles
-	Spacing          int        `json:"spacing"`          // space between tiles
-	Margin           int        `json:"margin"`           // space around edge
-	Tilecount        int        `json:"tilecount"`        // number of tiles
-	Columns          int        `json:"columns"`          // number of columns
-	Imagewidth       int        `json:"imagewidth"`       // width of image
-	Imageheight      int        `json:"imageheight"`      // height of image
-	Grid             grid       `json:"grid"`             // see <grid>
-	TileOffsets      offset     `json:"tileoffset"`       // see <tileoffset>
-	TerrianTypes     []terrian  `json:"terrains"`         // array of terrains
-	Tiles            []tile     `json:"tiles"`            // array of tiles
-	Wangsets         []wangset  `json:"wangsets"`         // array of wang sets
-	Properties       []property `json:"properties"`       // a list of properties
+	Name             string          `json:"name"`             // name of tileset
+	Type             string          `json:"type"`             // "tileset"
+	Source           string          `json:"source"`           // path to tileset file
+	Image            string          `json:"image"`            // path to image file
+	TransparentColor string          `json:"transparentcolor"` // hex color (#rrggbb)
+	Firstgid         int             `json:"firstgid"`         // first tile in a set
+	Tilewidth        int             `json:"tilewidth"`        // width of tiles
+	Tileheight       int             `json:"tileheight"`       // height of tiles
+	Spacing          int             `json:"spacing"`          // space between tiles
+	Margin           int             `json:"margin"`           // space around edge
+	Tilecount        int             `json:"tilecount"`        // number of tiles
+	Columns          int             `json:"columns"`          // number of columns
+	Imagewidth       int             `json:"imagewidth"`       // width of image
+	Imageheight      int             `json:"imageheight"`      // height of image
+	Grid             grid            `json:"grid"`             // see <grid>
+	TileOffsets      offset          `json:"tileoffset"`       // see <tileoffset>
+	ObjectAlignment  string          `json:"objectalignment"`  // tile object anchor
+	TerrianTypes     []terrian       `json:"terrains"`         // array of terrains
+	Tiles            []tile          `json:"tiles"`            // array of tiles
+	Wangsets         []wangset       `json:"wangsets"`         // array of wang sets
+	Transformations  transformations `json:"transformations"`  // allowed tile flips
+	Properties       []property      `json:"properties"`       // a list of properties
 }
 
 type external struct {
-	Name         string  `json:"name"`         // same as tileset
-	Image        string  `json:"image"`        // same as tileset
-	Type         string  `json:"type"`         // same as tileset
-	Tilewidth    int     `json:"tilewidth"`    // same as tileset
-	Tileheight   int     `json:"tileheight"`   // same as tileset
-	Spacing      int     `json:"spacing"`      // same as tileset
-	Margin       int     `json:"margin"`       // same as tileset
-	Tilecount    int     `json:"tilecount"`    // same as tileset
-	Imagewidth   int     `json:"imagewidth"`   // same as tileset
-	Imageheight  int     `json:"imageheight"`  // same as tileset
-	Columns      int     `json:"columns"`      // same as tileset
-	Tiledversion string  `json:"tiledversion"` // external only
-	Version      float64 `json:"version"`      // external only
+	Name             string          `json:"name"`             // same as tileset
+	Image            string          `json:"image"`            // same as tileset
+	Type             string          `json:"type"`             // same as tileset
+	TransparentColor string          `json:"transparentcolor"` // same as tileset
+	Tilewidth        int             `json:"tilewidth"`        // same as tileset
+	Tileheight       int             `json:"tileheight"`       // same as tileset
+	Spacing          int             `json:"spacing"`          // same as tileset
+	Margin           int             `json:"margin"`           // same as tileset
+	Tilecount        int             `json:"tilecount"`        // same as tileset
+	Imagewidth       int             `json:"imagewidth"`       // same as tileset
+	Imageheight      int             `json:"imageheight"`      // same as tileset
+	Columns          int             `json:"columns"`          // same as tileset
+	Grid             grid            `json:"grid"`             // same as tileset
+	TerrianTypes     []terrian       `json:"terrains"`         // same as tileset
+	Tiles            []tile          `json:"tiles"`            // same as tileset
+	Wangsets         []wangset       `json:"wangsets"`         // same as tileset
+	Transformations  transformations `json:"transformations"`  // same as tileset
+	Properties       []property      `json:"properties"`       // same as tileset
+	TileOffsets      offset          `json:"tileoffset"`       // same as tileset
+	ObjectAlignment  string          `json:"objectalignment"`  // same as tileset
+	Tiledversion     string          `json:"tiledversion"`     // external only
+	Version          float64         `json:"version"`          // external only
+}
+
+// ImageRect is the region of an image file that a tile is drawn from.
+type ImageRect struct {
+	Source        string // path to the image file
+	X, Y          int    // top left corner of the region in pixels
+	Width, Height int    // size of the region in pixels
 }
 
 type grid struct {
@@ -77,6 +96,7 @@ type offset struct {
 
 type tile struct {
 	Type        string     `json:"type"`        // type of the tile
+	Class       string     `json:"class"`       // replaces type in tiled 1.9
 	Image       string     `json:"image"`       // image representing this tile
 	ImageWidth  int        `json:"imagewidth"`  // width of the tile image
 	ImageHeight int        `json:"imageheight"` // height of the tile image
@@ -161,8 +181,10 @@ func compressBytes(b []byte) uint32 {
 }
 
 // processTilesets determines if a tileset needs to be imported from an
-// external tileset file.
-func processTilesets(s *[]tileset) (e error) {
+// external tileset file. When one can't be loaded the error is handed to
+// tolerate along with the index of the tileset, and the tileset is left
+// without any tiles if it lets the error through.
+func processTilesets(s *[]tileset, tolerate func(i int, e error) error) (e error) {
 	for i := 0; i < len(*s); i++ {
 		ts := &(*s)[i]
 		// determine if this is a external tileset
@@ -170,16 +192,110 @@ func processTilesets(s *[]tileset) (e error) {
 			// load in the external tileset from file
 			var ex external
 			if ex, e = loadTileset(ts.Source); e != nil {
-				return
+				if e = tolerate(i, fileError("tileset", ts.Source, e)); e != nil {
+					return
+				}
+				continue
 			}
 			// get the reflect value of the external tileset and the corresponding
 			// tileset
 			src, dst := reflect.ValueOf(ex), reflect.ValueOf(ts).Elem()
 			// copy the fields of the src into the dst
-			if e = copyFields(&src, &dst); e != nil {
+			if e = copyFields(&src, &dst, nil); e != nil {
 				return
 			}
+			// copy fields doesn't handle slices or structures, bring them over by
+			// hand
+			if len(ex.Tiles) > 0 {
+				ts.Tiles = ex.Tiles
+			}
+			ts.TileOffsets, ts.Grid = ex.TileOffsets, ex.Grid
+			ts.TerrianTypes, ts.Wangsets = ex.TerrianTypes, ex.Wangsets
+			ts.Transformations, ts.Properties = ex.Transformations, ex.Properties
+		}
+		// wang sets from before tiled 1.5 are brought up to date
+		for j := 0; j < len(ts.Wangsets); j++ {
+			ts.Wangsets[j].normalize()
 		}
 	}
 	return
 }
+
+// IsCollection returns whether the tileset is an image collection, where each
+// tile has an image of its own rather than being a cell in the tileset image.
+func (t tileset) IsCollection() bool {
+	if t.Image != empty {
+		return false
+	}
+	for i := 0; i < len(t.Tiles); i++ {
+		if t.Tiles[i].Image != empty {
+			return true
+		}
+	}
+	return false
+}
+
+// cell returns the region of the tileset image a tile is drawn from.
+func (t tileset) cell(lid uint32) ImageRect {
+	r := ImageRect{
+		Source: t.imagePath(t.Image),
+		Width:  t.Tilewidth,
+		Height: t.Tileheight,
+	}
+	if t.Columns > 0 {
+		col, row := int(lid)%t.Columns, int(lid)/t.Columns
+		r.X = t.Margin + col*(t.Tilewidth+t.Spacing)
+		r.Y = t.Margin + row*(t.Tileheight+t.Spacing)
+	}
+	return r
+}
+
+// imagePath resolves the path of an image in the tileset so that it is
+// relative to the map file instead of the tileset file.
+func (t tileset) imagePath(img string) string {
+	if img == empty || t.Source == empty || path.IsAbs(img) {
+		return img
+	}
+	return path.Join(path.Dir(t.Source), img)
+}
+
+// anchor returns the point of a tile object image that sits at the position
+// of the object, as a fraction of the image size. When unspecified it is the
+// bottom left corner, or the bottom center on isometric maps.
+func (t tileset) anchor(orientation string) Vec {
+	switch t.ObjectAlignment {
+	case "topleft":
+		return Vec{0, 0}
+	case "top":
+		return Vec{0.5, 0}
+	case "topright":
+		return Vec{1, 0}
+	case "left":
+		return Vec{0, 0.5}
+	case "center":
+		return Vec{0.5, 0.5}
+	case "right":
+		return Vec{1, 0.5}
+	case "bottomleft":
+		return Vec{0, 1}
+	case "bottom":
+		return Vec{0.5, 1}
+	case "bottomright":
+		return Vec{1, 1}
+	}
+	if orientation == isometric {
+		return Vec{0.5, 1}
+	}
+	return Vec{0, 1}
+}
+
+// tileSize returns the size of the image of a tile, which for image
+// collections can differ from tile to tile.
+func (t tileset) tileSize(lid int) (w, h float64) {
+	for i := 0; i < len(t.Tiles); i++ {
+		if t.Tiles[i].Id == lid && t.Tiles[i].Image != empty {
+			return float64(t.Tiles[i].ImageWidth), float64(t.Tiles[i].ImageHeight)
+		}
+	}
+	return float64(t.Tilewidth), float64(t.Tileheight)
+}
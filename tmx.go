@@ -44,8 +44,9 @@ var (
 )
 
 // copyFields copies the fields of one structure over to another. It does not
-// copy slices or structure however.
-func copyFields(src, dst *reflect.Value) (e error) {
+// copy slices or structure however. When only is given, just the fields it
+// names are copied, otherwise all of them are.
+func copyFields(src, dst *reflect.Value, only map[string]bool) (e error) {
 	// verify that both are of type struct
 	if e = checkStruct(*src, *dst); e != nil {
 		return
@@ -53,6 +54,9 @@ func copyFields(src, dst *reflect.Value) (e error) {
 	for i := 0; i < src.NumField(); i++ {
 		// get the src field name and value
 		n, v := src.Type().Field(i).Name, src.Field(i)
+		if only != nil && !only[n] {
+			continue
+		}
 		// get the dst field
 		f := dst.FieldByName(n)
 		// if the field exists and it can be assigned a value
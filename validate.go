@@ -0,0 +1,385 @@
+package tmx
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Severity is how serious a finding is.
+type Severity int
+
+const (
+	// SeverityWarning is a finding that likely isn't intended but won't break
+	// anything.
+	SeverityWarning Severity = iota
+	// SeverityError is a finding that will break the map.
+	SeverityError
+)
+
+// String returns the name of the severity.
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// MarshalText encodes the severity by name.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Finding is a single problem found while validating a map.
+type Finding struct {
+	Severity Severity `json:"severity"`
+	Check    string   `json:"check"`             // name of the check
+	Message  string   `json:"message"`           // what is wrong
+	Tileset  string   `json:"tileset,omitempty"` // name of the tileset
+	Layer    string   `json:"layer,omitempty"`   // path of the layer, groups separated by /
+	Object   int      `json:"object,omitempty"`  // id of the object
+}
+
+// String formats the finding as layer:object: severity: message.
+func (f Finding) String() string {
+	var loc []string
+	if f.Tileset != empty {
+		loc = append(loc, "tileset "+f.Tileset)
+	}
+	if f.Layer != empty {
+		loc = append(loc, f.Layer)
+	}
+	if f.Object != 0 {
+		loc = append(loc, fmt.Sprintf("object %d", f.Object))
+	}
+	s := fmt.Sprintf("%s: %s (%s)", f.Severity, f.Message, f.Check)
+	if len(loc) > 0 {
+		s = strings.Join(loc, ":") + ": " + s
+	}
+	return s
+}
+
+const (
+	// names of the checks
+	checkGidOverlap    = "gid-overlap"
+	checkTilecount     = "tilecount"
+	checkMissingImage  = "missing-image"
+	checkUnusedTileset = "unused-tileset"
+	checkDuplicateId   = "duplicate-id"
+	checkIdRange       = "id-range"
+	checkTemplate      = "missing-template"
+	checkPropertyType  = "property-type"
+	checkBadGlobalId   = "bad-gid"
+	checkTileset       = "missing-tileset"
+	checkTileData      = "tile-data"
+)
+
+// validator collects findings while walking a map.
+type validator struct {
+	m        *tilemap
+	findings []Finding
+	layerIds map[int]string // layer id to the first layer path using it
+	objIds   map[int]string // object id to the first layer path using it
+	used     map[*tileset]bool
+}
+
+// Validate checks a map for problems and returns every one it finds, rather
+// than stopping at the first. The map should have been loaded with
+// LoadTileMap so that files can be found relative to it, and with Tolerant so
+// that the problems that would stop a load are reported as well.
+func Validate(m *tilemap) []Finding {
+	v := &validator{
+		m:        m,
+		layerIds: make(map[int]string),
+		objIds:   make(map[int]string),
+		used:     make(map[*tileset]bool),
+	}
+	v.tilesets()
+	v.properties(m.Properties, Finding{})
+	v.layers(m.Layers, empty)
+	for i := 0; i < len(m.Tilesets); i++ {
+		t := &m.Tilesets[i]
+		if !v.used[t] && !v.broken(t) {
+			v.add(Finding{Severity: SeverityWarning, Check: checkUnusedTileset, Tileset: t.Name,
+				Message: "no tile from the tileset is used"})
+		}
+	}
+	return v.findings
+}
+
+// add records a finding.
+func (v *validator) add(f Finding) {
+	v.findings = append(v.findings, f)
+}
+
+// loadProblems reports the problems recorded by a Tolerant load at a place in
+// the map, picked out by its tileset, or its layer and object.
+func (v *validator) loadProblems(t *tileset, l *layer, object int, at Finding) {
+	if v.m.problems == nil {
+		return
+	}
+	for _, p := range v.m.problems.list {
+		if p.tileset == t && p.layer == l && p.object == object {
+			v.add(v.at(at, SeverityError, p.check, p.e.Error()))
+		}
+	}
+}
+
+// broken returns whether a tileset couldn't be loaded.
+func (v *validator) broken(t *tileset) bool {
+	if v.m.problems == nil {
+		return false
+	}
+	for _, p := range v.m.problems.list {
+		if p.tileset == t {
+			return true
+		}
+	}
+	return false
+}
+
+// exists returns whether a file relative to the map exists.
+func (v *validator) exists(fp string) bool {
+	dir := v.m.dir
+	if dir == empty {
+		dir = mapDirectory
+	}
+	if !filepath.IsAbs(fp) {
+		fp = filepath.Join(dir, filepath.FromSlash(fp))
+	}
+	_, e := os.Stat(fp)
+	return e == nil
+}
+
+// tilesets checks the gid ranges, tile counts, images and tile properties of
+// the tilesets.
+func (v *validator) tilesets() {
+	ts := v.m.Tilesets
+	// overlapping ranges, compared in order of first gid
+	order := make([]int, len(ts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return ts[order[a]].Firstgid < ts[order[b]].Firstgid
+	})
+	for i := 1; i < len(order); i++ {
+		a, b := &ts[order[i-1]], &ts[order[i]]
+		if last := a.Firstgid + a.gidCount() - 1; b.Firstgid <= last {
+			v.add(Finding{Severity: SeverityError, Check: checkGidOverlap, Tileset: b.Name,
+				Message: fmt.Sprintf("first gid %d is inside the range of tileset %q (%d-%d)",
+					b.Firstgid, a.Name, a.Firstgid, last)})
+		}
+	}
+	for i := 0; i < len(ts); i++ {
+		t := &ts[i]
+		name := t.Name
+		if name == empty {
+			// tilesets that couldn't be loaded only have their file
+			name = t.Source
+		}
+		v.loadProblems(t, nil, 0, Finding{Tileset: name})
+		if !t.IsCollection() && t.Image != empty {
+			if n, ok := t.expectedTilecount(); ok && n != t.Tilecount {
+				v.add(Finding{Severity: SeverityError, Check: checkTilecount, Tileset: t.Name,
+					Message: fmt.Sprintf("tilecount is %d but the image holds %d tiles", t.Tilecount, n)})
+			}
+			if t.Columns > 0 && t.Tilewidth+t.Spacing > 0 {
+				if cols := (t.Imagewidth - 2*t.Margin + t.Spacing) / (t.Tilewidth + t.Spacing); cols != t.Columns {
+					v.add(Finding{Severity: SeverityError, Check: checkTilecount, Tileset: t.Name,
+						Message: fmt.Sprintf("columns is %d but the image is %d tiles wide", t.Columns, cols)})
+				}
+			}
+			if !v.exists(t.imagePath(t.Image)) {
+				v.add(Finding{Severity: SeverityError, Check: checkMissingImage, Tileset: t.Name,
+					Message: fmt.Sprintf("image %q does not exist", t.Image)})
+			}
+		}
+		v.properties(t.Properties, Finding{Tileset: t.Name})
+		for j := 0; j < len(t.Tiles); j++ {
+			tl := &t.Tiles[j]
+			if tl.Image != empty && !v.exists(t.imagePath(tl.Image)) {
+				v.add(Finding{Severity: SeverityError, Check: checkMissingImage, Tileset: t.Name,
+					Message: fmt.Sprintf("image %q of tile %d does not exist", tl.Image, tl.Id)})
+			}
+			v.properties(tl.Properties, Finding{Tileset: t.Name})
+		}
+	}
+}
+
+// gidCount returns how many gids the tileset takes up.
+func (t tileset) gidCount() int {
+	if !t.IsCollection() {
+		return t.Tilecount
+	}
+	n := 0
+	for i := 0; i < len(t.Tiles); i++ {
+		if t.Tiles[i].Id >= n {
+			n = t.Tiles[i].Id + 1
+		}
+	}
+	return n
+}
+
+// expectedTilecount works out the number of tiles that fit in the tileset
+// image.
+func (t tileset) expectedTilecount() (int, bool) {
+	if t.Tilewidth <= 0 || t.Tileheight <= 0 || t.Imagewidth <= 0 || t.Imageheight <= 0 {
+		return 0, false
+	}
+	cols := (t.Imagewidth - 2*t.Margin + t.Spacing) / (t.Tilewidth + t.Spacing)
+	rows := (t.Imageheight - 2*t.Margin + t.Spacing) / (t.Tileheight + t.Spacing)
+	return cols * rows, true
+}
+
+// layers checks a set of layers and everything in them.
+func (v *validator) layers(ls []layer, parent string) {
+	for i := 0; i < len(ls); i++ {
+		l := &ls[i]
+		p := l.Name
+		if parent != empty {
+			p = parent + "/" + l.Name
+		}
+		at := Finding{Layer: p}
+		if first, dup := v.layerIds[l.Id]; dup && l.Id != 0 {
+			v.add(v.at(at, SeverityError, checkDuplicateId,
+				fmt.Sprintf("layer id %d is also used by %q", l.Id, first)))
+		} else {
+			v.layerIds[l.Id] = p
+		}
+		if v.m.NextLayerId > 0 && l.Id >= v.m.NextLayerId {
+			v.add(v.at(at, SeverityError, checkIdRange,
+				fmt.Sprintf("layer id %d is not below nextlayerid %d", l.Id, v.m.NextLayerId)))
+		}
+		v.properties(l.Properties, at)
+		switch l.Type {
+		case groupLayer:
+			v.layers(l.Layers, p)
+		case tileLayer:
+			bad, first, gid := 0, Cell{}, uint32(0)
+			if e := v.m.eachTile(l, func(col, row int, t *Tile) {
+				switch {
+				case t.set != nil:
+					v.used[t.set] = true
+				case !t.Nil():
+					// a gid that a Tolerant load couldn't resolve
+					if bad == 0 {
+						first, gid = Cell{col, row}, t.gid
+					}
+					bad++
+				}
+			}); e != nil {
+				check := checkTileData
+				if e == badGlobalId {
+					check = checkBadGlobalId
+				}
+				v.add(v.at(at, SeverityError, check, e.Error()))
+			}
+			switch {
+			case bad == 1:
+				v.add(v.at(at, SeverityError, checkBadGlobalId,
+					fmt.Sprintf("gid %d at %d,%d is not in any tileset", gid, first.Col, first.Row)))
+			case bad > 1:
+				v.add(v.at(at, SeverityError, checkBadGlobalId,
+					fmt.Sprintf("%d gids are not in any tileset, the first is %d at %d,%d",
+						bad, gid, first.Col, first.Row)))
+			}
+		case objectLayer:
+			for j := 0; j < len(l.Objects); j++ {
+				v.object(l, &l.Objects[j], p)
+			}
+		default:
+			if l.Image != empty && !v.exists(l.Image) {
+				v.add(v.at(at, SeverityError, checkMissingImage,
+					fmt.Sprintf("image %q does not exist", l.Image)))
+			}
+		}
+		v.loadProblems(nil, l, 0, at)
+	}
+}
+
+// object checks a single object of a layer.
+func (v *validator) object(l *layer, o *object, layer string) {
+	at := Finding{Layer: layer, Object: o.Id}
+	v.loadProblems(nil, l, o.Id, at)
+	if first, dup := v.objIds[o.Id]; dup && o.Id != 0 {
+		v.add(v.at(at, SeverityError, checkDuplicateId,
+			fmt.Sprintf("object id %d is also used in %q", o.Id, first)))
+	} else {
+		v.objIds[o.Id] = layer
+	}
+	if v.m.Nextobjectid > 0 && o.Id >= v.m.Nextobjectid {
+		v.add(v.at(at, SeverityError, checkIdRange,
+			fmt.Sprintf("object id %d is not below nextobjectid %d", o.Id, v.m.Nextobjectid)))
+	}
+	if o.Gid != 0 {
+		if t, e := v.m.verifyGid(uint32(o.Gid)); e != nil {
+			v.add(v.at(at, SeverityError, checkBadGlobalId, fmt.Sprintf("gid %d is not in any tileset", o.Gid)))
+		} else {
+			v.used[t] = true
+		}
+	}
+	v.properties(o.Properties, at)
+}
+
+// at fills in the details of a finding at a location.
+func (v *validator) at(f Finding, s Severity, check, msg string) Finding {
+	f.Severity, f.Check, f.Message = s, check, msg
+	return f
+}
+
+// properties checks that the value of every property matches its type.
+func (v *validator) properties(ps []property, at Finding) {
+	for _, p := range ps {
+		if !propertyTypeMatches(p) {
+			v.add(v.at(at, SeverityError, checkPropertyType,
+				fmt.Sprintf("property %q is declared %s but holds %v", p.Name, p.Type, p.Value)))
+		}
+	}
+}
+
+// propertyTypeMatches returns whether the value of a property fits its
+// declared type.
+func propertyTypeMatches(p property) bool {
+	switch p.Type {
+	case "string", "file", empty:
+		_, ok := p.Value.(string)
+		return ok || p.Type == empty
+	case "int", "object":
+		f, ok := p.Value.(float64)
+		return ok && f == math.Trunc(f)
+	case "float":
+		_, ok := p.Value.(float64)
+		return ok
+	case "bool":
+		_, ok := p.Value.(bool)
+		return ok
+	case "color":
+		s, ok := p.Value.(string)
+		return ok && validColor(s)
+	case "class":
+		_, ok := p.Value.(map[string]interface{})
+		return ok
+	}
+	// custom types that are unknown here
+	return true
+}
+
+// validColor returns whether a string is empty or a #rrggbb or #aarrggbb color.
+func validColor(s string) bool {
+	if s == empty {
+		return true
+	}
+	if !strings.HasPrefix(s, "#") || (len(s) != 7 && len(s) != 9) {
+		return false
+	}
+	for _, r := range s[1:] {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package tmx
+
+import "testing"
+
+func TestValidateTolerantLoad(t *testing.T) {
+	const fp = "testdata/broken.json"
+	if _, e := LoadTileMap(fp); e == nil {
+		t.Fatalf("%s loaded without Tolerant", fp)
+	}
+	m, e := LoadTileMap(fp, Tolerant())
+	if e != nil {
+		t.Fatalf("%s: %v", fp, e)
+	}
+	type where struct {
+		check   string
+		tileset string
+		layer   string
+		object  int
+	}
+	want := []where{
+		{check: checkTileset, tileset: "missing.tsx"},
+		{check: checkBadGlobalId, layer: "ground"},
+		{check: checkTemplate, layer: "things/objects", object: 2},
+		{check: checkBadGlobalId, layer: "things/objects", object: 3},
+	}
+	fs := Validate(&m)
+	if len(fs) != len(want) {
+		t.Fatalf("got %d findings, want %d: %v", len(fs), len(want), fs)
+	}
+	for i, f := range fs {
+		if got := (where{f.Check, f.Tileset, f.Layer, f.Object}); got != want[i] {
+			t.Errorf("finding %d = %+v (%s), want %+v", i, got, f.Message, want[i])
+		}
+		if f.Severity != SeverityError {
+			t.Errorf("finding %d is a %s, want an error", i, f.Severity)
+		}
+	}
+
+	// the object whose template loaded is still resolved
+	o := m.Layers[1].Layers[0].Objects[0]
+	if o.Name != "crate" || o.Width != 16 {
+		t.Errorf("object 1 = %q %gx%g, want the crate template", o.Name, o.Width, o.Height)
+	}
+}
+
+func TestValidateTolerantLoadLazy(t *testing.T) {
+	// problems found while decoding a layer later on are reported the same
+	for _, opt := range []Option{LazyDecoding(), ParallelDecoding(4)} {
+		m, e := LoadTileMap("testdata/broken.json", Tolerant(), opt)
+		if e != nil {
+			t.Fatal(e)
+		}
+		n := 0
+		for _, f := range Validate(&m) {
+			if f.Check == checkBadGlobalId && f.Layer == "ground" {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Errorf("got %d bad gid findings on the ground layer, want 1", n)
+		}
+	}
+}
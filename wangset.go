@@ -1,24 +1,251 @@
 package tmx
 
+const (
+  // wang set types
+  wangCorner = "corner"
+  wangEdge   = "edge"
+  wangMixed  = "mixed"
+)
+
+// Positions of the edges and corners of a cell in a wang id, clockwise from
+// the top.
+const (
+  WangTop = iota
+  WangTopRight
+  WangRight
+  WangBottomRight
+  WangBottom
+  WangBottomLeft
+  WangLeft
+  WangTopLeft
+)
+
+// WangId is the colors of the edges and corners of a tile, indexed by the
+// positions above. Colors count from one, zero is no color.
+type WangId [8]int
+
 type wangset struct {
   Name         string         `json:"name"`         // name of the wang set
+  Type         string         `json:"type"`         // corner, edge or mixed
   Tile         int            `json:"tile"`         // local id of tile
-  CornerColors []wangcolor    `json:"cornercolors"` // array of wang colors
-  EdgeColors   []wangcolor    `json:"edgecolors"`   // array of wang colors
+  Colors       []wangcolor    `json:"colors"`       // array of wang colors
+  CornerColors []wangcolor    `json:"cornercolors"` // before tiled 1.5 only
+  EdgeColors   []wangcolor    `json:"edgecolors"`   // before tiled 1.5 only
   WangTiles    []wangtile     `json:"wangtiles"`    // array of wang tiles
+  Properties   []property     `json:"properties"`   // a list of properties
 }
 
 type wangcolor struct {
-  Color       string  `json:"color"`       // hex color (#rrggbb or #aarrggbb)
-  Name        string  `json:"name"`        // name of the wang color
-  Probability float64 `json:"probability"` // probability used when randomizing
-  Tile        int     `json:"tile"`        // local tile id of the wang color
+  Color       string     `json:"color"`       // hex color (#rrggbb or #aarrggbb)
+  Name        string     `json:"name"`        // name of the wang color
+  Probability float64    `json:"probability"` // probability used when randomizing
+  Tile        int        `json:"tile"`        // local tile id of the wang color
+  Properties  []property `json:"properties"`  // a list of properties
 }
 
 type wangtile struct {
   TileId int   `json:"tileid"` // local id of tile
-  DFlip  bool  `json:"dflip"`  // tile is flipped diagonally
-  HFlip  bool  `json:"hflip"`  // tile is flipped horizontally
-  VFlip  bool  `json:"vflip"`  // tile is flipped vertically
+  DFlip  bool  `json:"dflip"`  // tile is flipped diagonally, before tiled 1.5
+  HFlip  bool  `json:"hflip"`  // tile is flipped horizontally, before tiled 1.5
+  VFlip  bool  `json:"vflip"`  // tile is flipped vertically, before tiled 1.5
   WangId []int `json:"wangid"` // array of wang color indexes
 }
+
+type transformations struct {
+  HFlip               bool `json:"hflip"`               // tiles may be flipped horizontally
+  VFlip               bool `json:"vflip"`               // tiles may be flipped vertically
+  Rotate              bool `json:"rotate"`              // tiles may be rotated
+  PreferUntransformed bool `json:"preferuntransformed"` // use transformed tiles as a last resort
+}
+
+// normalize brings a wang set into the format of Tiled 1.5. Sets from before
+// 1.5 keep their edge and corner colors apart, those are merged into a single
+// list of colors with the edge colors first, and the corner colors in the wang
+// ids are moved past them. Wang ids are padded out to eight colors, and the
+// type is worked out from the colors the tiles use when it is missing.
+func (w *wangset) normalize() {
+  if len(w.Colors) == 0 && (len(w.CornerColors) > 0 || len(w.EdgeColors) > 0) {
+    switch {
+    case len(w.EdgeColors) == 0:
+      w.Type = wangCorner
+    case len(w.CornerColors) == 0:
+      w.Type = wangEdge
+    default:
+      w.Type = wangMixed
+    }
+    w.Colors = append(append([]wangcolor(nil), w.EdgeColors...), w.CornerColors...)
+    for i := 0; i < len(w.WangTiles); i++ {
+      id := w.WangTiles[i].WangId
+      for j := 1; j < len(id); j += 2 {
+        if id[j] != 0 {
+          id[j] += len(w.EdgeColors)
+        }
+      }
+    }
+    w.CornerColors, w.EdgeColors = nil, nil
+  }
+
+  corners, edges := false, false
+  for i := 0; i < len(w.WangTiles); i++ {
+    t := &w.WangTiles[i]
+    if len(t.WangId) < len(WangId{}) {
+      t.WangId = append(t.WangId, make([]int, len(WangId{})-len(t.WangId))...)
+    }
+    for j, c := range t.WangId {
+      if c != 0 {
+        corners = corners || j%2 == 1
+        edges   = edges || j%2 == 0
+      }
+    }
+  }
+  if w.Type == empty {
+    switch {
+    case corners && edges:
+      w.Type = wangMixed
+    case edges:
+      w.Type = wangEdge
+    default:
+      w.Type = wangCorner
+    }
+  }
+}
+
+// uses returns whether the tiles of a wang set have colors at a position.
+// Corner sets leave the edges out and edge sets the corners.
+func (w wangset) uses(pos int) bool {
+  switch w.Type {
+  case wangCorner:
+    return pos%2 == 1
+  case wangEdge:
+    return pos%2 == 0
+  }
+  return true
+}
+
+// Color returns a color of the wang set by its index, counting from one, or
+// nil if there isn't one.
+func (w *wangset) Color(i int) *wangcolor {
+  if i < 1 || i > len(w.Colors) {
+    return nil
+  }
+  return &w.Colors[i-1]
+}
+
+// probability returns the probability of a color, or one for colors the wang
+// set doesn't have.
+func (w wangset) probability(color int) float64 {
+  if c := w.Color(color); c != nil {
+    return c.Probability
+  }
+  return 1
+}
+
+// TileWangId returns the wang id of a tile of the wang set by its local id, as
+// the tile is in the tileset. Tiles from before Tiled 1.5 that are only listed
+// flipped have their flips undone.
+func (w *wangset) TileWangId(lid int) (WangId, bool) {
+  var found *wangtile
+  for i := 0; i < len(w.WangTiles); i++ {
+    t := &w.WangTiles[i]
+    if t.TileId != lid {
+      continue
+    }
+    if !t.HFlip && !t.VFlip && !t.DFlip {
+      found = t
+      break
+    }
+    if found == nil {
+      found = t
+    }
+  }
+  if found == nil {
+    return WangId{}, false
+  }
+  var id WangId
+  copy(id[:], found.WangId)
+  return id.untransform(found.HFlip, found.VFlip, found.DFlip), true
+}
+
+// CornerColor returns the color at a corner of a tile of the wang set, one of
+// WangTopRight, WangBottomRight, WangBottomLeft or WangTopLeft, or nil if the
+// corner has no color.
+func (w *wangset) CornerColor(lid, corner int) *wangcolor {
+  return w.colorAt(lid, corner)
+}
+
+// EdgeColor returns the color at an edge of a tile of the wang set, one of
+// WangTop, WangRight, WangBottom or WangLeft, or nil if the edge has no color.
+func (w *wangset) EdgeColor(lid, edge int) *wangcolor {
+  return w.colorAt(lid, edge)
+}
+
+// colorAt returns the color at a position of a tile of the wang set.
+func (w *wangset) colorAt(lid, pos int) *wangcolor {
+  id, ok := w.TileWangId(lid)
+  if !ok || pos < 0 || pos >= len(id) {
+    return nil
+  }
+  return w.Color(id[pos])
+}
+
+// Corners returns the colors at the corners, clockwise from the top right.
+func (id WangId) Corners() [4]int {
+  return [4]int{id[WangTopRight], id[WangBottomRight], id[WangBottomLeft], id[WangTopLeft]}
+}
+
+// Edges returns the colors at the edges, clockwise from the top.
+func (id WangId) Edges() [4]int {
+  return [4]int{id[WangTop], id[WangRight], id[WangBottom], id[WangLeft]}
+}
+
+// Transform returns the wang id of a tile placed with flip flags. Tiled flips
+// tiles diagonally first, then horizontally, then vertically.
+func (id WangId) Transform(h, v, d bool) WangId {
+  if d {
+    // swap the top right with the bottom left half
+    id = id.permute(func(i int) int { return (14 - i) % 8 })
+  }
+  if h {
+    id = id.permute(func(i int) int { return (8 - i) % 8 })
+  }
+  if v {
+    id = id.permute(func(i int) int { return (12 - i) % 8 })
+  }
+  return id
+}
+
+// untransform undoes Transform.
+func (id WangId) untransform(h, v, d bool) WangId {
+  // every flip is its own inverse, they only have to be undone in reverse
+  return id.Transform(false, v, false).Transform(h, false, false).Transform(false, false, d)
+}
+
+// permute returns the wang id with each position taking the color of another.
+func (id WangId) permute(from func(i int) int) (out WangId) {
+  for i := range out {
+    out[i] = id[from(i)]
+  }
+  return
+}
+
+// allows returns whether the transformations of a tileset allow a tile to be
+// placed with a set of flip flags. Rotations are a diagonal flip combined with
+// another one, and half a turn is a flip both ways.
+func (t transformations) allows(h, v, d bool) bool {
+  rotation := (d && h && !v) || (d && !h && v) || (!d && h && v)
+  switch {
+  case !h && !v && !d:
+    return true
+  case t.Rotate && (t.HFlip || t.VFlip):
+    return true
+  case t.Rotate && rotation:
+    return true
+  case d:
+    return false
+  case h && v:
+    return t.HFlip && t.VFlip
+  case h:
+    return t.HFlip
+  }
+  return t.VFlip
+}
@@ -0,0 +1,67 @@
+package tmx
+
+import "testing"
+
+// flipNames names the flip combinations by their bits, horizontal, vertical
+// and diagonal.
+var flipNames = [8]string{"none", "d", "v", "vd", "h", "hd", "hv", "hvd"}
+
+func flipBits(i int) (h, v, d bool) {
+	return i&4 != 0, i&2 != 0, i&1 != 0
+}
+
+func TestWangIdTransform(t *testing.T) {
+	id := WangId{1, 2, 3, 4, 5, 6, 7, 8}
+	// the colors of the top, top right, right and top left of the placed tile
+	wants := [8][4]int{
+		{1, 2, 3, 8}, // none
+		{7, 6, 5, 8}, // d swaps top and left, right and bottom
+		{5, 4, 3, 6}, // v swaps top and bottom
+		{3, 4, 5, 2}, // vd, a quarter turn counter clockwise
+		{1, 8, 7, 2}, // h swaps left and right
+		{7, 8, 1, 6}, // hd, a quarter turn clockwise
+		{5, 6, 7, 4}, // hv, half a turn
+		{3, 2, 1, 4}, // hvd, flipped along the other diagonal
+	}
+	seen := make(map[WangId]string)
+	for i, w := range wants {
+		h, v, d := flipBits(i)
+		got := id.Transform(h, v, d)
+		if c := [4]int{got[WangTop], got[WangTopRight], got[WangRight], got[WangTopLeft]}; c != w {
+			t.Errorf("%s: top, top right, right, top left = %v, want %v", flipNames[i], c, w)
+		}
+		if back := got.untransform(h, v, d); back != id {
+			t.Errorf("%s: untransform gave %v, want %v", flipNames[i], back, id)
+		}
+		if other, ok := seen[got]; ok {
+			t.Errorf("%s and %s give the same wang id %v", flipNames[i], other, got)
+		}
+		seen[got] = flipNames[i]
+	}
+}
+
+func TestTransformationsAllows(t *testing.T) {
+	cases := []struct {
+		t       transformations
+		allowed string // flip combinations allowed, by index into flipNames
+	}{
+		{transformations{}, "0"},
+		{transformations{HFlip: true}, "04"},
+		{transformations{VFlip: true}, "02"},
+		{transformations{HFlip: true, VFlip: true}, "0246"},
+		{transformations{Rotate: true}, "0356"},
+		{transformations{Rotate: true, HFlip: true}, "01234567"},
+		{transformations{Rotate: true, VFlip: true}, "01234567"},
+	}
+	for _, c := range cases {
+		for i := range flipNames {
+			want := false
+			for _, a := range c.allowed {
+				want = want || int(a-'0') == i
+			}
+			if got := c.t.allows(flipBits(i)); got != want {
+				t.Errorf("%+v allows %s = %v, want %v", c.t, flipNames[i], got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,875 @@
+package tmx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	// writing errors
+	zstdUnsupported = errors.New("zstd compression isn't available in the standard library")
+)
+
+const (
+	// string constants
+	csvEncoding = "csv"
+	zStd        = "zstd"
+)
+
+// TilesetMode is how a written map holds its tilesets.
+type TilesetMode int
+
+const (
+	// KeepTilesets leaves embedded tilesets embedded and external ones
+	// external.
+	KeepTilesets TilesetMode = iota
+	// EmbedTilesets writes every tileset into the map.
+	EmbedTilesets
+	// ExternalTilesets refers to every tileset by the file name TilesetFile
+	// gives it, the files themselves are written with WriteTileset.
+	ExternalTilesets
+)
+
+// WriteOptions controls how a map is written.
+type WriteOptions struct {
+	Format      Format      // json or tmx
+	Encoding    string      // csv or base64, empty keeps the encoding of each layer
+	Compression string      // gzip, zlib, or empty for base64 data
+	Tilesets    TilesetMode // embedded or external tilesets
+	Dir         string      // directory the file is written to, empty for the map directory
+}
+
+// Write writes the map in the format of the options. Template objects are
+// written as plain objects since the templates were applied when the map was
+// loaded. Relative paths are rewritten so that they resolve from Dir.
+func (m *tilemap) Write(w io.Writer, o WriteOptions) error {
+	enc := &encoder{m: m, o: o}
+	v, e := enc.encodeMap()
+	if e != nil {
+		return e
+	}
+	if o.Format == FormatTMX {
+		return writeXML(w, xmlMap(v))
+	}
+	return writeJSON(w, v)
+}
+
+// WriteTileset writes a tileset of the map as a tileset file of its own, the
+// way it is referred to when the map is written with ExternalTilesets.
+func (m *tilemap) WriteTileset(w io.Writer, i int, o WriteOptions) error {
+	enc := &encoder{m: m, o: o}
+	v := enc.encodeTileset(&m.Tilesets[i])
+	delete(v, "firstgid")
+	v["version"], v["tiledversion"] = m.Version, m.Tiledversion
+	if o.Format == FormatTMX {
+		return writeXML(w, xmlTileset(v))
+	}
+	return writeJSON(w, v)
+}
+
+// TilesetFile returns the file name a tileset is given when the map is
+// written with ExternalTilesets. Tilesets that share a name are told apart by
+// their index.
+func (m *tilemap) TilesetFile(i int, f Format) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, m.Tilesets[i].Name)
+	if name == empty {
+		name = "tileset"
+	}
+	for j := 0; j < i; j++ {
+		if m.Tilesets[j].Name == m.Tilesets[i].Name {
+			name += "-" + strconv.Itoa(i)
+			break
+		}
+	}
+	if f == FormatTMX {
+		return name + ".tsx"
+	}
+	return name + ".json"
+}
+
+// writeJSON writes a variant as indented json.
+func writeJSON(w io.Writer, v variant) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent(empty, " ")
+	return enc.Encode(v)
+}
+
+// writeXML writes an element as an indented xml document.
+func writeXML(w io.Writer, n xmlNode) error {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	n.write(&b, 0)
+	_, e := w.Write(b.Bytes())
+	return e
+}
+
+// write writes an element and its children with one space of indentation per
+// level. The encoding/xml package escapes the line breaks of text, which makes
+// csv data unreadable, so elements are written by hand.
+func (n *xmlNode) write(b *bytes.Buffer, depth int) {
+	pad := strings.Repeat(" ", depth)
+	b.WriteString(pad + "<" + n.XMLName.Local)
+	for _, a := range n.Attrs {
+		b.WriteString(" " + a.Name.Local + `="`)
+		xml.EscapeText(b, []byte(a.Value))
+		b.WriteString(`"`)
+	}
+	if n.Text == empty && len(n.Children) == 0 {
+		b.WriteString("/>\n")
+		return
+	}
+	b.WriteString(">")
+	if n.Text != empty {
+		var t bytes.Buffer
+		xml.EscapeText(&t, []byte(n.Text))
+		b.Write(bytes.Replace(t.Bytes(), []byte("&#xA;"), []byte("\n"), -1))
+	}
+	if len(n.Children) > 0 {
+		b.WriteString("\n")
+		for i := range n.Children {
+			n.Children[i].write(b, depth+1)
+		}
+		b.WriteString(pad)
+	} else if strings.HasSuffix(n.Text, "\n") {
+		b.WriteString(pad)
+	}
+	b.WriteString("</" + n.XMLName.Local + ">\n")
+}
+
+// encoder turns a loaded map back into the json format.
+type encoder struct {
+	m *tilemap
+	o WriteOptions
+}
+
+// rebase rewrites a path relative to the map so that it is relative to the
+// directory the file is written to.
+func (enc *encoder) rebase(p string) string {
+	if p == empty || enc.o.Dir == empty || enc.m.dir == empty || path.IsAbs(p) {
+		return p
+	}
+	rel, e := filepath.Rel(enc.o.Dir, filepath.Join(enc.m.dir, filepath.FromSlash(p)))
+	if e != nil {
+		return p
+	}
+	return filepath.ToSlash(rel)
+}
+
+// encodeMap encodes the map.
+func (enc *encoder) encodeMap() (variant, error) {
+	m := enc.m
+	v := variant{
+		"type": "map", "version": m.Version, "tiledversion": m.Tiledversion,
+		"orientation": m.Orientation, "renderorder": m.Renderorder,
+		"width": m.Width, "height": m.Height,
+		"tilewidth": m.Tilewidth, "tileheight": m.Tileheight,
+		"infinite": m.Infinite, "nextlayerid": m.NextLayerId,
+		"nextobjectid": m.Nextobjectid,
+	}
+	if m.Backgroundcolor != empty {
+		v["backgroundcolor"] = m.Backgroundcolor
+	}
+	if m.Orientation == staggered || m.Orientation == hexagonal {
+		v["staggeraxis"], v["staggerindex"] = m.StaggerAxis, m.StaggerIndex
+	}
+	if m.Orientation == hexagonal {
+		v["hexsidelength"] = m.HexSideLength
+	}
+	if len(m.Properties) > 0 {
+		v["properties"] = encodeProperties(m.Properties)
+	}
+	tilesets := []interface{}{}
+	for i := 0; i < len(m.Tilesets); i++ {
+		ts := &m.Tilesets[i]
+		switch {
+		case enc.o.Tilesets == ExternalTilesets:
+			tilesets = append(tilesets, variant{"firstgid": ts.Firstgid, "source": m.TilesetFile(i, enc.o.Format)})
+		case enc.o.Tilesets == KeepTilesets && ts.Source != empty:
+			tilesets = append(tilesets, variant{"firstgid": ts.Firstgid, "source": enc.rebase(ts.Source)})
+		default:
+			tilesets = append(tilesets, enc.encodeTileset(ts))
+		}
+	}
+	v["tilesets"] = tilesets
+	ls, e := enc.encodeLayers(m.Layers)
+	if e != nil {
+		return nil, e
+	}
+	v["layers"] = ls
+	return v, nil
+}
+
+// encodeTileset encodes every field of a tileset, with image paths resolved
+// through the tileset file and then rebased.
+func (enc *encoder) encodeTileset(t *tileset) variant {
+	v := variant{
+		"type": "tileset", "firstgid": t.Firstgid, "name": t.Name,
+		"tilewidth": t.Tilewidth, "tileheight": t.Tileheight,
+		"spacing": t.Spacing, "margin": t.Margin,
+		"tilecount": t.Tilecount, "columns": t.Columns,
+	}
+	if t.Image != empty {
+		v["image"] = enc.rebase(t.imagePath(t.Image))
+		v["imagewidth"], v["imageheight"] = t.Imagewidth, t.Imageheight
+	}
+	if t.TransparentColor != empty {
+		v["transparentcolor"] = t.TransparentColor
+	}
+	if t.TileOffsets != (offset{}) {
+		v["tileoffset"] = variant{"x": t.TileOffsets.X, "y": t.TileOffsets.Y}
+	}
+	if t.ObjectAlignment != empty {
+		v["objectalignment"] = t.ObjectAlignment
+	}
+	if t.Grid.Orientation != empty {
+		v["grid"] = variant{"orientation": t.Grid.Orientation, "width": t.Grid.Width, "height": t.Grid.Height}
+	}
+	if len(t.Properties) > 0 {
+		v["properties"] = encodeProperties(t.Properties)
+	}
+	if len(t.TerrianTypes) > 0 {
+		var ts []interface{}
+		for _, tt := range t.TerrianTypes {
+			tv := variant{"name": tt.Name, "tile": tt.Tile}
+			if len(tt.Properties) > 0 {
+				tv["properties"] = encodeProperties(tt.Properties)
+			}
+			ts = append(ts, tv)
+		}
+		v["terrains"] = ts
+	}
+	if len(t.Tiles) > 0 {
+		var tiles []interface{}
+		for i := 0; i < len(t.Tiles); i++ {
+			tiles = append(tiles, enc.encodeTile(t, &t.Tiles[i]))
+		}
+		v["tiles"] = tiles
+	}
+	if len(t.Wangsets) > 0 {
+		var ws []interface{}
+		for _, w := range t.Wangsets {
+			ws = append(ws, encodeWangset(w))
+		}
+		v["wangsets"] = ws
+	}
+	if t.Transformations != (transformations{}) {
+		tr := t.Transformations
+		v["transformations"] = variant{
+			"hflip": tr.HFlip, "vflip": tr.VFlip, "rotate": tr.Rotate,
+			"preferuntransformed": tr.PreferUntransformed,
+		}
+	}
+	return v
+}
+
+// encodeTile encodes the metadata of a tile.
+func (enc *encoder) encodeTile(ts *tileset, t *tile) variant {
+	v := variant{"id": t.Id}
+	if t.Type != empty {
+		v["type"] = t.Type
+	}
+	if t.Class != empty {
+		v["class"] = t.Class
+	}
+	if t.Image != empty {
+		v["image"] = enc.rebase(ts.imagePath(t.Image))
+		v["imagewidth"], v["imageheight"] = t.ImageWidth, t.ImageHeight
+	}
+	if len(t.Terrian) > 0 {
+		v["terrain"] = t.Terrian
+	}
+	if len(t.Properties) > 0 {
+		v["properties"] = encodeProperties(t.Properties)
+	}
+	if len(t.ObjectGroup.Objects) > 0 {
+		og := enc.layerFields(&t.ObjectGroup)
+		og["type"], og["draworder"] = objectLayer, t.ObjectGroup.DrawOrder
+		og["objects"] = encodeObjects(t.ObjectGroup.Objects)
+		v["objectgroup"] = og
+	}
+	if len(t.Animation) > 0 {
+		var frames []interface{}
+		for _, f := range t.Animation {
+			frames = append(frames, variant{"tileid": f.TileId, "duration": f.Duration})
+		}
+		v["animation"] = frames
+	}
+	return v
+}
+
+// encodeWangset encodes a wang set in the format of Tiled 1.5. Flips are only
+// written for the tiles of sets from before 1.5 that list them.
+func encodeWangset(w wangset) variant {
+	colors := []interface{}{}
+	for _, c := range w.Colors {
+		cv := variant{"name": c.Name, "color": c.Color, "tile": c.Tile, "probability": c.Probability}
+		if len(c.Properties) > 0 {
+			cv["properties"] = encodeProperties(c.Properties)
+		}
+		colors = append(colors, cv)
+	}
+	tiles := []interface{}{}
+	for _, t := range w.WangTiles {
+		tv := variant{"tileid": t.TileId, "wangid": t.WangId}
+		if t.HFlip || t.VFlip || t.DFlip {
+			tv["hflip"], tv["vflip"], tv["dflip"] = t.HFlip, t.VFlip, t.DFlip
+		}
+		tiles = append(tiles, tv)
+	}
+	v := variant{"name": w.Name, "type": w.Type, "tile": w.Tile, "colors": colors, "wangtiles": tiles}
+	if len(w.Properties) > 0 {
+		v["properties"] = encodeProperties(w.Properties)
+	}
+	return v
+}
+
+// encodeProperties encodes a list of properties.
+func encodeProperties(ps []property) []interface{} {
+	out := []interface{}{}
+	for _, p := range ps {
+		t := p.Type
+		if t == empty {
+			t = "string"
+		}
+		out = append(out, variant{"name": p.Name, "type": t, "value": p.Value})
+	}
+	return out
+}
+
+// layerFields encodes the fields every kind of layer has.
+func (enc *encoder) layerFields(l *layer) variant {
+	v := variant{
+		"id": l.Id, "name": l.Name, "type": l.Type, "visible": l.Visible,
+		"opacity": l.Opacity, "x": l.X, "y": l.Y,
+	}
+	if l.Offsetx != 0 || l.Offsety != 0 {
+		v["offsetx"], v["offsety"] = l.Offsetx, l.Offsety
+	}
+	if len(l.Properties) > 0 {
+		v["properties"] = encodeProperties(l.Properties)
+	}
+	return v
+}
+
+// encodeLayers encodes a set of layers.
+func (enc *encoder) encodeLayers(ls []layer) ([]interface{}, error) {
+	out := []interface{}{}
+	for i := 0; i < len(ls); i++ {
+		l := &ls[i]
+		v := enc.layerFields(l)
+		switch l.Type {
+		case groupLayer:
+			sub, e := enc.encodeLayers(l.Layers)
+			if e != nil {
+				return nil, e
+			}
+			v["layers"] = sub
+		case tileLayer:
+			if e := enc.encodeTileData(l, v); e != nil {
+				return nil, e
+			}
+		case objectLayer:
+			if l.DrawOrder != empty {
+				v["draworder"] = l.DrawOrder
+			}
+			v["objects"] = encodeObjects(l.Objects)
+		default:
+			v["image"] = enc.rebase(l.Image)
+			if l.TransparentColor != empty {
+				v["transparentcolor"] = l.TransparentColor
+			}
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// encodeTileData encodes the tile data of a layer, in the layer or in its
+// chunks, with the encoding and compression of the options.
+func (enc *encoder) encodeTileData(l *layer, v variant) error {
+	if e := l.Decode(); e != nil {
+		return e
+	}
+	encoding, compression := enc.o.Encoding, enc.o.Compression
+	if encoding == empty {
+		encoding, compression = csvEncoding, l.Compression
+		if l.Encoding == base_64 {
+			encoding = base_64
+		}
+	}
+	if encoding == base_64 {
+		v["encoding"] = base_64
+		if compression != uncompressed {
+			v["compression"] = compression
+		}
+	}
+	v["width"], v["height"] = l.Width, l.Height
+	if len(l.Chunks) == 0 {
+		ts, _ := l.Tiles()
+		d, e := encodeGids(rawGids(ts), encoding, compression)
+		v["data"] = d
+		return e
+	}
+	var chunks []interface{}
+	for i := 0; i < len(l.Chunks); i++ {
+		c := &l.Chunks[i]
+		ts := c.Tiles()
+		if ts == nil && c.raw != nil {
+			// streamed chunks are decoded into a copy and left encoded
+			d := c.raw
+			if e := enc.m.processTileData(&d, *l, c.Width*c.Height); e != nil {
+				return e
+			}
+			ts = d.([]*Tile)
+		}
+		d, e := encodeGids(rawGids(ts), encoding, compression)
+		if e != nil {
+			return e
+		}
+		chunks = append(chunks, variant{"x": c.X, "y": c.Y, "width": c.Width, "height": c.Height, "data": d})
+	}
+	v["chunks"] = chunks
+	return nil
+}
+
+// rawGids returns the global ids of a set of tiles with the flip flags set in
+// the high bits.
+func rawGids(ts []*Tile) []uint32 {
+	gids := make([]uint32, len(ts))
+	for i, t := range ts {
+		if t == nil || t.Nil() {
+			continue
+		}
+		gids[i] = t.gid | flagBits(t.horizontialFlip, t.verticalFlip, t.diagonalFlip)
+	}
+	return gids
+}
+
+// flagBits returns the high bits of a global id for a set of flips.
+func flagBits(h, v, d bool) (n uint32) {
+	if h {
+		n |= horizontalFlag
+	}
+	if v {
+		n |= verticalFlag
+	}
+	if d {
+		n |= diagonalFlag
+	}
+	return
+}
+
+// encodeGids encodes global ids as a list of numbers for csv, or as a base64
+// string of compressed little endian bytes.
+func encodeGids(gids []uint32, encoding, compression string) (interface{}, error) {
+	switch encoding {
+	case csvEncoding:
+		return gids, nil
+	case base_64:
+	default:
+		return nil, unsupportedEncoding
+	}
+	b := make([]byte, len(gids)*numBytes)
+	for i, g := range gids {
+		binary.LittleEndian.PutUint32(b[i*numBytes:], g)
+	}
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch compression {
+	case gZip:
+		w = gzip.NewWriter(&buf)
+	case zLib:
+		w = zlib.NewWriter(&buf)
+	case uncompressed:
+		buf.Write(b)
+	case zStd:
+		return nil, zstdUnsupported
+	default:
+		return nil, unsupportedCompression
+	}
+	if w != nil {
+		if _, e := w.Write(b); e != nil {
+			return nil, e
+		}
+		if e := w.Close(); e != nil {
+			return nil, e
+		}
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// encodeObjects encodes a list of objects. Tile objects get their flip flags
+// back in the high bits of their global id.
+func encodeObjects(objs []object) []interface{} {
+	out := []interface{}{}
+	for i := 0; i < len(objs); i++ {
+		o := &objs[i]
+		v := variant{
+			"id": o.Id, "name": o.Name, "type": o.Type, "x": o.X, "y": o.Y,
+			"width": o.Width, "height": o.Height, "rotation": o.Rotation,
+			"visible": o.Visible,
+		}
+		if o.Class != empty {
+			v["class"] = o.Class
+		}
+		if o.Gid != 0 {
+			v["gid"] = uint32(o.Gid) | flagBits(o.HorizontialFlip, o.VerticalFlip, o.DiagonalFlip)
+		}
+		switch {
+		case o.Ellipse:
+			v["ellipse"] = true
+		case o.Point:
+			v["point"] = true
+		case len(o.Polygon) > 0:
+			v["polygon"] = encodePoints(o.Polygon)
+		case len(o.Polyline) > 0:
+			v["polyline"] = encodePoints(o.Polyline)
+		case o.Text.Text != empty:
+			t := variant{"text": o.Text.Text, "wrap": o.Text.Wrap}
+			for k, s := range map[string]string{"color": o.Text.Color, "fontfamily": o.Text.Font, "halign": o.Text.HAlign, "valign": o.Text.VAlign} {
+				if s != empty {
+					t[k] = s
+				}
+			}
+			v["text"] = t
+		}
+		if len(o.Properties) > 0 {
+			v["properties"] = encodeProperties(o.Properties)
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// encodePoints encodes the points of a polygon or polyline.
+func encodePoints(ps []point) []interface{} {
+	out := []interface{}{}
+	for _, p := range ps {
+		out = append(out, variant{"x": p.X, "y": p.Y})
+	}
+	return out
+}
+
+// attrValue formats a value for an xml attribute.
+func attrValue(x interface{}) string {
+	switch v := x.(type) {
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return fmt.Sprint(x)
+}
+
+// element builds an xml element out of the values of a variant under the
+// given keys, in order, skipping the ones that are missing or empty.
+func element(name string, v variant, keys ...string) xmlNode {
+	n := xmlNode{XMLName: xml.Name{Local: name}}
+	for _, k := range keys {
+		if x, ok := v[k]; ok && x != nil && x != empty {
+			n.Attrs = append(n.Attrs, xml.Attr{Name: xml.Name{Local: k}, Value: attrValue(x)})
+		}
+	}
+	return n
+}
+
+// xmlMap converts an encoded map into a <map> element.
+func xmlMap(v variant) xmlNode {
+	n := element("map", v, "version", "tiledversion", "orientation",
+		"renderorder", "width", "height", "tilewidth", "tileheight",
+		"hexsidelength", "staggeraxis", "staggerindex", "backgroundcolor",
+		"infinite", "nextlayerid", "nextobjectid")
+	n.addProperties(v)
+	for _, ts := range v["tilesets"].([]interface{}) {
+		n.Children = append(n.Children, xmlTileset(ts.(variant)))
+	}
+	n.Children = append(n.Children, xmlLayers(v["layers"].([]interface{}))...)
+	return n
+}
+
+// addProperties adds a <properties> element when the variant has properties.
+func (n *xmlNode) addProperties(v variant) {
+	if ps, ok := v["properties"].([]interface{}); ok && len(ps) > 0 {
+		n.Children = append(n.Children, xmlProperties(ps))
+	}
+}
+
+// xmlProperties converts encoded properties into a <properties> element.
+func xmlProperties(ps []interface{}) xmlNode {
+	n := xmlNode{XMLName: xml.Name{Local: "properties"}}
+	for _, x := range ps {
+		p := x.(variant)
+		c := element("property", p, "name")
+		t := p["type"].(string)
+		if t != "string" {
+			c.Attrs = append(c.Attrs, xml.Attr{Name: xml.Name{Local: "type"}, Value: t})
+		}
+		switch val := p["value"].(type) {
+		case map[string]interface{}:
+			// class properties hold their members as nested properties
+			var members []interface{}
+			for k, m := range val {
+				members = append(members, variant{"name": k, "type": valueType(m), "value": m})
+			}
+			c.Children = append(c.Children, xmlProperties(members))
+		case string:
+			if strings.Contains(val, "\n") {
+				c.Text = val
+				break
+			}
+			c.Attrs = append(c.Attrs, xml.Attr{Name: xml.Name{Local: "value"}, Value: val})
+		case bool:
+			c.Attrs = append(c.Attrs, xml.Attr{Name: xml.Name{Local: "value"}, Value: strconv.FormatBool(val)})
+		default:
+			c.Attrs = append(c.Attrs, xml.Attr{Name: xml.Name{Local: "value"}, Value: attrValue(val)})
+		}
+		n.Children = append(n.Children, c)
+	}
+	return n
+}
+
+// valueType guesses the property type of a member of a class property.
+func valueType(x interface{}) string {
+	switch x.(type) {
+	case bool:
+		return "bool"
+	case float64:
+		return "float"
+	case map[string]interface{}:
+		return "class"
+	}
+	return "string"
+}
+
+// xmlTileset converts an encoded tileset into a <tileset> element.
+func xmlTileset(v variant) xmlNode {
+	if _, external := v["source"]; external {
+		return element("tileset", v, "firstgid", "source")
+	}
+	n := element("tileset", v, "version", "tiledversion", "firstgid", "name",
+		"tilewidth", "tileheight", "spacing", "margin", "tilecount", "columns",
+		"objectalignment")
+	if o, ok := v["tileoffset"].(variant); ok {
+		n.Children = append(n.Children, element("tileoffset", o, "x", "y"))
+	}
+	if g, ok := v["grid"].(variant); ok {
+		n.Children = append(n.Children, element("grid", g, "orientation", "width", "height"))
+	}
+	n.addProperties(v)
+	if t, ok := v["transformations"].(variant); ok {
+		n.Children = append(n.Children, element("transformations", t, "hflip", "vflip", "rotate", "preferuntransformed"))
+	}
+	if _, ok := v["image"]; ok {
+		n.Children = append(n.Children, xmlImage(v))
+	}
+	if ts, ok := v["terrains"].([]interface{}); ok {
+		tt := xmlNode{XMLName: xml.Name{Local: "terraintypes"}}
+		for _, x := range ts {
+			c := element("terrain", x.(variant), "name", "tile")
+			c.addProperties(x.(variant))
+			tt.Children = append(tt.Children, c)
+		}
+		n.Children = append(n.Children, tt)
+	}
+	if ts, ok := v["tiles"].([]interface{}); ok {
+		for _, x := range ts {
+			n.Children = append(n.Children, xmlTile(x.(variant)))
+		}
+	}
+	if ws, ok := v["wangsets"].([]interface{}); ok {
+		wn := xmlNode{XMLName: xml.Name{Local: "wangsets"}}
+		for _, x := range ws {
+			wn.Children = append(wn.Children, xmlWangset(x.(variant)))
+		}
+		n.Children = append(n.Children, wn)
+	}
+	return n
+}
+
+// xmlImage converts the image fields of a tileset, tile, or image layer into
+// an <image> element.
+func xmlImage(v variant) xmlNode {
+	n := element("image", variant{
+		"source": v["image"], "width": v["imagewidth"], "height": v["imageheight"],
+	}, "source", "width", "height")
+	if t, ok := v["transparentcolor"].(string); ok {
+		n.Attrs = append(n.Attrs, xml.Attr{Name: xml.Name{Local: "trans"}, Value: strings.TrimPrefix(t, "#")})
+	}
+	return n
+}
+
+// xmlTile converts the encoded metadata of a tile into a <tile> element.
+func xmlTile(v variant) xmlNode {
+	n := element("tile", v, "id", "type", "class")
+	if corners, ok := v["terrain"].([]int); ok {
+		fs := make([]string, len(corners))
+		for i, c := range corners {
+			if c >= 0 {
+				fs[i] = strconv.Itoa(c)
+			}
+		}
+		n.Attrs = append(n.Attrs, xml.Attr{Name: xml.Name{Local: "terrain"}, Value: strings.Join(fs, ",")})
+	}
+	n.addProperties(v)
+	if _, ok := v["image"]; ok {
+		n.Children = append(n.Children, xmlImage(v))
+	}
+	if og, ok := v["objectgroup"].(variant); ok {
+		n.Children = append(n.Children, xmlLayers([]interface{}{og})...)
+	}
+	if fs, ok := v["animation"].([]interface{}); ok {
+		a := xmlNode{XMLName: xml.Name{Local: "animation"}}
+		for _, f := range fs {
+			a.Children = append(a.Children, element("frame", f.(variant), "tileid", "duration"))
+		}
+		n.Children = append(n.Children, a)
+	}
+	return n
+}
+
+// xmlWangset converts an encoded wang set into a <wangset> element.
+func xmlWangset(v variant) xmlNode {
+	n := element("wangset", v, "name", "type", "tile")
+	n.addProperties(v)
+	for _, x := range v["colors"].([]interface{}) {
+		c := element("wangcolor", x.(variant), "name", "color", "tile", "probability")
+		c.addProperties(x.(variant))
+		n.Children = append(n.Children, c)
+	}
+	for _, x := range v["wangtiles"].([]interface{}) {
+		t := x.(variant)
+		ids := make([]string, len(t["wangid"].([]int)))
+		for i, c := range t["wangid"].([]int) {
+			ids[i] = strconv.Itoa(c)
+		}
+		c := element("wangtile", t, "tileid")
+		c.Attrs = append(c.Attrs, xml.Attr{Name: xml.Name{Local: "wangid"}, Value: strings.Join(ids, ",")})
+		for _, f := range []string{"hflip", "vflip", "dflip"} {
+			if b, _ := t[f].(bool); b {
+				c.Attrs = append(c.Attrs, xml.Attr{Name: xml.Name{Local: f}, Value: "1"})
+			}
+		}
+		n.Children = append(n.Children, c)
+	}
+	return n
+}
+
+// xmlLayers converts encoded layers into layer elements.
+func xmlLayers(ls []interface{}) (out []xmlNode) {
+	common := []string{"visible", "opacity", "offsetx", "offsety"}
+	for _, x := range ls {
+		v := x.(variant)
+		var n xmlNode
+		switch v["type"] {
+		case tileLayer:
+			n = element("layer", v, append([]string{"id", "name", "x", "y", "width", "height"}, common...)...)
+			n.addProperties(v)
+			n.Children = append(n.Children, xmlData(v))
+		case objectLayer:
+			n = element(objectLayer, v, append([]string{"id", "name", "draworder"}, common...)...)
+			n.addProperties(v)
+			for _, o := range v["objects"].([]interface{}) {
+				n.Children = append(n.Children, xmlObject(o.(variant)))
+			}
+		case groupLayer:
+			n = element(groupLayer, v, append([]string{"id", "name"}, common...)...)
+			n.addProperties(v)
+			n.Children = append(n.Children, xmlLayers(v["layers"].([]interface{}))...)
+		default:
+			n = element("imagelayer", v, append([]string{"id", "name"}, common...)...)
+			n.addProperties(v)
+			n.Children = append(n.Children, xmlImage(v))
+		}
+		out = append(out, n)
+	}
+	return
+}
+
+// xmlData converts the encoded tile data of a layer into a <data> element,
+// with csv data broken up into rows.
+func xmlData(v variant) xmlNode {
+	d := element("data", v, "encoding", "compression")
+	if _, ok := v["encoding"]; !ok {
+		d.Attrs = append(d.Attrs, xml.Attr{Name: xml.Name{Local: "encoding"}, Value: csvEncoding})
+	}
+	text := func(data interface{}, width int) string {
+		gids, ok := data.([]uint32)
+		if !ok {
+			return "\n" + data.(string) + "\n"
+		}
+		var b strings.Builder
+		b.WriteString("\n")
+		for i, g := range gids {
+			b.WriteString(strconv.FormatUint(uint64(g), 10))
+			if i < len(gids)-1 {
+				b.WriteString(",")
+			}
+			if width > 0 && (i+1)%width == 0 || i == len(gids)-1 {
+				b.WriteString("\n")
+			}
+		}
+		return b.String()
+	}
+	if cs, ok := v["chunks"].([]interface{}); ok {
+		for _, x := range cs {
+			c := x.(variant)
+			n := element("chunk", c, "x", "y", "width", "height")
+			n.Text = text(c["data"], c["width"].(int))
+			d.Children = append(d.Children, n)
+		}
+		return d
+	}
+	d.Text = text(v["data"], v["width"].(int))
+	return d
+}
+
+// xmlObject converts an encoded object into an <object> element.
+func xmlObject(v variant) xmlNode {
+	n := element("object", v, "id", "name", "type", "class", "gid", "x", "y",
+		"width", "height", "rotation", "visible")
+	n.addProperties(v)
+	switch {
+	case v["ellipse"] != nil:
+		n.Children = append(n.Children, xmlNode{XMLName: xml.Name{Local: "ellipse"}})
+	case v["point"] != nil:
+		n.Children = append(n.Children, xmlNode{XMLName: xml.Name{Local: "point"}})
+	case v["polygon"] != nil || v["polyline"] != nil:
+		kind := "polygon"
+		if v["polyline"] != nil {
+			kind = "polyline"
+		}
+		var fs []string
+		for _, p := range v[kind].([]interface{}) {
+			fs = append(fs, attrValue(p.(variant)["x"])+","+attrValue(p.(variant)["y"]))
+		}
+		n.Children = append(n.Children, element(kind, variant{"points": strings.Join(fs, " ")}, "points"))
+	case v["text"] != nil:
+		t := v["text"].(variant)
+		c := element("text", t, "fontfamily", "wrap", "color", "halign", "valign")
+		c.Text = t["text"].(string)
+		n.Children = append(n.Children, c)
+	}
+	return n
+}